@@ -0,0 +1,85 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type AccountCommand struct {
+	*Meta
+
+	GameName    string
+	ProfileName string
+}
+
+// Show the account profile a game uses for mail, or assign a new one.
+// Use "none" to go back to the top level settings.
+func (c *AccountCommand) run(*kingpin.ParseContext) error {
+	game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+	if err != nil {
+		return err
+	}
+
+	if c.ProfileName == "" {
+		profileName := c.Meta.AccountFor(game.Name)
+		if profileName == "" {
+			profileName = "the default account"
+		}
+
+		config, err := c.Meta.Config.WithAccount(c.Meta.AccountFor(game.Name))
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Output(fmt.Sprintf("%v uses %v (%v)", game.Name, profileName, config.Smtpsettings.From))
+		return nil
+	}
+
+	settings := c.Meta.Config.GameSettings(game.Name)
+
+	if strings.ToLower(c.ProfileName) == "none" {
+		settings.Account = ""
+	} else {
+		if _, err := c.Meta.Config.AccountProfile(c.ProfileName); err != nil {
+			return err
+		}
+
+		settings.Account = c.ProfileName
+	}
+
+	if c.Meta.Config.Games == nil {
+		c.Meta.Config.Games = make(map[string]Gamesettings)
+	}
+	c.Meta.Config.Games[strings.ToLower(game.Name)] = settings
+
+	err = WriteConfigTo(c.Meta.Config, c.Meta.RunContext.BaseConfigurationPath)
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("%v now uses %v", game.Name, c.ProfileName))
+
+	return nil
+}
+
+func (c *AccountCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureAccountCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "account"
+	c := &AccountCommand{Meta: meta}
+	cmd := app.Command(commandName, "Show the account profile a game uses for mail, or assign an account profile to it.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game").Required().StringVar(&c.GameName)
+		cmd.Arg("profile_name", "Name of the account profile to assign, none for the default account").StringVar(&c.ProfileName)
+	}
+
+	return commandName
+}
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Find an account profile by name. Profile names are case insensitive.
+func (config ConfigStruct) AccountProfile(profileName string) (Accountprofile, error) {
+	for name, profile := range config.Accounts {
+		if strings.ToLower(name) == strings.ToLower(profileName) {
+			return profile, nil
+		}
+	}
+
+	return Accountprofile{}, errors.New(fmt.Sprintf("No account profile called %v in config", profileName))
+}
+
+// The config as seen through an account profile: every settings block the profile defines
+// replaces the top level one. An empty profile name returns the config unchanged.
+func (config ConfigStruct) WithAccount(profileName string) (ConfigStruct, error) {
+	if profileName == "" {
+		return config, nil
+	}
+
+	profile, err := config.AccountProfile(profileName)
+	if err != nil {
+		return config, err
+	}
+
+	if profile.Smtpsettings != nil {
+		config.Smtpsettings = *profile.Smtpsettings
+	}
+
+	if profile.Imapsettings != nil {
+		config.Imapsettings = *profile.Imapsettings
+	}
+
+	if profile.Pop3settings != nil {
+		config.Pop3settings = *profile.Pop3settings
+	}
+
+	if profile.Maildirsettings != nil {
+		config.Maildirsettings = *profile.Maildirsettings
+	}
+
+	return config, nil
+}
+
+// The account profile to use for a game: the one given with --profile, or else the one assigned to the game
+func (m *Meta) AccountFor(gameName string) string {
+	if m.Profile != "" {
+		return m.Profile
+	}
+
+	return m.globalConfig().GameSettings(gameName).Account
+}
+
+// Switch m.Config to the given account profile. An empty name switches back to the top level settings.
+func (m *Meta) UseAccount(profileName string) error {
+	config, err := m.globalConfig().WithAccount(profileName)
+	if err != nil {
+		return err
+	}
+
+	m.Config = config
+	m.account = profileName
+
+	return nil
+}
+
+// Switch m.Config to the account profile for a game, see AccountFor
+func (m *Meta) UseAccountFor(gameName string) error {
+	return m.UseAccount(m.AccountFor(gameName))
+}
+
+// The name of the account profile m.Config currently uses, empty for the top level settings
+func (m *Meta) Account() string {
+	return m.account
+}
+
+// The config as loaded, before any account profile was applied
+func (m *Meta) globalConfig() ConfigStruct {
+	if m.loadedConfig == nil {
+		loadedConfig := m.Config
+		m.loadedConfig = &loadedConfig
+	}
+
+	return *m.loadedConfig
+}
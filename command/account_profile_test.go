@@ -0,0 +1,76 @@
+package command
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAccountConfig() ConfigStruct {
+	return ConfigStruct{
+		Smtpsettings: Smtpsettings{From: "me@example.com", Server: "smtp.example.com"},
+		Imapsettings: Imapsettings{Server: "imap.example.com", From: "llamaserver.net"},
+		Accounts: map[string]Accountprofile{
+			"Club": {Smtpsettings: &Smtpsettings{From: "me@club.example", Server: "mail.club.example"}},
+		},
+		Games: map[string]Gamesettings{"clubgame": {Account: "club"}},
+	}
+}
+
+func TestWithAccount(t *testing.T) {
+	config, err := testAccountConfig().WithAccount("club")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "me@club.example", config.Smtpsettings.From)
+	assert.Equal(t, "mail.club.example", config.Smtpsettings.Server)
+	// Blocks the profile doesn't define stay as they are
+	assert.Equal(t, "imap.example.com", config.Imapsettings.Server)
+}
+
+func TestWithAccountUnknownProfile(t *testing.T) {
+	_, err := testAccountConfig().WithAccount("nowhere")
+
+	assert.Error(t, err)
+}
+
+func TestUseAccountFor(t *testing.T) {
+	meta := &Meta{Config: testAccountConfig()}
+
+	assert.NoError(t, meta.UseAccountFor("ClubGame"))
+	assert.Equal(t, "club", meta.Account())
+	assert.Equal(t, "me@club.example", meta.Config.Smtpsettings.From)
+
+	// Games without an account use the top level settings
+	assert.NoError(t, meta.UseAccountFor("othergame"))
+	assert.Equal(t, "", meta.Account())
+	assert.Equal(t, "me@example.com", meta.Config.Smtpsettings.From)
+}
+
+func TestUseAccountForWithProfileFlag(t *testing.T) {
+	meta := &Meta{Config: testAccountConfig(), Profile: "club"}
+
+	assert.NoError(t, meta.UseAccountFor("othergame"))
+	assert.Equal(t, "me@club.example", meta.Config.Smtpsettings.From)
+}
+
+func TestHasPlainPasswordsInAccount(t *testing.T) {
+	config := testAccountConfig()
+	assert.False(t, config.HasPlainPasswords())
+
+	config.Accounts["club"] = Accountprofile{Imapsettings: &Imapsettings{Password: "secret"}}
+	assert.True(t, config.HasPlainPasswords())
+}
+
+func TestAccountProfilesSurviveConfigRoundTrip(t *testing.T) {
+	configPath := filepath.Join(testDirectory(t), "config.json")
+	assert.NoError(t, WriteConfigTo(testAccountConfig(), configPath))
+
+	config, err := LoadConfigFrom(configPath)
+	assert.NoError(t, err)
+
+	config, err = config.WithAccount("club")
+	assert.NoError(t, err)
+	assert.Equal(t, "me@club.example", config.Smtpsettings.From)
+	assert.Equal(t, "club", config.GameSettings("clubgame").Account)
+}
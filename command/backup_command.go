@@ -1,7 +1,9 @@
 package command
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/promisedlandt/dom4tools/game"
 
@@ -13,26 +15,72 @@ type BackupCommand struct {
 
 	Game       *game.Game
 	GameName   string
+	Nation     string
 	TurnNumber int
 	Force      bool
+	Label      string
 }
 
 func (c *BackupCommand) run(*kingpin.ParseContext) error {
 	if c.Game == nil {
-		game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+		game, err := c.Meta.FindGame(c.GameName, c.Nation)
 		if err != nil {
 			return err
 		}
 
-		c.Game = &game
+		c.Game = game
+	}
+
+	var err error
+	c.Game, err = c.Meta.recoverLeftovers(c.Game)
+	if err != nil {
+		return err
+	}
+
+	if c.TurnNumber <= 0 {
+		turnNumber, ok := c.Game.HeaderTurnNumber()
+		if !ok {
+			return errors.New(fmt.Sprintf("Can't read the turn number from the files of %v, try: d4t backup %v TURN_NUMBER", c.Game.Name, c.Game.Name))
+		}
+
+		c.TurnNumber = turnNumber
 	}
 
 	c.Ui.Output(fmt.Sprintf("Backing up game %v, turn number %v", c.Game.Name, c.TurnNumber))
-	err := c.Game.Backup(c.TurnNumber, c.Force)
+	err = c.Game.Backup(c.TurnNumber, c.Force)
+	if err != nil {
+		return err
+	}
+
+	// The game was read before the backup existed
+	c.Game, err = c.Meta.reloadGame(c.Game)
+	if err != nil {
+		return err
+	}
+
+	if c.Label != "" {
+		err = c.Game.LabelBackup(c.TurnNumber, c.Label)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Meta.pushBackups(c.Game, c.TurnNumber)
 	if err != nil {
 		return err
 	}
 
+	if c.Meta.Config.RetentionFor(c.Game.Name).PruneAfterBackup {
+		plan, err := c.Meta.PruneGame(c.Game, false)
+		if err != nil {
+			return err
+		}
+
+		for _, fullpath := range plan.Delete {
+			c.Ui.Info(fmt.Sprintf("Pruned %v", filepath.Base(fullpath)))
+		}
+	}
+
 	return nil
 }
 
@@ -50,8 +98,10 @@ func ConfigureBackupCommand(app *kingpin.Application, meta *Meta) (commandName s
 	} else {
 		cmd.Action(c.run)
 		cmd.Arg("game_name", "Name of the game to backup").Required().StringVar(&c.GameName)
-		cmd.Arg("turn_number", "Back up which turn number?").Required().IntVar(&c.TurnNumber)
+		cmd.Arg("turn_number", "Back up which turn number? Defaults to the turn in the trn file").IntVar(&c.TurnNumber)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
 		cmd.Flag("force", "overwrite existing backup").Short('f').BoolVar(&c.Force)
+		cmd.Flag("label", "label the backup, so it's never pruned").StringVar(&c.Label)
 	}
 
 	return commandName
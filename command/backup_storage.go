@@ -0,0 +1,152 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/promisedlandt/dom4tools/game"
+)
+
+// Kinds of remote storage for backups
+var StorageTypes = []string{"directory", "sftp", "s3"}
+
+// The storage settings for a game, its own if it has any, the global ones otherwise
+func (config ConfigStruct) StorageFor(gameName string) []Storagesettings {
+	if settings := config.GameSettings(gameName).Storage; settings != nil {
+		return settings
+	}
+
+	return config.Storage
+}
+
+// The remote storages backups of the game are copied to
+func (m *Meta) BackupStorages(gameName string) ([]game.BackupStorage, error) {
+	var storages []game.BackupStorage
+
+	for _, settings := range m.Config.StorageFor(gameName) {
+		storage, err := m.backupStorage(settings)
+		if err != nil {
+			return storages, err
+		}
+
+		storages = append(storages, storage)
+	}
+
+	return storages, nil
+}
+
+func (m *Meta) backupStorage(settings Storagesettings) (game.BackupStorage, error) {
+	switch settings.Type {
+	case "directory":
+		path, err := homedir.Expand(settings.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if path == "" {
+			return nil, errors.New("Directory storage needs a path")
+		}
+
+		return game.DirectoryStorage{Path: path}, nil
+	case "sftp":
+		password, err := m.ResolveSecret(settings.Secret(), "storage")
+		if err != nil {
+			return nil, err
+		}
+
+		keyfile, err := homedir.Expand(settings.Keyfile)
+		if err != nil {
+			return nil, err
+		}
+
+		knownhosts, err := homedir.Expand(settings.Knownhosts)
+		if err != nil {
+			return nil, err
+		}
+
+		return game.SftpStorage{Server: settings.Server, Port: settings.Port, Username: settings.Username, Password: password, KeyFile: keyfile, HostKey: settings.Hostkey, KnownHosts: knownhosts, Path: settings.Path}, nil
+	case "s3":
+		secretKey, err := m.ResolveSecret(settings.Secret(), "storage")
+		if err != nil {
+			return nil, err
+		}
+
+		return game.S3Storage{Endpoint: settings.Endpoint, Region: settings.Region, Bucket: settings.Bucket, Prefix: settings.Path, AccessKey: settings.Username, SecretKey: secretKey}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown storage type %v, use one of %v", settings.Type, strings.Join(StorageTypes, ", ")))
+}
+
+// Read the game again, e.g. after backing up, keeping the selected nation
+func (m *Meta) reloadGame(g *game.Game) (*game.Game, error) {
+	reloaded, err := game.NewGame(g.Name, g.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.useBackupStore(reloaded)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.NationStem != "" {
+		err = reloaded.SelectNation(g.NationStem)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reloaded, nil
+}
+
+// Copy the backups of a turn to every configured storage. A storage that fails is only warned about,
+// the local backup is what matters.
+func (m *Meta) pushBackups(g *game.Game, turnNumber int) error {
+	storages, err := m.BackupStorages(g.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, storage := range storages {
+		names, err := g.PushBackups(storage, turnNumber)
+		if err != nil {
+			m.Ui.Warn(err.Error())
+			continue
+		}
+
+		for _, name := range names {
+			m.Ui.Info(fmt.Sprintf("Stored %v in %v", name, storage))
+		}
+	}
+
+	return nil
+}
+
+// Fetch the backups of a turn from the first configured storage that has them
+func (m *Meta) pullBackups(g *game.Game, turnNumber int) error {
+	storages, err := m.BackupStorages(g.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(storages) == 0 {
+		return errors.New(fmt.Sprintf("No storage configured for %v", g.Name))
+	}
+
+	for _, storage := range storages {
+		fullpaths, err := g.PullBackups(storage, turnNumber)
+		if err != nil {
+			m.Ui.Warn(err.Error())
+			continue
+		}
+
+		if len(fullpaths) > 0 {
+			m.Ui.Info(fmt.Sprintf("Fetched turn %v of %v from %v", turnNumber, g.Name, storage))
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("No storage has backups of turn %v of %v", turnNumber, g.Name))
+}
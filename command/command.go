@@ -1 +1,105 @@
 package command
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/promisedlandt/dom4tools/game"
+)
+
+// Find a game by name and select a nation in it: the given one, or else the default nation from the config.
+// Without either, the game keeps the nation it detected on its own.
+func (m *Meta) FindGame(gameName string, nationName string) (*game.Game, error) {
+	foundGame, err := m.RunContext.GameInstallation.AvailableGames.FindGameByName(gameName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.useBackupStore(&foundGame)
+	if err != nil {
+		return nil, err
+	}
+
+	if nationName == "" {
+		nationName = m.Config.GameSettings(foundGame.Name).Nation
+	}
+
+	if nationName != "" {
+		err = foundGame.SelectNation(nationName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &foundGame, nil
+}
+
+// All games, set up like FindGame does without selecting a nation
+func (m *Meta) AllGames() ([]*game.Game, error) {
+	var games []*game.Game
+
+	for i := range m.RunContext.GameInstallation.AvailableGames {
+		g := &m.RunContext.GameInstallation.AvailableGames[i]
+
+		err := m.useBackupStore(g)
+		if err != nil {
+			return games, err
+		}
+
+		games = append(games, g)
+	}
+
+	return games, nil
+}
+
+// Put back files a crash in the middle of a change left moved aside. What can't be sorted out is left to d4t verify.
+// Only for commands that change the game anyway, looking at a game never touches its files.
+func (m *Meta) recoverLeftovers(g *game.Game) (*game.Game, error) {
+	recovered, _, err := g.RecoverLeftovers()
+	if err != nil {
+		return g, err
+	}
+
+	for _, leftover := range recovered {
+		if leftover.MovedAside {
+			m.Ui.Warn(fmt.Sprintf("Restored %v, an interrupted change had moved it aside", leftover.Original))
+		}
+	}
+
+	if len(recovered) == 0 {
+		return g, nil
+	}
+
+	// The restored files weren't there when the game was read
+	return m.reloadGame(g)
+}
+
+// Archive the backups of the game as configured
+func (m *Meta) useBackupStore(g *game.Game) error {
+	directory, err := m.backupStoreFor(g)
+	if err != nil || directory == "" {
+		return err
+	}
+
+	return g.UseBackupStore(directory)
+}
+
+// The directory backups of the game are archived in, empty if they aren't
+func (m *Meta) backupStoreFor(g *game.Game) (string, error) {
+	settings := m.Config.Backups
+	if settings == nil || !(settings.Archive || settings.Root != "") {
+		return "", nil
+	}
+
+	if settings.Root == "" {
+		return g.DefaultBackupStore(), nil
+	}
+
+	root, err := homedir.Expand(settings.Root)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, g.Name), nil
+}
@@ -19,31 +19,173 @@ func NewDefaultConfig() *viper.Viper {
 		Server:   "smtp.gmail.com",
 		Username: "your.login@email.com",
 		Password: "",
+		Security: "starttls-required",
+	})
+	config.Set("imapsettings", Imapsettings{
+		Port:     "993",
+		Server:   "imap.gmail.com",
+		Username: "your.login@email.com",
+		Password: "",
+		Mailbox:  "INBOX",
+		From:     "llamaserver.net",
 	})
 
 	return config
 }
 
 type ConfigStruct struct {
-	Submitstyle  string       `json:"submitstyle,omitempty"`
-	Getstyle     string       `json:"getstyle,omitempty"`
-	Smtpsettings Smtpsettings `json:"smtpsettings,omitempty"`
-	Imapsettings Imapsettings `json:"imapsettings,omitempty"`
+	Submitstyle        string                    `json:"submitstyle,omitempty"`
+	Getstyle           string                    `json:"getstyle,omitempty"`
+	Smtpsettings       Smtpsettings              `json:"smtpsettings,omitempty"`
+	Imapsettings       Imapsettings              `json:"imapsettings,omitempty"`
+	Pop3settings       Pop3settings              `json:"pop3settings,omitempty"`
+	Maildirsettings    Maildirsettings           `json:"maildirsettings,omitempty"`
+	Sendmailsettings   Sendmailsettings          `json:"sendmailsettings,omitempty"`
+	Commandsettings    Commandsettings           `json:"commandsettings,omitempty"`
+	Dropfoldersettings Dropfoldersettings        `json:"dropfoldersettings,omitempty"`
+	Secretsfile        string                    `json:"secretsfile,omitempty"`
+	Servers            map[string]Serverprofile  `json:"servers,omitempty"`
+	Accounts           map[string]Accountprofile `json:"accounts,omitempty"`
+	Games              map[string]Gamesettings   `json:"games,omitempty"`
+	Retention          *Retentionsettings        `json:"retention,omitempty"`
+	Backups            *Backupsettings           `json:"backups,omitempty"`
+	Storage            []Storagesettings         `json:"storage,omitempty"`
+	Play               *Playsettings             `json:"play,omitempty"`
 }
 
+// Instead of the plain password, the password can also come from password_env, password_command or password_secret, see Secret.
+// Security is one of SmtpSecurityModes, Auth one of SmtpAuthMechanisms.
+// Pinnedcert is the SHA-256 fingerprint of the server certificate.
 type Smtpsettings struct {
-	From     string `json:"from,omitempty"`
-	Server   string `json:"server,omitempty"`
-	Port     string `json:"port,omitempty"`
-	Username string `json:"username,omitempty"`
-	Password string `json:"password,omitempty"`
+	From            string `json:"from,omitempty"`
+	Server          string `json:"server,omitempty"`
+	Port            string `json:"port,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	PasswordCommand string `json:"password_command,omitempty" mapstructure:"password_command"`
+	PasswordEnv     string `json:"password_env,omitempty" mapstructure:"password_env"`
+	PasswordSecret  string `json:"password_secret,omitempty" mapstructure:"password_secret"`
+	Security        string `json:"security,omitempty"`
+	Auth            string `json:"auth,omitempty"`
+	Cafile          string `json:"cafile,omitempty"`
+	Pinnedcert      string `json:"pinnedcert,omitempty"`
 }
 
 type Imapsettings struct {
-	Server   string `json:"server,omitempty"`
-	Port     string `json:"port,omitempty"`
-	Username string `json:"username,omitempty"`
-	Password string `json:"password,omitempty"`
+	Server           string `json:"server,omitempty"`
+	Port             string `json:"port,omitempty"`
+	Username         string `json:"username,omitempty"`
+	Password         string `json:"password,omitempty"`
+	PasswordCommand  string `json:"password_command,omitempty" mapstructure:"password_command"`
+	PasswordEnv      string `json:"password_env,omitempty" mapstructure:"password_env"`
+	PasswordSecret   string `json:"password_secret,omitempty" mapstructure:"password_secret"`
+	Mailbox          string `json:"mailbox,omitempty"`
+	Processedmailbox string `json:"processedmailbox,omitempty"`
+	From             string `json:"from,omitempty"`
+}
+
+type Pop3settings struct {
+	Server          string `json:"server,omitempty"`
+	Port            string `json:"port,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	PasswordCommand string `json:"password_command,omitempty" mapstructure:"password_command"`
+	PasswordEnv     string `json:"password_env,omitempty" mapstructure:"password_env"`
+	PasswordSecret  string `json:"password_secret,omitempty" mapstructure:"password_secret"`
+	From            string `json:"from,omitempty"`
+	Delete          bool   `json:"delete,omitempty"`
+}
+
+type Maildirsettings struct {
+	Path string `json:"path,omitempty"`
+	From string `json:"from,omitempty"`
+}
+
+type Sendmailsettings struct {
+	Path string `json:"path,omitempty"`
+}
+
+type Commandsettings struct {
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type Dropfoldersettings struct {
+	Path string `json:"path,omitempty"`
+}
+
+// A server profile describes how turns are submitted to a game server.
+// Subject, body and attachment are templates, see TurnTemplateData.
+type Serverprofile struct {
+	To         string `json:"to,omitempty"`
+	Subject    string `json:"subject,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Attachment string `json:"attachment,omitempty"`
+}
+
+// An account profile is a mail identity, for games played from a different address.
+// Every settings block it defines replaces the top level one, see ConfigStruct.WithAccount.
+type Accountprofile struct {
+	Smtpsettings    *Smtpsettings    `json:"smtpsettings,omitempty"`
+	Imapsettings    *Imapsettings    `json:"imapsettings,omitempty"`
+	Pop3settings    *Pop3settings    `json:"pop3settings,omitempty"`
+	Maildirsettings *Maildirsettings `json:"maildirsettings,omitempty"`
+}
+
+// Settings for a single game, keyed by game name
+type Gamesettings struct {
+	Server  string `json:"server,omitempty"`
+	Account string `json:"account,omitempty"`
+	// Nation to use when a command gets no --nation, for game directories with several nations
+	Nation string `json:"nation,omitempty"`
+	// Replaces the global retention settings for this game
+	Retention *Retentionsettings `json:"retention,omitempty"`
+	// Replaces the global remote storage for this game
+	Storage []Storagesettings `json:"storage,omitempty"`
+}
+
+// Where backups go. With archive, every turn is a compressed archive in the game's .d4t directory,
+// or in a directory per game below root if that is set.
+type Backupsettings struct {
+	Archive bool   `json:"archive,omitempty"`
+	Root    string `json:"root,omitempty"`
+}
+
+// Which backups d4t prune keeps, see game.RetentionPolicy. Without keep_last, everything is kept.
+type Retentionsettings struct {
+	KeepLast         int  `json:"keep_last,omitempty" mapstructure:"keep_last"`
+	KeepEvery        int  `json:"keep_every,omitempty" mapstructure:"keep_every"`
+	PruneAfterBackup bool `json:"prune_after_backup,omitempty" mapstructure:"prune_after_backup"`
+}
+
+// A remote place every backup is copied to. Type is one of StorageTypes.
+// directory uses path. sftp uses server, port, username, keyfile and path, and hostkey (SHA256 fingerprint) or knownhosts.
+// s3 uses endpoint, region, bucket, path as the key prefix, and username as the access key.
+// The password, or the S3 secret key, can come from password_env, password_command or password_secret, see Secret.
+type Storagesettings struct {
+	Type            string `json:"type,omitempty"`
+	Path            string `json:"path,omitempty"`
+	Server          string `json:"server,omitempty"`
+	Port            string `json:"port,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	PasswordCommand string `json:"password_command,omitempty" mapstructure:"password_command"`
+	PasswordEnv     string `json:"password_env,omitempty" mapstructure:"password_env"`
+	PasswordSecret  string `json:"password_secret,omitempty" mapstructure:"password_secret"`
+	Keyfile         string `json:"keyfile,omitempty"`
+	Hostkey         string `json:"hostkey,omitempty"`
+	Knownhosts      string `json:"knownhosts,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Bucket          string `json:"bucket,omitempty"`
+}
+
+// How d4t play starts Dominions 4. Without executable, it is looked for in installdir, or the usual install locations.
+// Args are templates, see PlayTemplateData, and must be given, see PlayArgs.
+type Playsettings struct {
+	Executable string   `json:"executable,omitempty"`
+	Installdir string   `json:"installdir,omitempty"`
+	Args       []string `json:"args,omitempty"`
 }
 
 var DefaultConfigStruct ConfigStruct
@@ -75,7 +217,12 @@ func SaveConfigTo(viperConfig viper.Viper, path string) error {
 		return err
 	}
 
-	b, err := json.MarshalIndent(DefaultConfigStruct, "", "    ")
+	return WriteConfigTo(DefaultConfigStruct, path)
+}
+
+// Write the given config to path, replacing whatever was there
+func WriteConfigTo(config ConfigStruct, path string) error {
+	b, err := json.MarshalIndent(config, "", "    ")
 	if err != nil {
 		return err
 	}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/promisedlandt/dom4tools/game"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -12,19 +13,85 @@ import (
 type GetCommand struct {
 	*Meta
 
-	GameName string
-	Game     *game.Game
-	//ImapConfig ImapConfig
+	GameName      string
+	Nation        string
+	EmlPath       string
+	MboxPath      string
+	NoBackup      bool
+	Game          *game.Game
+	ImapConfig    game.ImapConfig
+	Pop3Config    game.Pop3Config
+	MaildirConfig game.MaildirConfig
 }
 
 // Gets the given game
 func (c *GetCommand) run(*kingpin.ParseContext) error {
-	game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+	if c.Game == nil {
+		game, err := c.Meta.FindGame(c.GameName, c.Nation)
+		if err != nil {
+			return err
+		}
+
+		c.Game = game
+	}
+
+	var err error
+	c.Game, err = c.Meta.recoverLeftovers(c.Game)
+	if err != nil {
+		return err
+	}
+
+	err = c.Meta.UseAccountFor(c.Game.Name)
+	if err != nil {
+		return err
+	}
+
+	// The new trn replaces the current one, so keep a copy. Only once there is a new turn, though.
+	c.Game.BackupOnInstall = !c.NoBackup
+
+	err = c.getTurn()
 	if err != nil {
 		return err
 	}
 
-	c.Game = &game
+	if c.Game.InstalledBackupTurn > 0 {
+		c.Ui.Info(fmt.Sprintf("Turn %v of %v is backed up", c.Game.InstalledBackupTurn, c.Game.Name))
+
+		backedUp, err := c.Meta.reloadGame(c.Game)
+		if err != nil {
+			return err
+		}
+
+		err = c.Meta.pushBackups(backedUp, c.Game.InstalledBackupTurn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Install the new turn from wherever the config, or the flags, say it is
+func (c *GetCommand) getTurn() (err error) {
+	// Importing from a file always works, no matter how we usually get turns
+	switch {
+	case c.EmlPath != "":
+		err = c.Game.GetTurnFromEml(c.EmlPath)
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Output(fmt.Sprintf("Got turn for %v from %v", c.Game.Name, c.EmlPath))
+		return nil
+	case c.MboxPath != "":
+		err = c.Game.GetTurnFromMbox(c.MboxPath)
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Output(fmt.Sprintf("Got turn for %v from %v", c.Game.Name, c.MboxPath))
+		return nil
+	}
 
 	switch c.Meta.Config.Getstyle {
 	case "folder":
@@ -32,38 +99,62 @@ func (c *GetCommand) run(*kingpin.ParseContext) error {
 			return errors.New("No download folder set in config")
 		}
 
-		err = game.GetTurnFromFolder(c.Meta.RunContext.DownloadsDirectory)
+		err = c.Game.GetTurnFromFolder(c.Meta.RunContext.DownloadsDirectory)
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Output(fmt.Sprintf("Got turn for %v", c.Game.Name))
+	case "imap":
+		imapConfig, err := c.Meta.ImapConfig()
+		if err != nil {
+			return err
+		}
+
+		c.ImapConfig = imapConfig
+
+		c.Ui.Output(fmt.Sprintf("Getting turn for %v from %v", c.Game.Name, c.ImapConfig.Server))
+
+		err = c.Game.GetTurnByMailBuiltin(c.ImapConfig)
 		if err != nil {
 			return err
 		}
 
 		c.Ui.Output(fmt.Sprintf("Got turn for %v", c.Game.Name))
+	case "pop3":
+		pop3Config, err := c.Meta.Pop3Config()
+		if err != nil {
+			return err
+		}
+
+		c.Pop3Config = pop3Config
 
-	//case "imap":
-	//if len(c.Meta.Config.Imapsettings.Port) == 0 {
-	//return errors.New("no port set in imapsettings")
-	//}
+		c.Ui.Output(fmt.Sprintf("Getting turn for %v from %v", c.Game.Name, c.Pop3Config.Server))
 
-	//if len(c.Meta.Config.Imapsettings.Server) == 0 {
-	//return errors.New("no server set in imapsettings")
-	//}
+		err = c.Game.GetTurnByPop3(c.Pop3Config)
+		if err != nil {
+			return err
+		}
 
-	//if len(c.Meta.Config.Imapsettings.Username) == 0 {
-	//return errors.New("no username set in imapsettings")
-	//}
+		c.Ui.Output(fmt.Sprintf("Got turn for %v", c.Game.Name))
+	case "maildir":
+		if len(c.Meta.Config.Maildirsettings.Path) == 0 {
+			return errors.New("no path set in maildirsettings")
+		}
 
-	//if len(c.Meta.Config.Imapsettings.Password) == 0 {
-	//return errors.New("no password set in imapsettings")
-	//}
+		maildirPath, err := homedir.Expand(c.Meta.Config.Maildirsettings.Path)
+		if err != nil {
+			return err
+		}
 
-	//c.ImapConfig = ImapConfig{Port: c.Meta.Config.Imapsettings.Port, Server: c.Meta.Config.Imapsettings.Server, Username: c.Meta.Config.Imapsettings.Username, Password: c.Meta.Config.Imapsettings.Password}
+		c.MaildirConfig = game.MaildirConfig{Path: maildirPath, From: c.Meta.Config.Maildirsettings.From}
 
-	//log.Printf("Getting turn for %s", game.Name)
+		err = c.Game.GetTurnFromMaildir(c.MaildirConfig)
+		if err != nil {
+			return err
+		}
 
-	//err = game.GetTurnByMailBuiltin(c.ImapConfig)
-	//if err != nil {
-	//return err
-	//}
+		c.Ui.Output(fmt.Sprintf("Got turn for %v", c.Game.Name))
 	default:
 		return errors.New("No getstyle set in config")
 	}
@@ -84,8 +175,72 @@ func ConfigureGetCommand(app *kingpin.Application, meta *Meta) (commandName stri
 		cmd.Action(c.completion)
 	} else {
 		cmd.Arg("game_name", "Name of the game you want to get the turn for").Required().StringVar(&c.GameName)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+		cmd.Flag("from-eml", "get the turn from a saved mail instead").PlaceHolder("FILE").StringVar(&c.EmlPath)
+		cmd.Flag("from-mbox", "get the turn from the newest turn mail in an mbox file instead").PlaceHolder("FILE").StringVar(&c.MboxPath)
+		cmd.Flag("no-backup", "don't back up the current turn first").BoolVar(&c.NoBackup)
 		cmd.Action(c.run)
 	}
 
 	return commandName
 }
+
+// The IMAP settings from the config, with the password resolved
+func (m *Meta) ImapConfig() (game.ImapConfig, error) {
+	return m.imapConfigFrom(m.Config.Imapsettings)
+}
+
+func (m *Meta) imapConfigFrom(settings Imapsettings) (game.ImapConfig, error) {
+	if len(settings.Port) == 0 {
+		return game.ImapConfig{}, errors.New("no port set in imapsettings")
+	}
+
+	if len(settings.Server) == 0 {
+		return game.ImapConfig{}, errors.New("no server set in imapsettings")
+	}
+
+	if len(settings.Username) == 0 {
+		return game.ImapConfig{}, errors.New("no username set in imapsettings")
+	}
+
+	password, err := m.ResolveSecret(settings.Secret(), "imapsettings")
+	if err != nil {
+		return game.ImapConfig{}, err
+	}
+
+	if len(password) == 0 {
+		return game.ImapConfig{}, errors.New("no password set in imapsettings")
+	}
+
+	return game.ImapConfig{Port: settings.Port, Server: settings.Server, Username: settings.Username, Password: password, Mailbox: settings.Mailbox, ProcessedMailbox: settings.Processedmailbox, From: settings.From}, nil
+}
+
+// The POP3 settings from the config, with the password resolved
+func (m *Meta) Pop3Config() (game.Pop3Config, error) {
+	return m.pop3ConfigFrom(m.Config.Pop3settings)
+}
+
+func (m *Meta) pop3ConfigFrom(settings Pop3settings) (game.Pop3Config, error) {
+	if len(settings.Port) == 0 {
+		return game.Pop3Config{}, errors.New("no port set in pop3settings")
+	}
+
+	if len(settings.Server) == 0 {
+		return game.Pop3Config{}, errors.New("no server set in pop3settings")
+	}
+
+	if len(settings.Username) == 0 {
+		return game.Pop3Config{}, errors.New("no username set in pop3settings")
+	}
+
+	password, err := m.ResolveSecret(settings.Secret(), "pop3settings")
+	if err != nil {
+		return game.Pop3Config{}, err
+	}
+
+	if len(password) == 0 {
+		return game.Pop3Config{}, errors.New("no password set in pop3settings")
+	}
+
+	return game.Pop3Config{Port: settings.Port, Server: settings.Server, Username: settings.Username, Password: password, From: settings.From, Delete: settings.Delete}, nil
+}
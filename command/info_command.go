@@ -0,0 +1,270 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type InfoCommand struct {
+	*Meta
+
+	GameName string
+	Json     bool
+}
+
+// GameInfo is everything d4t knows about a game
+type GameInfo struct {
+	Name      string       `json:"name"`
+	Directory string       `json:"directory"`
+	Nations   []NationInfo `json:"nations"`
+	Replays   []string     `json:"replays"`
+	Config    ConfigInfo   `json:"config"`
+}
+
+// NationInfo describes the files and backups of one nation in a game
+type NationInfo struct {
+	Stem          string    `json:"stem"`
+	Nation        string    `json:"nation,omitempty"`
+	NationId      int       `json:"nation_id,omitempty"`
+	Selected      bool      `json:"selected"`
+	Turn          int       `json:"turn"`
+	Trn           *FileInfo `json:"trn,omitempty"`
+	Twoh          *FileInfo `json:"2h,omitempty"`
+	BackedUpTurns []int     `json:"backed_up_turns"`
+	MissingTurns  []int     `json:"missing_turns"`
+	TrnOnlyTurns  []int     `json:"trn_only_turns"`
+	TwohOnlyTurns []int     `json:"2h_only_turns"`
+}
+
+// FileInfo describes a current trn or 2h file
+type FileInfo struct {
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Turn     int       `json:"turn,omitempty"`
+	Version  string    `json:"version,omitempty"`
+}
+
+// ConfigInfo is the part of the config that applies to a game
+type ConfigInfo struct {
+	Getstyle      string `json:"getstyle"`
+	Submitstyle   string `json:"submitstyle"`
+	Server        string `json:"server"`
+	To            string `json:"to"`
+	Account       string `json:"account,omitempty"`
+	From          string `json:"from"`
+	DefaultNation string `json:"default_nation,omitempty"`
+}
+
+// Shows everything we know about a game
+func (c *InfoCommand) run(*kingpin.ParseContext) error {
+	g, err := c.Meta.FindGame(c.GameName, "")
+	if err != nil {
+		return err
+	}
+
+	err = c.Meta.UseAccountFor(g.Name)
+	if err != nil {
+		return err
+	}
+
+	info, err := c.gameInfo(g)
+	if err != nil {
+		return err
+	}
+
+	if c.Json {
+		raw, err := json.MarshalIndent(info, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		// Bypass the prefixes and colors of the UI, this is meant for other programs
+		fmt.Fprintln(os.Stdout, string(raw))
+		return nil
+	}
+
+	c.printInfo(info)
+
+	return nil
+}
+
+func (c *InfoCommand) gameInfo(g *game.Game) (GameInfo, error) {
+	info := GameInfo{Name: g.Name, Directory: g.Directory, Nations: []NationInfo{}, Replays: []string{}}
+
+	for _, stem := range g.NationStems() {
+		nation := g.Nations[stem]
+
+		// Selecting works on a copy, so the turn number is the one this nation is on
+		nationGame := *g
+		err := nationGame.SelectNation(stem)
+		if err != nil {
+			return info, err
+		}
+
+		nationInfo := NationInfo{Stem: stem, Selected: stem == g.NationStem, Turn: nationGame.CurrentTurnNumber(), BackedUpTurns: nation.BackedUpTurns(), MissingTurns: nation.MissingTurns()}
+		nationInfo.TrnOnlyTurns, nationInfo.TwohOnlyTurns = nation.UnpairedTurns()
+
+		if known, ok := nation.Nation(); ok {
+			nationInfo.Nation = known.String()
+			nationInfo.NationId = known.Id
+		}
+
+		if nation.TrnFile.Fullpath != "" {
+			nationInfo.Trn = newFileInfo(nation.TrnFile.Filename, nation.TrnFile.Fullpath, nation.TrnFile.Header)
+		}
+
+		if nation.TwohFile.Fullpath != "" {
+			nationInfo.Twoh = newFileInfo(nation.TwohFile.Filename, nation.TwohFile.Fullpath, nation.TwohFile.Header)
+		}
+
+		info.Nations = append(info.Nations, nationInfo)
+	}
+
+	replays, err := game.LoadReplayManifest(g.ReplayManifestPath())
+	if err != nil {
+		return info, err
+	}
+
+	for _, record := range replays.Replays {
+		if _, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(record.Name); err == nil {
+			info.Replays = append(info.Replays, record.Name)
+		}
+	}
+
+	serverName, serverProfile, err := c.Meta.Config.ServerProfileFor(g.Name)
+	if err != nil {
+		return info, err
+	}
+
+	info.Config = ConfigInfo{
+		Getstyle:      c.Meta.Config.Getstyle,
+		Submitstyle:   c.Meta.Config.Submitstyle,
+		Server:        serverName,
+		To:            serverProfile.To,
+		Account:       c.Meta.Account(),
+		From:          c.Meta.Config.Smtpsettings.From,
+		DefaultNation: c.Meta.Config.GameSettings(g.Name).Nation,
+	}
+
+	return info, nil
+}
+
+// Size and modification time of a file, plus what its header says. Nil if the file doesn't exist.
+func newFileInfo(filename string, fullpath string, header *game.FileHeader) *FileInfo {
+	stat, err := os.Stat(fullpath)
+	if err != nil {
+		return nil
+	}
+
+	fileInfo := &FileInfo{Filename: filename, Size: stat.Size(), Modified: stat.ModTime()}
+
+	if header != nil {
+		fileInfo.Turn = header.TurnNumber
+		fileInfo.Version = header.VersionString()
+	}
+
+	return fileInfo
+}
+
+func (c *InfoCommand) printInfo(info GameInfo) {
+	c.Ui.Output(fmt.Sprintf("%v in %v", info.Name, info.Directory))
+
+	if len(info.Nations) == 0 {
+		c.Ui.Output("No trn or 2h files yet")
+	}
+
+	for _, nation := range info.Nations {
+		name := nation.Stem
+		if nation.Nation != "" {
+			name = fmt.Sprintf("%v (%v)", nation.Nation, nation.Stem)
+		}
+
+		if nation.Selected && len(info.Nations) > 1 {
+			name += ", selected"
+		}
+
+		c.Ui.Output(fmt.Sprintf("%v, turn %v", name, nation.Turn))
+
+		for _, file := range []*FileInfo{nation.Trn, nation.Twoh} {
+			if file == nil {
+				continue
+			}
+
+			line := fmt.Sprintf("    %v: %v bytes, modified %v", file.Filename, file.Size, file.Modified.Format(time.RFC822))
+			if file.Turn > 0 {
+				line += fmt.Sprintf(", turn %v, version %v", file.Turn, file.Version)
+			}
+
+			c.Ui.Output(line)
+		}
+
+		if len(nation.BackedUpTurns) == 0 {
+			c.Ui.Output("    No backups")
+		} else {
+			c.Ui.Output(fmt.Sprintf("    Backups: %v", joinTurns(nation.BackedUpTurns)))
+		}
+
+		if len(nation.MissingTurns) > 0 {
+			c.Ui.Warn(fmt.Sprintf("    No backups for turns %v", joinTurns(nation.MissingTurns)))
+		}
+
+		if len(nation.TrnOnlyTurns) > 0 {
+			c.Ui.Warn(fmt.Sprintf("    Only trn backed up for turns %v", joinTurns(nation.TrnOnlyTurns)))
+		}
+
+		if len(nation.TwohOnlyTurns) > 0 {
+			c.Ui.Warn(fmt.Sprintf("    Only 2h backed up for turns %v", joinTurns(nation.TwohOnlyTurns)))
+		}
+	}
+
+	if len(info.Replays) > 0 {
+		c.Ui.Output(fmt.Sprintf("Replays: %v", strings.Join(info.Replays, ", ")))
+	}
+
+	c.Ui.Output(fmt.Sprintf("Gets turns via %v, submits via %v to %v (%v)", info.Config.Getstyle, info.Config.Submitstyle, info.Config.Server, info.Config.To))
+
+	if info.Config.Account != "" {
+		c.Ui.Output(fmt.Sprintf("Uses account %v (%v)", info.Config.Account, info.Config.From))
+	} else {
+		c.Ui.Output(fmt.Sprintf("Sends from %v", info.Config.From))
+	}
+}
+
+// Example: 1, 2, 5
+func joinTurns(turns []int) string {
+	var parts []string
+
+	for _, turn := range turns {
+		parts = append(parts, fmt.Sprint(turn))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (c *InfoCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureInfoCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "info"
+	c := &InfoCommand{Meta: meta}
+	cmd := app.Command(commandName, "Show everything known about a game.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game").Required().StringVar(&c.GameName)
+		cmd.Flag("json", "print as JSON").BoolVar(&c.Json)
+	}
+
+	return commandName
+}
@@ -0,0 +1,75 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type LabelCommand struct {
+	*Meta
+
+	GameName   string
+	Nation     string
+	TurnNumber int
+	Label      string
+}
+
+// Show or set the label of a backed up turn. Use "none" to remove it.
+func (c *LabelCommand) run(*kingpin.ParseContext) error {
+	game, err := c.Meta.FindGame(c.GameName, c.Nation)
+	if err != nil {
+		return err
+	}
+
+	if c.Label == "" {
+		label := game.BackupLabel(c.TurnNumber)
+		if label == "" {
+			c.Ui.Output(fmt.Sprintf("Turn %v of %v has no label", c.TurnNumber, game.Name))
+		} else {
+			c.Ui.Output(label)
+		}
+
+		return nil
+	}
+
+	if strings.ToLower(c.Label) == "none" {
+		c.Label = ""
+	}
+
+	err = game.LabelBackup(c.TurnNumber, c.Label)
+	if err != nil {
+		return err
+	}
+
+	if c.Label == "" {
+		c.Ui.Output(fmt.Sprintf("Turn %v of %v has no label anymore", c.TurnNumber, game.Name))
+	} else {
+		c.Ui.Output(fmt.Sprintf("Labelled turn %v of %v as %v, pruning keeps it", c.TurnNumber, game.Name, c.Label))
+	}
+
+	return nil
+}
+
+func (c *LabelCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureLabelCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "label"
+	c := &LabelCommand{Meta: meta}
+	cmd := app.Command(commandName, "Show or set the label of a backed up turn. Labelled turns are never pruned.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game").Required().StringVar(&c.GameName)
+		cmd.Arg("turn_number", "Backed up turn").Required().IntVar(&c.TurnNumber)
+		cmd.Arg("label", "Label for the turn, none to remove it").StringVar(&c.Label)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+	}
+
+	return commandName
+}
@@ -1,20 +1,69 @@
 package command
 
-import "gopkg.in/alecthomas/kingpin.v2"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
 
 type ListCommand struct {
 	*Meta
+
+	// Only print the game names, e.g. for tab completion
+	NamesOnly bool
+	// Also list the replays d4t created
+	Replays bool
 }
 
-// Lists all games we can find for the current installations
+// Lists all games we can find for the current installations, with the nations played in each
 func (c *ListCommand) run(*kingpin.ParseContext) error {
+	replayNames := c.Meta.replayNames()
+
 	for _, game := range c.Meta.RunContext.GameInstallation.AvailableGames {
-		c.Ui.Output(game.Name)
+		if replayNames[strings.ToLower(game.Name)] && !c.Replays {
+			continue
+		}
+
+		var nations []string
+
+		for _, stem := range game.NationStems() {
+			if nation, ok := game.Nations[stem].Nation(); ok {
+				nations = append(nations, nation.String())
+			}
+		}
+
+		if len(nations) > 0 && !c.NamesOnly {
+			c.Ui.Output(fmt.Sprintf("%v - %v", game.Name, strings.Join(nations, ", ")))
+		} else {
+			c.Ui.Output(game.Name)
+		}
 	}
 
 	return nil
 }
 
+// Names of all replays and replay viewers any game recorded, lower case
+func (m *Meta) replayNames() map[string]bool {
+	names := make(map[string]bool)
+
+	for _, g := range m.RunContext.GameInstallation.AvailableGames {
+		replays, err := game.LoadReplayManifest(g.ReplayManifestPath())
+		if err != nil {
+			m.Ui.Warn(err.Error())
+			continue
+		}
+
+		for _, record := range replays.Replays {
+			names[strings.ToLower(record.Name)] = true
+		}
+	}
+
+	return names
+}
+
 func (c *ListCommand) completion(parseContext *kingpin.ParseContext) error {
 	return noCompletion()
 }
@@ -28,6 +77,7 @@ func ConfigureListCommand(app *kingpin.Application, meta *Meta) (commandName str
 		cmd.Action(c.completion)
 	} else {
 		cmd.Action(c.run)
+		cmd.Flag("replays", "also list replays").Short('r').BoolVar(&c.Replays)
 	}
 
 	return commandName
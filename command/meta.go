@@ -18,9 +18,14 @@ type Meta struct {
 	Color          bool
 	CompletionOnly bool
 	Config         ConfigStruct
-
-	oldUi cli.Ui
-	color bool
+	// Account profile given with --profile, overrides the one assigned to a game
+	Profile string
+
+	oldUi        cli.Ui
+	color        bool
+	secretStore  *SecretStore
+	loadedConfig *ConfigStruct
+	account      string
 }
 
 func (m *Meta) Process(args []string) ([]string, error) {
@@ -57,24 +62,26 @@ func (m *Meta) Process(args []string) ([]string, error) {
 		}
 	}
 
-	// Since we store sensitive information in the config file, including email passwords, make sure it's only readable by owner
-	configFileInfo, err := os.Stat(m.RunContext.BaseConfigurationPath)
+	// Load config from file (even if we just wrote it)
+	config, err := LoadConfigFrom(configPath)
 	if err != nil {
 		return args, err
 	}
 
-	// Don't bother with security on windows
-	if runtime.GOOS != "windows" && configFileInfo.Mode() != 0600 {
-		return args, errors.New(fmt.Sprintf("Permissions for %v were %v and not -rw-------. Please update (e.g. chmod 0600 %v) as sensitive information might be stored in the config.", m.RunContext.BaseConfigurationPath, configFileInfo.Mode(), m.RunContext.BaseConfigurationPath))
-	}
-
-	// Finally, load config from file (even if we just wrote it)
-	config, err := LoadConfigFrom(configPath)
+	// Passwords stored in the config itself mean it must only be readable by owner.
+	// Configs that get their passwords from elsewhere can be shared.
+	configFileInfo, err := os.Stat(m.RunContext.BaseConfigurationPath)
 	if err != nil {
 		return args, err
 	}
 
+	// Don't bother with security on windows
+	if runtime.GOOS != "windows" && config.HasPlainPasswords() && configFileInfo.Mode() != 0600 {
+		return args, errors.New(fmt.Sprintf("Permissions for %v were %v and not -rw-------. Please update (e.g. chmod 0600 %v) as passwords are stored in the config, or move them to password_command, password_env or password_secret.", m.RunContext.BaseConfigurationPath, configFileInfo.Mode(), m.RunContext.BaseConfigurationPath))
+	}
+
 	m.Config = config
+	m.loadedConfig = &config
 
 	err = context.Finalize()
 	if err != nil {
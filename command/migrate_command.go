@@ -0,0 +1,83 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type MigrateCommand struct {
+	*Meta
+
+	GameName string
+}
+
+// Move the backups next to the game files into archives, for one or all games
+func (c *MigrateCommand) run(*kingpin.ParseContext) error {
+	var games []*game.Game
+
+	if c.GameName != "" {
+		found, err := c.Meta.FindGame(c.GameName, "")
+		if err != nil {
+			return err
+		}
+
+		games = append(games, found)
+	} else {
+		allGames, err := c.Meta.AllGames()
+		if err != nil {
+			return err
+		}
+
+		games = allGames
+	}
+
+	for _, g := range games {
+		g, err := c.Meta.recoverLeftovers(g)
+		if err != nil {
+			return err
+		}
+
+		// Without archive settings, archives go to the game's .d4t directory
+		if g.BackupStore == "" {
+			err := g.UseBackupStore(g.DefaultBackupStore())
+			if err != nil {
+				return err
+			}
+		}
+
+		migrated, err := g.MigrateBackups()
+		if err != nil {
+			return err
+		}
+
+		if len(migrated) == 0 {
+			c.Ui.Output(fmt.Sprintf("%v: Nothing to migrate", g.Name))
+		} else {
+			c.Ui.Output(fmt.Sprintf("%v: Archived %v backups in %v", g.Name, len(migrated), g.BackupStore))
+		}
+	}
+
+	return nil
+}
+
+func (c *MigrateCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureMigrateCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "migrate"
+	c := &MigrateCommand{Meta: meta}
+	cmd := app.Command(commandName, "Move backups from next to the game files into compressed archives.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game to migrate, all games if not given").StringVar(&c.GameName)
+	}
+
+	return commandName
+}
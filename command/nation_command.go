@@ -0,0 +1,96 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type NationCommand struct {
+	*Meta
+
+	GameName   string
+	NationName string
+}
+
+// Show the nations in a game, or set the default nation for it.
+// Use "none" to go back to detecting the nation.
+func (c *NationCommand) run(*kingpin.ParseContext) error {
+	game, err := c.Meta.FindGame(c.GameName, "")
+	if err != nil {
+		return err
+	}
+
+	if c.NationName == "" {
+		stems := game.NationStems()
+		if len(stems) == 0 {
+			c.Ui.Output(fmt.Sprintf("%v has no trn or 2h files yet", game.Name))
+			return nil
+		}
+
+		for _, stem := range stems {
+			nation := game.Nations[stem]
+
+			line := fmt.Sprintf("%v: %v, %v backups", stem, nation.DisplayName(), len(nation.SortedTrnBackupKeys))
+			if stem == game.NationStem {
+				line += " (selected)"
+			}
+
+			c.Ui.Output(line)
+		}
+
+		return nil
+	}
+
+	settings := c.Meta.Config.GameSettings(game.Name)
+
+	if strings.ToLower(c.NationName) == "none" {
+		settings.Nation = ""
+	} else {
+		nation, err := game.FindNation(c.NationName)
+		if err != nil {
+			return err
+		}
+
+		settings.Nation = nation.Stem
+	}
+
+	if c.Meta.Config.Games == nil {
+		c.Meta.Config.Games = make(map[string]Gamesettings)
+	}
+	c.Meta.Config.Games[strings.ToLower(game.Name)] = settings
+
+	err = WriteConfigTo(c.Meta.Config, c.Meta.RunContext.BaseConfigurationPath)
+	if err != nil {
+		return err
+	}
+
+	if settings.Nation == "" {
+		c.Ui.Output(fmt.Sprintf("%v has no default nation anymore", game.Name))
+	} else {
+		c.Ui.Output(fmt.Sprintf("%v now defaults to %v", game.Name, settings.Nation))
+	}
+
+	return nil
+}
+
+func (c *NationCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureNationCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "nation"
+	c := &NationCommand{Meta: meta}
+	cmd := app.Command(commandName, "Show the nations in a game, or set the nation commands use by default.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game").Required().StringVar(&c.GameName)
+		cmd.Arg("nation", "Nation to use by default, none to detect it").StringVar(&c.NationName)
+	}
+
+	return commandName
+}
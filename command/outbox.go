@@ -0,0 +1,294 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Retries of queued submissions start after this long, and double with every failed attempt
+const OutboxInitialBackoff = time.Minute
+
+// Retries are never further apart than this
+const OutboxMaxBackoff = 4 * time.Hour
+
+// Outbox is a directory of submissions waiting to be sent.
+// Every entry is a complete RFC 5322 message (ID.eml) and its metadata (ID.json).
+type Outbox struct {
+	Path string
+}
+
+// OutboxEntry is the metadata of a queued submission
+type OutboxEntry struct {
+	Id          string         `json:"id"`
+	Submission  TurnSubmission `json:"submission"`
+	TwohHash    string         `json:"twoh_hash"`
+	Queued      time.Time      `json:"queued"`
+	Attempts    int            `json:"attempts"`
+	NextAttempt time.Time      `json:"next_attempt"`
+	LastError   string         `json:"last_error,omitempty"`
+}
+
+// The path of the outbox, next to the config
+func (m *Meta) OutboxPath() string {
+	return filepath.Join(filepath.Dir(m.RunContext.BaseConfigurationPath), "outbox")
+}
+
+// Is the error one we can expect to go away by trying again later, like being offline or a 4xx SMTP reply?
+func IsTemporarySubmitError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 400 && smtpErr.Code < 500
+}
+
+// Queue a submission. Replaces anything already queued for the same game, turn and nation.
+func (outbox *Outbox) Enqueue(submission TurnSubmission, lastError error) (OutboxEntry, error) {
+	err := outbox.DropSubmission(submission)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+
+	now := time.Now()
+	entry := OutboxEntry{
+		Id:          fmt.Sprintf("%d-%s-%d", now.UnixNano(), submission.GameName, submission.TurnNumber),
+		Submission:  submission,
+		Queued:      now,
+		NextAttempt: now,
+	}
+
+	if lastError != nil {
+		entry.Attempts = 1
+		entry.LastError = lastError.Error()
+		entry.NextAttempt = now.Add(OutboxBackoff(entry.Attempts))
+	}
+
+	err = os.MkdirAll(outbox.Path, 0700)
+	if err != nil {
+		return entry, err
+	}
+
+	err = outbox.writeMessage(&entry)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, outbox.writeEntry(entry)
+}
+
+// All queued entries, oldest first
+func (outbox *Outbox) Entries() ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+
+	files, err := ioutil.ReadDir(outbox.Path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		raw, err := ioutil.ReadFile(filepath.Join(outbox.Path, f.Name()))
+		if err != nil {
+			return entries, err
+		}
+
+		var entry OutboxEntry
+		err = json.Unmarshal(raw, &entry)
+		if err != nil {
+			return entries, errors.New(fmt.Sprintf("Broken outbox entry %v: %v", f.Name(), err.Error()))
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Queued.Before(entries[j].Queued) })
+
+	return entries, nil
+}
+
+// Remove an entry without sending it
+func (outbox *Outbox) Drop(id string) error {
+	metadataPath := filepath.Join(outbox.Path, id+".json")
+	if !utility.FileExists(metadataPath) {
+		return errors.New(fmt.Sprintf("No entry %v in outbox", id))
+	}
+
+	err := os.Remove(filepath.Join(outbox.Path, id+".eml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Remove(metadataPath)
+}
+
+// Remove everything queued for the same game, turn and nation as the submission
+func (outbox *Outbox) DropSubmission(submission TurnSubmission) error {
+	entries, err := outbox.Entries()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.ToLower(entry.Submission.GameName) == strings.ToLower(submission.GameName) && entry.Submission.TurnNumber == submission.TurnNumber && entry.Submission.AttachmentPath == submission.AttachmentPath {
+			err = outbox.Drop(entry.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Try to send all entries that are due, or all entries if force is set.
+// submitterFor creates the submitter for the account profile of an entry.
+// Returns the entries that were sent and the ones that failed again.
+func (outbox *Outbox) Flush(submitterFor func(account string) (RawSubmitter, error), force bool) ([]OutboxEntry, []OutboxEntry, error) {
+	var sent, failed []OutboxEntry
+	submitters := make(map[string]RawSubmitter)
+
+	entries, err := outbox.Entries()
+	if err != nil {
+		return sent, failed, err
+	}
+
+	now := time.Now()
+
+	for _, entry := range entries {
+		if !force && entry.NextAttempt.After(now) {
+			continue
+		}
+
+		submitter, ok := submitters[entry.Submission.Account]
+		if !ok {
+			submitter, err = submitterFor(entry.Submission.Account)
+			if err != nil {
+				return sent, failed, err
+			}
+
+			submitters[entry.Submission.Account] = submitter
+		}
+
+		err = outbox.refresh(&entry)
+		if err != nil {
+			return sent, failed, err
+		}
+
+		message, err := ioutil.ReadFile(filepath.Join(outbox.Path, entry.Id+".eml"))
+		if err != nil {
+			return sent, failed, err
+		}
+
+		err = submitter.SubmitRaw(entry.Submission.From, entry.Submission.To, bytes.NewReader(message))
+		if err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = time.Now().Add(OutboxBackoff(entry.Attempts))
+
+			failed = append(failed, entry)
+
+			err = outbox.writeEntry(entry)
+			if err != nil {
+				return sent, failed, err
+			}
+
+			continue
+		}
+
+		sent = append(sent, entry)
+
+		err = outbox.Drop(entry.Id)
+		if err != nil {
+			return sent, failed, err
+		}
+	}
+
+	return sent, failed, nil
+}
+
+// How long to wait before the next attempt, after the given number of failed attempts
+func OutboxBackoff(attempts int) time.Duration {
+	backoff := OutboxInitialBackoff
+
+	for i := 1; i < attempts && backoff < OutboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > OutboxMaxBackoff {
+		return OutboxMaxBackoff
+	}
+
+	return backoff
+}
+
+// Rebuild the queued message before sending it, so its Date is when it's actually sent.
+// If the 2h file changed since it was queued, the message carries the newer orders, so we never send stale ones.
+func (outbox *Outbox) refresh(entry *OutboxEntry) error {
+	currentHash, err := utility.Sha256File(entry.Submission.AttachmentPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can't read %v for queued submission %v: %v", entry.Submission.AttachmentPath, entry.Id, err.Error()))
+	}
+
+	// It's a different mail now, so it gets a new Message-ID
+	if currentHash != entry.TwohHash {
+		entry.Submission.MessageId = NewMessageId(entry.Submission.From)
+	}
+
+	err = outbox.writeMessage(entry)
+	if err != nil {
+		return err
+	}
+
+	return outbox.writeEntry(*entry)
+}
+
+// Write the complete message for an entry, and remember which 2h file it contains
+func (outbox *Outbox) writeMessage(entry *OutboxEntry) error {
+	if entry.Submission.MessageId == "" {
+		entry.Submission.MessageId = NewMessageId(entry.Submission.From)
+	}
+
+	hash, err := utility.Sha256File(entry.Submission.AttachmentPath)
+	if err != nil {
+		return err
+	}
+
+	var message bytes.Buffer
+	_, err = entry.Submission.Message().WriteTo(&message)
+	if err != nil {
+		return err
+	}
+
+	entry.TwohHash = hash
+
+	return ioutil.WriteFile(filepath.Join(outbox.Path, entry.Id+".eml"), message.Bytes(), 0600)
+}
+
+func (outbox *Outbox) writeEntry(entry OutboxEntry) error {
+	raw, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(outbox.Path, entry.Id+".json"), raw, 0600)
+}
@@ -0,0 +1,136 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type OutboxCommand struct {
+	*Meta
+
+	Id    string
+	Force bool
+	Wait  bool
+}
+
+// List all queued submissions
+func (c *OutboxCommand) list(*kingpin.ParseContext) error {
+	outbox := Outbox{Path: c.Meta.OutboxPath()}
+
+	entries, err := outbox.Entries()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		c.Ui.Output("Outbox is empty")
+		return nil
+	}
+
+	for _, entry := range entries {
+		c.Ui.Output(fmt.Sprintf("%v: %v turn %v to %v, queued %v, %v attempts, next attempt %v", entry.Id, entry.Submission.GameName, entry.Submission.TurnNumber, entry.Submission.To, entry.Queued.Format(time.RFC822), entry.Attempts, entry.NextAttempt.Format(time.RFC822)))
+
+		if entry.LastError != "" {
+			c.Ui.Output(fmt.Sprintf("    last error: %v", entry.LastError))
+		}
+	}
+
+	return nil
+}
+
+// Send queued submissions that are due, or all of them with --force.
+// With --wait, keep retrying until the outbox is empty.
+func (c *OutboxCommand) flush(*kingpin.ParseContext) error {
+	outbox := Outbox{Path: c.Meta.OutboxPath()}
+	submissionLog := SubmissionLog{Path: c.Meta.SubmissionLogPath()}
+	force := c.Force
+
+	for {
+		sent, failed, err := outbox.Flush(c.Meta.RawSubmitterFor, force)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range sent {
+			c.Ui.Output(fmt.Sprintf("Sent %v turn %v", entry.Submission.GameName, entry.Submission.TurnNumber))
+
+			_, err = submissionLog.Record(entry.Submission)
+			if err != nil {
+				c.Ui.Warn(fmt.Sprintf("Could not record submission: %v", err.Error()))
+			}
+		}
+
+		for _, entry := range failed {
+			c.Ui.Error(fmt.Sprintf("Could not send %v turn %v: %v", entry.Submission.GameName, entry.Submission.TurnNumber, entry.LastError))
+		}
+
+		entries, err := outbox.Entries()
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 || !c.Wait {
+			if len(entries) > 0 {
+				c.Ui.Output(fmt.Sprintf("%v submissions left in outbox", len(entries)))
+			}
+
+			return nil
+		}
+
+		// Sleep until the next entry is due
+		nextAttempt := entries[0].NextAttempt
+		for _, entry := range entries {
+			if entry.NextAttempt.Before(nextAttempt) {
+				nextAttempt = entry.NextAttempt
+			}
+		}
+
+		c.Ui.Output(fmt.Sprintf("Retrying at %v", nextAttempt.Format(time.Kitchen)))
+		time.Sleep(nextAttempt.Sub(time.Now()))
+		force = false
+	}
+}
+
+// Remove a queued submission without sending it
+func (c *OutboxCommand) drop(*kingpin.ParseContext) error {
+	outbox := Outbox{Path: c.Meta.OutboxPath()}
+
+	err := outbox.Drop(c.Id)
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("Dropped %v", c.Id))
+
+	return nil
+}
+
+func (c *OutboxCommand) completion(parseContext *kingpin.ParseContext) error {
+	return noCompletion()
+}
+
+func ConfigureOutboxCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "outbox"
+	c := &OutboxCommand{Meta: meta}
+	cmd := app.Command(commandName, "Manage submissions that are waiting to be sent.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		listCmd := cmd.Command("list", "List queued submissions.")
+		listCmd.Action(c.list)
+
+		flushCmd := cmd.Command("flush", "Send queued submissions that are due for another attempt.")
+		flushCmd.Flag("force", "send all queued submissions, even if they are not due yet").Short('f').BoolVar(&c.Force)
+		flushCmd.Flag("wait", "keep retrying until the outbox is empty").Short('w').BoolVar(&c.Wait)
+		flushCmd.Action(c.flush)
+
+		dropCmd := cmd.Command("drop", "Remove a queued submission without sending it.")
+		dropCmd.Arg("id", "Id of the queued submission, see d4t outbox list").Required().StringVar(&c.Id)
+		dropCmd.Action(c.drop)
+	}
+
+	return commandName
+}
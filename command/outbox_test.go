@@ -0,0 +1,193 @@
+package command
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records raw messages instead of sending them, failing while err is set
+type fakeRawSubmitter struct {
+	err      error
+	messages []string
+}
+
+func (s *fakeRawSubmitter) Submit(submission TurnSubmission) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	s.messages = append(s.messages, submission.Subject)
+
+	return nil
+}
+
+func (s *fakeRawSubmitter) SubmitRaw(from string, to string, message io.WriterTo) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	var raw strings.Builder
+	_, err := message.WriteTo(&raw)
+	s.messages = append(s.messages, raw.String())
+
+	return err
+}
+
+// Hands out the same submitter for every account profile
+func (s *fakeRawSubmitter) forAccount(account string) (RawSubmitter, error) {
+	return s, nil
+}
+
+func TestOutboxEnqueue(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+	submission := testSubmission(t)
+
+	entry, err := outbox.Enqueue(submission, nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, entry.Submission.MessageId)
+	assert.Equal(t, 0, entry.Attempts)
+
+	message, err := ioutil.ReadFile(filepath.Join(outbox.Path, entry.Id+".eml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(message), "Subject: testgame turn 7")
+	assert.Contains(t, string(message), entry.Submission.MessageId)
+
+	// Queueing the same turn again replaces the old entry
+	_, err = outbox.Enqueue(submission, &net.OpError{Op: "dial", Err: errors.New("network is unreachable")})
+	assert.NoError(t, err)
+
+	entries, err := outbox.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.True(t, entries[0].NextAttempt.After(time.Now()))
+}
+
+func TestOutboxFlush(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+	submitter := &fakeRawSubmitter{err: &net.OpError{Op: "dial", Err: errors.New("network is unreachable")}}
+
+	_, err := outbox.Enqueue(testSubmission(t), nil)
+	assert.NoError(t, err)
+
+	sent, failed, err := outbox.Flush(submitter.forAccount, false)
+	assert.NoError(t, err)
+	assert.Empty(t, sent)
+	assert.Len(t, failed, 1)
+
+	// Not due yet
+	submitter.err = nil
+	sent, failed, err = outbox.Flush(submitter.forAccount, false)
+	assert.NoError(t, err)
+	assert.Empty(t, sent)
+	assert.Empty(t, failed)
+
+	sent, _, err = outbox.Flush(submitter.forAccount, true)
+	assert.NoError(t, err)
+	assert.Len(t, sent, 1)
+	assert.Len(t, submitter.messages, 1)
+
+	entries, err := outbox.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOutboxFlushPicksUpNewerOrders(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+	submitter := &fakeRawSubmitter{}
+	submission := testSubmission(t)
+
+	entry, err := outbox.Enqueue(submission, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(submission.AttachmentPath, []byte("better orders"), 0644))
+
+	sent, _, err := outbox.Flush(submitter.forAccount, false)
+	assert.NoError(t, err)
+	assert.Len(t, sent, 1)
+	assert.NotEqual(t, entry.Submission.MessageId, sent[0].Submission.MessageId)
+	assert.NotEqual(t, entry.TwohHash, sent[0].TwohHash)
+	assert.Contains(t, submitter.messages[0], sent[0].Submission.MessageId)
+}
+
+func TestOutboxFlushDatesMessagesWhenSent(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+	submitter := &fakeRawSubmitter{}
+
+	entry, err := outbox.Enqueue(testSubmission(t), nil)
+	assert.NoError(t, err)
+
+	// As if it had waited in the outbox since then
+	messagePath := filepath.Join(outbox.Path, entry.Id+".eml")
+	message, err := ioutil.ReadFile(messagePath)
+	assert.NoError(t, err)
+	assert.Regexp(t, `(?m)^Date: `, string(message))
+	stale := regexp.MustCompile(`(?m)^Date: .*$`).ReplaceAll(message, []byte("Date: Sat, 01 Jan 2000 00:00:00 +0000\r"))
+	assert.NoError(t, ioutil.WriteFile(messagePath, stale, 0600))
+
+	sent, _, err := outbox.Flush(submitter.forAccount, false)
+	assert.NoError(t, err)
+	assert.Len(t, sent, 1)
+	assert.NotContains(t, submitter.messages[0], "2000")
+	assert.Contains(t, submitter.messages[0], "Date: "+time.Now().Format("Mon, 02 Jan 2006"))
+	assert.Contains(t, submitter.messages[0], entry.Submission.MessageId)
+}
+
+func TestOutboxDrop(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+
+	entry, err := outbox.Enqueue(testSubmission(t), nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, outbox.Drop(entry.Id))
+	assert.Error(t, outbox.Drop(entry.Id))
+
+	entries, err := outbox.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSubmitDropsQueuedCopies(t *testing.T) {
+	outbox := Outbox{Path: testDirectory(t)}
+	submitter := &fakeRawSubmitter{}
+	submission := testSubmission(t)
+
+	_, err := outbox.Enqueue(submission, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, submitter.Submit(submission))
+
+	c := SubmitCommand{Meta: &Meta{Ui: cli.NewMockUi()}, Submission: submission}
+	c.flushOutbox(outbox, submitter.forAccount, SubmissionLog{Path: filepath.Join(testDirectory(t), "submissions.json")})
+
+	assert.Len(t, submitter.messages, 1)
+
+	entries, err := outbox.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, OutboxBackoff(1))
+	assert.Equal(t, 2*time.Minute, OutboxBackoff(2))
+	assert.Equal(t, 8*time.Minute, OutboxBackoff(4))
+	assert.Equal(t, OutboxMaxBackoff, OutboxBackoff(50))
+}
+
+func TestIsTemporarySubmitError(t *testing.T) {
+	assert.True(t, IsTemporarySubmitError(&net.OpError{Op: "dial", Err: errors.New("network is unreachable")}))
+	assert.True(t, IsTemporarySubmitError(&textproto.Error{Code: 451, Msg: "try again later"}))
+	assert.False(t, IsTemporarySubmitError(&textproto.Error{Code: 535, Msg: "authentication failed"}))
+	assert.False(t, IsTemporarySubmitError(errors.New("no 2h file")))
+}
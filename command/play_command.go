@@ -0,0 +1,261 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// PlayTemplateData is available in the args of the play settings
+type PlayTemplateData struct {
+	Game string
+	// Directory of the game
+	Directory string
+	// File name of the 2h without extension, e.g. early_agartha
+	Nation string
+}
+
+type PlayCommand struct {
+	*Meta
+
+	GameName string
+	Nation   string
+	Get      bool
+	// Submit without asking
+	Yes bool
+	// Also submit orders that look stale or were already submitted, see SubmitCommand.Yes
+	SubmitStale bool
+}
+
+// Get the turn if asked to, play it, and back up and submit the orders afterwards
+func (c *PlayCommand) run(parseContext *kingpin.ParseContext) error {
+	g, err := c.Meta.FindGame(c.GameName, c.Nation)
+	if err != nil {
+		return err
+	}
+
+	if c.Get {
+		getCommand := GetCommand{Meta: c.Meta, Game: g}
+		err = getCommand.run(parseContext)
+		if err != nil {
+			return err
+		}
+
+		// The new turn isn't in the files we read before
+		g, err = c.Meta.reloadGame(g)
+		if err != nil {
+			return err
+		}
+	}
+
+	executable, err := c.Meta.Dominions4Executable()
+	if err != nil {
+		return err
+	}
+
+	args, err := c.Meta.Config.PlayArgs(g)
+	if err != nil {
+		return err
+	}
+
+	before, err := g.OrdersSnapshot()
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("Playing %v, submit happens when Dominions 4 exits", g.Name))
+
+	err = launch(executable, args)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Running %v failed: %v", executable, err.Error()))
+	}
+
+	changed, err := before.Changed()
+	if err != nil {
+		return err
+	}
+
+	if !changed {
+		c.Ui.Output(fmt.Sprintf("%v wasn't saved, nothing to submit", filepath.Base(before.Fullpath)))
+		return nil
+	}
+
+	g, err = c.Meta.reloadGame(g)
+	if err != nil {
+		return err
+	}
+
+	turnNumber, ok := g.HeaderTurnNumber()
+	if !ok {
+		turnNumber = g.CurrentTurnNumber()
+		c.Ui.Warn(fmt.Sprintf("Can't read the turn number from the files of %v, going by the backups it's turn %v", g.Name, turnNumber))
+	}
+
+	submit := c.Yes
+	if !submit {
+		submit, err = c.confirm(fmt.Sprintf("Back up and submit the orders for %v? [y/N]", g.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	if submit {
+		submitCommand := SubmitCommand{Meta: c.Meta, Game: g, TurnNumber: turnNumber, Yes: c.SubmitStale}
+		return submitCommand.run(parseContext)
+	}
+
+	backup, err := c.confirm("Back up the orders without submitting? [y/N]")
+	if err != nil || !backup {
+		return err
+	}
+
+	// The existing backup might hold the orders the player wants to keep
+	_, twohBackedUp := g.TwohBackups[turnNumber]
+	_, trnBackedUp := g.TrnBackups[turnNumber]
+	force := false
+
+	if twohBackedUp || trnBackedUp {
+		force, err = c.confirm(fmt.Sprintf("Turn %v of %v is already backed up, replace the backup? [y/N]", turnNumber, g.Name))
+		if err != nil || !force {
+			return err
+		}
+	}
+
+	backupCommand := BackupCommand{Meta: c.Meta, Game: g, TurnNumber: turnNumber, Force: force}
+
+	return backupCommand.run(parseContext)
+}
+
+func (c *PlayCommand) confirm(question string) (bool, error) {
+	answer, err := c.Ui.Ask(question)
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes", nil
+}
+
+// Run Dominions 4 from its own directory, where it expects its data, and wait for it to exit
+func launch(executable string, args []string) error {
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = filepath.Dir(executable)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// The configured Dominions 4 executable, or the one found in the install directory
+func (m *Meta) Dominions4Executable() (string, error) {
+	settings := Playsettings{}
+	if m.Config.Play != nil {
+		settings = *m.Config.Play
+	}
+
+	if settings.Executable != "" {
+		return homedir.Expand(settings.Executable)
+	}
+
+	directories := defaultInstallDirectories()
+
+	if settings.Installdir != "" {
+		installdir, err := homedir.Expand(settings.Installdir)
+		if err != nil {
+			return "", err
+		}
+
+		directories = []string{installdir}
+	}
+
+	return game.FindExecutable(directories)
+}
+
+// Fill in the args templates of the play settings for a game.
+// There is no default, how to make Dominions 4 load a game depends on its version and has to be configured.
+func (config ConfigStruct) PlayArgs(g *game.Game) ([]string, error) {
+	if config.Play == nil || len(config.Play.Args) == 0 {
+		return nil, errors.New("No play args configured, set args in the play settings to what makes your Dominions 4 load a game, {{.Game}} is the name of the game")
+	}
+
+	templates := config.Play.Args
+
+	data := PlayTemplateData{Game: g.Name, Directory: g.Directory, Nation: g.NationStem}
+
+	var args []string
+
+	for _, text := range templates {
+		tmpl, err := template.New("args").Parse(text)
+		if err != nil {
+			return args, errors.New(fmt.Sprintf("Invalid play args %v: %v", text, err.Error()))
+		}
+
+		var arg bytes.Buffer
+		err = tmpl.Execute(&arg, data)
+		if err != nil {
+			return args, err
+		}
+
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// Where Dominions 4 is usually installed, mostly by Steam
+func defaultInstallDirectories() []string {
+	steamDirectory := filepath.Join("steamapps", "common", "Dominions4")
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			filepath.Join(os.Getenv("ProgramFiles(x86)"), "Steam", steamDirectory),
+			filepath.Join(os.Getenv("ProgramFiles"), "Steam", steamDirectory),
+			filepath.Join(os.Getenv("ProgramFiles(x86)"), "Dominions4"),
+			filepath.Join(os.Getenv("ProgramFiles"), "Dominions4"),
+		}
+	case "darwin":
+		home, _ := homedir.Dir()
+		return []string{filepath.Join(home, "Library", "Application Support", "Steam", steamDirectory), "/Applications"}
+	}
+
+	home, _ := homedir.Dir()
+
+	return []string{filepath.Join(home, ".steam", "steam", steamDirectory), filepath.Join(home, ".local", "share", "Steam", steamDirectory), filepath.Join(home, "dominions4")}
+}
+
+func (c *PlayCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigurePlayCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "play"
+	c := &PlayCommand{Meta: meta}
+	cmd := app.Command(commandName, "Starts Dominions 4 on a game, then backs up and submits the orders when it exits.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game to play").Required().StringVar(&c.GameName)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+		cmd.Flag("get", "get the new turn first").Short('g').BoolVar(&c.Get)
+		cmd.Flag("yes", "submit without asking").Short('y').BoolVar(&c.Yes)
+		cmd.Flag("submit-stale", "submit even if the orders look stale or were already submitted").BoolVar(&c.SubmitStale)
+	}
+
+	return commandName
+}
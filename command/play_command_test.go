@@ -0,0 +1,82 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayArgs(t *testing.T) {
+	g := &game.Game{Name: "testgame", Directory: "/saves/testgame", NationStem: "early_ulm"}
+
+	_, err := ConfigStruct{}.PlayArgs(g)
+	assert.Error(t, err)
+
+	_, err = ConfigStruct{Play: &Playsettings{Executable: "dom4"}}.PlayArgs(g)
+	assert.Error(t, err)
+
+	args, err := ConfigStruct{Play: &Playsettings{Args: []string{"--nosteam", "--loadgame={{.Game}}"}}}.PlayArgs(g)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--nosteam", "--loadgame=testgame"}, args)
+
+	_, err = ConfigStruct{Play: &Playsettings{Args: []string{"{{.Game"}}}.PlayArgs(g)
+	assert.Error(t, err)
+}
+
+// A game whose "Dominions 4" saves orders that were already submitted
+func testPlayMeta(t *testing.T) *Meta {
+	basePath := testDirectory(t)
+	gameDirectory := filepath.Join(basePath, "savedgames", "testgame")
+	assert.NoError(t, os.MkdirAll(gameDirectory, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, "early_ulm.trn"), []byte("turn"), 0644))
+
+	executable := filepath.Join(basePath, "dom4.sh")
+	assert.NoError(t, ioutil.WriteFile(executable, []byte("#!/bin/sh\nprintf orders > \"$1/early_ulm.2h\"\n"), 0755))
+
+	submitted := filepath.Join(basePath, "submitted.2h")
+	assert.NoError(t, ioutil.WriteFile(submitted, []byte("orders"), 0644))
+
+	meta := &Meta{
+		Ui: cli.NewMockUi(),
+		Config: ConfigStruct{
+			Submitstyle:     "command",
+			Commandsettings: Commandsettings{Command: "true"},
+			Play:            &Playsettings{Executable: executable, Args: []string{"{{.Directory}}"}},
+		},
+		RunContext: &RunContext{BaseConfigurationPath: filepath.Join(basePath, "config.json"), GameInstallation: *game.NewGameInstallation(basePath)},
+	}
+
+	submissionLog := SubmissionLog{Path: meta.SubmissionLogPath()}
+	_, err := submissionLog.Record(TurnSubmission{GameName: "testgame", TurnNumber: 1, AttachmentPath: submitted})
+	assert.NoError(t, err)
+
+	return meta
+}
+
+func TestPlayYesStillConfirmsStaleOrders(t *testing.T) {
+	meta := testPlayMeta(t)
+	ui := meta.Ui.(*cli.MockUi)
+	ui.InputReader = strings.NewReader("n\n")
+
+	c := PlayCommand{Meta: meta, GameName: "testgame", Yes: true}
+	assert.EqualError(t, c.run(nil), "Not submitting")
+	assert.Contains(t, ui.ErrorWriter.String(), "These orders were already submitted for turn 1")
+	assert.Contains(t, ui.OutputWriter.String(), "Submit anyway?")
+}
+
+func TestPlaySubmitStale(t *testing.T) {
+	meta := testPlayMeta(t)
+	ui := meta.Ui.(*cli.MockUi)
+
+	c := PlayCommand{Meta: meta, GameName: "testgame", Yes: true, SubmitStale: true}
+	assert.NoError(t, c.run(nil))
+	assert.Contains(t, ui.ErrorWriter.String(), "These orders were already submitted for turn 1")
+	assert.NotContains(t, ui.OutputWriter.String(), "Submit anyway?")
+	assert.Contains(t, ui.OutputWriter.String(), "Submitting game testgame")
+}
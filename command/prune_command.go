@@ -0,0 +1,107 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type PruneCommand struct {
+	*Meta
+
+	GameName string
+	DryRun   bool
+}
+
+// Delete the backups the retention policy doesn't keep, for one or all games
+func (c *PruneCommand) run(*kingpin.ParseContext) error {
+	var games []*game.Game
+
+	if c.GameName != "" {
+		found, err := c.Meta.FindGame(c.GameName, "")
+		if err != nil {
+			return err
+		}
+
+		if !c.Meta.Config.RetentionFor(found.Name).Policy().Enabled() {
+			return errors.New(fmt.Sprintf("No retention policy for %v, set keep_last in the retention settings", found.Name))
+		}
+
+		games = append(games, found)
+	} else {
+		allGames, err := c.Meta.AllGames()
+		if err != nil {
+			return err
+		}
+
+		for _, g := range allGames {
+			if c.Meta.Config.RetentionFor(g.Name).Policy().Enabled() {
+				games = append(games, g)
+			}
+		}
+	}
+
+	for _, g := range games {
+		if !c.DryRun {
+			var err error
+			g, err = c.Meta.recoverLeftovers(g)
+			if err != nil {
+				return err
+			}
+		}
+
+		plan, err := c.Meta.PruneGame(g, c.DryRun)
+		if err != nil {
+			return err
+		}
+
+		c.printPlan(g, plan)
+	}
+
+	return nil
+}
+
+func (c *PruneCommand) printPlan(g *game.Game, plan game.PrunePlan) {
+	verb := "Deleted"
+	if c.DryRun {
+		verb = "Would delete"
+	}
+
+	for _, fullpath := range plan.Delete {
+		c.Ui.Output(fmt.Sprintf("%v: %v %v", g.Name, verb, filepath.Base(fullpath)))
+	}
+
+	for _, stem := range g.NationStems() {
+		if turns, ok := plan.OnlyCopy[stem]; ok {
+			c.Ui.Warn(fmt.Sprintf("%v: Kept %v turns %v, there is no replay for them", g.Name, stem, joinTurns(turns)))
+		}
+	}
+
+	if len(plan.Delete) == 0 {
+		c.Ui.Output(fmt.Sprintf("%v: Nothing to prune", g.Name))
+	}
+}
+
+func (c *PruneCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigurePruneCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "prune"
+	c := &PruneCommand{Meta: meta}
+	cmd := app.Command(commandName, "Delete old backups according to the retention settings.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game to prune, all games with retention settings if not given").StringVar(&c.GameName)
+		cmd.Flag("dry-run", "only show what would be deleted").Short('n').BoolVar(&c.DryRun)
+	}
+
+	return commandName
+}
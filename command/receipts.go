@@ -0,0 +1,290 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+const (
+	ReceiptPending   = "pending"
+	ReceiptConfirmed = "confirmed"
+	ReceiptFailed    = "failed"
+)
+
+// How often to check for receipts while waiting for one
+const ReceiptPollInterval = 30 * time.Second
+
+// Receipts older than the submission by more than this are not considered, to allow for clock skew
+const receiptClockSkew = 5 * time.Minute
+
+// Subjects of the mails servers send when they received a turn, e.g. "Received turn for foo"
+var receiptSubjectPattern = regexp.MustCompile(`(?i)\b(received|receipt|accepted|acknowledged)\b`)
+
+// SubmissionLog is a file recording every submission we handed off, and whether the server confirmed it
+type SubmissionLog struct {
+	Path string
+}
+
+// SubmissionRecord is a single submission in the log
+type SubmissionRecord struct {
+	MessageId  string    `json:"message_id"`
+	Account    string    `json:"account,omitempty"`
+	GameName   string    `json:"game"`
+	TurnNumber int       `json:"turn"`
+	To         string    `json:"to"`
+	TwohHash   string    `json:"twoh_hash,omitempty"`
+	Submitted  time.Time `json:"submitted"`
+	Status     string    `json:"status"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// The path of the submission log, next to the config
+func (m *Meta) SubmissionLogPath() string {
+	return filepath.Join(filepath.Dir(m.RunContext.BaseConfigurationPath), "submissions.json")
+}
+
+// Remember a submission that was just handed off, so we can later match the server's receipt
+func (log *SubmissionLog) Record(submission TurnSubmission) (SubmissionRecord, error) {
+	record := SubmissionRecord{MessageId: submission.MessageId, Account: submission.Account, GameName: submission.GameName, TurnNumber: submission.TurnNumber, To: submission.To, Submitted: time.Now(), Status: ReceiptPending}
+
+	// Only used to warn about submitting the same orders twice, so it's fine if the file is gone by now
+	record.TwohHash, _ = utility.Sha256File(submission.AttachmentPath)
+
+	records, err := log.Records()
+	if err != nil {
+		return record, err
+	}
+
+	return record, log.save(append(records, record))
+}
+
+// All recorded submissions, oldest first
+func (log *SubmissionLog) Records() ([]SubmissionRecord, error) {
+	var records []SubmissionRecord
+
+	raw, err := ioutil.ReadFile(log.Path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, err
+	}
+
+	err = json.Unmarshal(raw, &records)
+
+	return records, err
+}
+
+// Find the record for a Message-ID
+func (log *SubmissionLog) Find(messageId string) (SubmissionRecord, bool, error) {
+	records, err := log.Records()
+	if err != nil {
+		return SubmissionRecord{}, false, err
+	}
+
+	for _, record := range records {
+		if record.MessageId == messageId {
+			return record, true, nil
+		}
+	}
+
+	return SubmissionRecord{}, false, nil
+}
+
+// Find a record again, by its Message-ID, or when it has none by its game, turn and time of submission
+func (log *SubmissionLog) FindRecord(wanted SubmissionRecord) (SubmissionRecord, bool, error) {
+	if wanted.MessageId != "" {
+		return log.Find(wanted.MessageId)
+	}
+
+	records, err := log.Records()
+	if err != nil {
+		return SubmissionRecord{}, false, err
+	}
+
+	for _, record := range records {
+		if record.MessageId == "" && strings.ToLower(record.GameName) == strings.ToLower(wanted.GameName) && record.TurnNumber == wanted.TurnNumber && record.Submitted.Equal(wanted.Submitted) {
+			return record, true, nil
+		}
+	}
+
+	return SubmissionRecord{}, false, nil
+}
+
+// The most recent submission of the given orders for a game, by hash of the 2h file
+func (log *SubmissionLog) FindSubmittedOrders(gameName string, twohHash string) (SubmissionRecord, bool, error) {
+	records, err := log.Records()
+	if err != nil {
+		return SubmissionRecord{}, false, err
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if strings.ToLower(records[i].GameName) == strings.ToLower(gameName) && records[i].TwohHash == twohHash {
+			return records[i], true, nil
+		}
+	}
+
+	return SubmissionRecord{}, false, nil
+}
+
+// Match the given mails against all pending submissions, and mark the ones they acknowledge or bounce.
+// serverFrom is (part of) the address the game server sends receipts from.
+// Returns the records that changed.
+func (log *SubmissionLog) MatchReceipts(receipts []game.ReceiptMail, serverFrom string) ([]SubmissionRecord, error) {
+	var changed []SubmissionRecord
+
+	records, err := log.Records()
+	if err != nil {
+		return changed, err
+	}
+
+	// A receipt only confirms a single submission. The ones quoting a Message-ID are handed out first,
+	// so guessing by subject can't give them to another submission.
+	used := make(map[int]bool)
+
+	for _, byMessageId := range []bool{true, false} {
+		for i := range records {
+			if records[i].Status != ReceiptPending {
+				continue
+			}
+
+			for j, receipt := range receipts {
+				if used[j] {
+					continue
+				}
+
+				if byMessageId && !records[i].repliedToBy(receipt) || !byMessageId && !records[i].acknowledgedBy(receipt, serverFrom) {
+					continue
+				}
+
+				used[j] = true
+
+				if receipt.Bounce {
+					records[i].Status = ReceiptFailed
+				} else {
+					records[i].Status = ReceiptConfirmed
+				}
+
+				records[i].Detail = receipt.Subject
+				changed = append(changed, records[i])
+
+				break
+			}
+		}
+	}
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	return changed, log.save(records)
+}
+
+// The account profiles with submissions still waiting for a receipt, and the time of the oldest of those submissions
+func (log *SubmissionLog) PendingAccounts() (map[string]time.Time, error) {
+	pending := make(map[string]time.Time)
+
+	records, err := log.Records()
+	if err != nil {
+		return pending, err
+	}
+
+	for _, record := range records {
+		if record.Status != ReceiptPending {
+			continue
+		}
+
+		if oldest, ok := pending[record.Account]; !ok || record.Submitted.Before(oldest) {
+			pending[record.Account] = record.Submitted
+		}
+	}
+
+	return pending, nil
+}
+
+// Is the mail a reply to this submission? Anything referring to our Message-ID is, bounces included.
+func (record SubmissionRecord) repliedToBy(receipt game.ReceiptMail) bool {
+	return record.MessageId != "" && receipt.RefersTo(record.MessageId)
+}
+
+// Servers that don't quote the Message-ID acknowledge a submission with a mail from them, arriving after the submission,
+// that reads like a receipt and names the game. New turn mails name the game too, but aren't receipts.
+func (record SubmissionRecord) acknowledgedBy(receipt game.ReceiptMail, serverFrom string) bool {
+	if receipt.Bounce || serverFrom == "" {
+		return false
+	}
+
+	if !receipt.Date.IsZero() && receipt.Date.Before(record.Submitted.Add(-receiptClockSkew)) {
+		return false
+	}
+
+	if !strings.Contains(strings.ToLower(receipt.From), strings.ToLower(serverFrom)) || !receiptSubjectPattern.MatchString(receipt.Subject) {
+		return false
+	}
+
+	recordGame := game.Game{Name: record.GameName}
+
+	return recordGame.MentionedIn(receipt.Subject)
+}
+
+// Poll the IMAP accounts of all pending submissions for receipts.
+// Returns the records that changed.
+func (m *Meta) CheckReceipts() ([]SubmissionRecord, error) {
+	log := SubmissionLog{Path: m.SubmissionLogPath()}
+
+	pending, err := log.PendingAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []SubmissionRecord
+
+	for account, since := range pending {
+		config, err := m.globalConfig().WithAccount(account)
+		if err != nil {
+			return changed, err
+		}
+
+		imapConfig, err := m.imapConfigFrom(config.Imapsettings)
+		if err != nil {
+			return changed, err
+		}
+
+		// IMAP only searches by date, so start the day before to be safe
+		receipts, err := imapConfig.FetchReceiptMails(since.AddDate(0, 0, -1))
+		if err != nil {
+			return changed, err
+		}
+
+		accountChanged, err := log.MatchReceipts(receipts, imapConfig.From)
+		if err != nil {
+			return changed, err
+		}
+
+		changed = append(changed, accountChanged...)
+	}
+
+	return changed, nil
+}
+
+func (log *SubmissionLog) save(records []SubmissionRecord) error {
+	raw, err := json.MarshalIndent(records, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(log.Path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(log.Path, raw, 0600)
+}
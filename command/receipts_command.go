@@ -0,0 +1,81 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ReceiptsCommand struct {
+	*Meta
+
+	GameName string
+	All      bool
+}
+
+// Checks for receipts of pending submissions, and shows the state of recent submissions
+func (c *ReceiptsCommand) run(*kingpin.ParseContext) error {
+	changed, err := c.Meta.CheckReceipts()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range changed {
+		c.Ui.Output(fmt.Sprintf("Game %v, turn %v is now %v", record.GameName, record.TurnNumber, record.Status))
+	}
+
+	submissionLog := SubmissionLog{Path: c.Meta.SubmissionLogPath()}
+
+	records, err := submissionLog.Records()
+	if err != nil {
+		return err
+	}
+
+	// Without --all, only pending submissions and the ones from the last week are interesting
+	cutoff := time.Now().AddDate(0, 0, -7)
+
+	for _, record := range records {
+		if c.GameName != "" && strings.ToLower(record.GameName) != strings.ToLower(c.GameName) {
+			continue
+		}
+
+		if !c.All && record.Status != ReceiptPending && record.Submitted.Before(cutoff) {
+			continue
+		}
+
+		line := fmt.Sprintf("%v turn %v, submitted %v: %v", record.GameName, record.TurnNumber, record.Submitted.Format(time.RFC822), record.Status)
+		if record.Detail != "" {
+			line = fmt.Sprintf("%v (%v)", line, record.Detail)
+		}
+
+		if record.Status == ReceiptFailed {
+			c.Ui.Error(line)
+		} else {
+			c.Ui.Output(line)
+		}
+	}
+
+	return nil
+}
+
+func (c *ReceiptsCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureReceiptsCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "receipts"
+	c := &ReceiptsCommand{Meta: meta}
+	cmd := app.Command(commandName, "Check whether the server received submitted turns.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Arg("game_name", "Only show submissions for this game").StringVar(&c.GameName)
+		cmd.Flag("all", "show all submissions, not just recent ones").Short('a').BoolVar(&c.All)
+		cmd.Action(c.run)
+	}
+
+	return commandName
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSubmissionLog(t *testing.T) SubmissionLog {
+	return SubmissionLog{Path: filepath.Join(testDirectory(t), "submissions.json")}
+}
+
+func TestSubmissionLogRecord(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+	submission := testSubmission(t)
+	submission.MessageId = "<1.abc@example.com>"
+
+	_, err := submissionLog.Record(submission)
+	assert.NoError(t, err)
+
+	record, found, err := submissionLog.Find("<1.abc@example.com>")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "testgame", record.GameName)
+	assert.Equal(t, 7, record.TurnNumber)
+	assert.Equal(t, ReceiptPending, record.Status)
+
+	pending, err := submissionLog.PendingAccounts()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, record.Submitted.Unix(), pending[""].Unix())
+}
+
+func TestMatchReceiptsByMessageId(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+
+	confirmed := testSubmission(t)
+	confirmed.MessageId = "<1.abc@example.com>"
+	_, err := submissionLog.Record(confirmed)
+	assert.NoError(t, err)
+
+	bounced := testSubmission(t)
+	bounced.MessageId = "<2.def@example.com>"
+	bounced.TurnNumber = 8
+	_, err = submissionLog.Record(bounced)
+	assert.NoError(t, err)
+
+	receipts := []game.ReceiptMail{
+		{From: "MAILER-DAEMON@example.com", Subject: "Undelivered Mail Returned to Sender", References: []string{"<2.def@example.com>"}, Bounce: true},
+		{From: "turns@llamaserver.net", Subject: "Received", References: []string{"<1.abc@example.com>"}},
+	}
+
+	changed, err := submissionLog.MatchReceipts(receipts, "")
+	assert.NoError(t, err)
+	assert.Len(t, changed, 2)
+
+	record, _, err := submissionLog.Find("<1.abc@example.com>")
+	assert.NoError(t, err)
+	assert.Equal(t, ReceiptConfirmed, record.Status)
+
+	record, _, err = submissionLog.Find("<2.def@example.com>")
+	assert.NoError(t, err)
+	assert.Equal(t, ReceiptFailed, record.Status)
+	assert.Equal(t, "Undelivered Mail Returned to Sender", record.Detail)
+
+	pending, err := submissionLog.PendingAccounts()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestMatchReceiptsFromServer(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+
+	submission := testSubmission(t)
+	submission.MessageId = "<1.abc@example.com>"
+	_, err := submissionLog.Record(submission)
+	assert.NoError(t, err)
+
+	receipts := []game.ReceiptMail{
+		// Too old to be about this submission
+		{From: "turns@llamaserver.net", Subject: "Received turn for testgame", Date: time.Now().Add(-time.Hour)},
+		// Someone else's game
+		{From: "turns@llamaserver.net", Subject: "Received turn for othergame", Date: time.Now()},
+		// A game with a longer name
+		{From: "turns@llamaserver.net", Subject: "Received turn for testgame2", Date: time.Now()},
+		// Not a receipt
+		{From: "turns@llamaserver.net", Subject: "New turn for testgame", Date: time.Now()},
+	}
+
+	changed, err := submissionLog.MatchReceipts(receipts, "llamaserver.net")
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+
+	receipts = append(receipts, game.ReceiptMail{From: "turns@llamaserver.net", Subject: "Received turn for testgame", Date: time.Now()})
+
+	changed, err = submissionLog.MatchReceipts(receipts, "llamaserver.net")
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, ReceiptConfirmed, changed[0].Status)
+}
+
+func TestMatchReceiptsConfirmsOneSubmissionEach(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+
+	for i, messageId := range []string{"<1.abc@example.com>", "<2.def@example.com>"} {
+		submission := testSubmission(t)
+		submission.MessageId = messageId
+		submission.TurnNumber = 7 + i
+		_, err := submissionLog.Record(submission)
+		assert.NoError(t, err)
+	}
+
+	// A receipt quoting the Message-ID belongs to its own submission, even though the other one could claim it by subject
+	receipts := []game.ReceiptMail{{From: "turns@llamaserver.net", Subject: "Received turn for testgame", Date: time.Now(), References: []string{"<2.def@example.com>"}}}
+
+	changed, err := submissionLog.MatchReceipts(receipts, "llamaserver.net")
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, 8, changed[0].TurnNumber)
+
+	submission := testSubmission(t)
+	submission.MessageId = "<3.ghi@example.com>"
+	_, err = submissionLog.Record(submission)
+	assert.NoError(t, err)
+
+	receipts = []game.ReceiptMail{{From: "turns@llamaserver.net", Subject: "Received turn for testgame", Date: time.Now()}}
+
+	changed, err = submissionLog.MatchReceipts(receipts, "llamaserver.net")
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, "<1.abc@example.com>", changed[0].MessageId)
+}
+
+func TestFindRecordWithoutMessageId(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+
+	first, err := submissionLog.Record(testSubmission(t))
+	assert.NoError(t, err)
+	second, err := submissionLog.Record(testSubmission(t))
+	assert.NoError(t, err)
+
+	found, ok, err := submissionLog.FindRecord(second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, second.Submitted.Equal(found.Submitted))
+	assert.False(t, first.Submitted.Equal(found.Submitted))
+
+	second.TurnNumber = 8
+	_, ok, err = submissionLog.FindRecord(second)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFindSubmittedOrders(t *testing.T) {
+	submissionLog := testSubmissionLog(t)
+	submission := testSubmission(t)
+
+	record, err := submissionLog.Record(submission)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, record.TwohHash)
+
+	found, ok, err := submissionLog.FindSubmittedOrders("TestGame", record.TwohHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 7, found.TurnNumber)
+
+	_, ok, err = submissionLog.FindSubmittedOrders("othergame", record.TwohHash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
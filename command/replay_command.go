@@ -1,9 +1,12 @@
 package command
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"path/filepath"
 
+	"github.com/promisedlandt/dom4tools/game"
 	"github.com/promisedlandt/dom4tools/utility"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -14,18 +17,26 @@ type ReplayCommand struct {
 	Force     bool
 	Destroy   bool
 	GameName  string
+	Nation    string
 	StartTurn int
 	TurnCount int
+	// For the viewer: which turn to show, and whether to start Dominions 4 on it
+	TurnNumber int
+	Launch     bool
 }
 
 func (c *ReplayCommand) run(parseContext *kingpin.ParseContext) error {
-	game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+	g, err := c.Meta.FindGame(c.GameName, c.Nation)
 	if err != nil {
 		return err
 	}
 
+	if len(g.SortedTrnBackupKeys) == 0 {
+		return errors.New(fmt.Sprintf("No backups of %v to replay", g.Name))
+	}
+
 	var endTurn int
-	lastSavedTurn := game.SortedTrnBackupKeys[len(game.SortedTrnBackupKeys)-1]
+	lastSavedTurn := g.SortedTrnBackupKeys[len(g.SortedTrnBackupKeys)-1]
 
 	if c.TurnCount > 0 {
 		endTurn = c.StartTurn + c.TurnCount - 1
@@ -37,43 +48,80 @@ func (c *ReplayCommand) run(parseContext *kingpin.ParseContext) error {
 		endTurn = lastSavedTurn
 	}
 
+	replays, err := game.LoadReplayManifest(g.ReplayManifestPath())
+	if err != nil {
+		return err
+	}
+
 	if c.Destroy {
-		c.Ui.Output(fmt.Sprintf("Replaying turns for %v, starting at %v, ending at %v", game.Name, c.StartTurn, endTurn))
+		c.Ui.Output(fmt.Sprintf("Deleting replays for %v, starting at %v, ending at %v", g.Name, c.StartTurn, endTurn))
 
 		for turn := c.StartTurn; turn <= endTurn; turn++ {
+			replayGameName := g.ReplayName(turn)
 
-			replayGameName := game.ReplayName(turn)
-			replayGame, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(replayGameName)
+			// Only ever delete what we created
+			if _, ok := replays.Find(replayGameName); !ok {
+				continue
+			}
 
+			replayGame, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(replayGameName)
 			if err != nil {
 				c.Ui.Output(fmt.Sprintf("No game found for turn %v", turn))
 			} else {
 				c.Ui.Output(fmt.Sprintf("Deleting %v", replayGame.Name))
-				replayGame.Delete()
+
+				err = replayGame.Delete()
+				if err != nil {
+					return err
+				}
+			}
+
+			replays.Remove(replayGameName)
+
+			err = replays.Save()
+			if err != nil {
+				return err
 			}
 		}
 	} else {
-		c.Ui.Output(fmt.Sprintf("Deleting replays for %v, starting at %v, ending at %v", game.Name, c.StartTurn, endTurn))
+		c.Ui.Output(fmt.Sprintf("Replaying turns for %v, starting at %v, ending at %v", g.Name, c.StartTurn, endTurn))
 
 		for turn := c.StartTurn; turn <= endTurn; turn++ {
-			trnFile, ok := game.TrnBackups[turn]
+			trnFile, ok := g.TrnBackups[turn]
 			if !ok {
 				c.Ui.Error(fmt.Sprintf("No .trn file found for turn %v, skipping", turn))
 				continue
 			}
 
-			twohFile, ok := game.TwohBackups[turn]
+			twohFile, ok := g.TwohBackups[turn]
 			if !ok {
 				c.Ui.Error(fmt.Sprintf("No .2h file found for turn %v, skipping", turn))
 				continue
 			}
 
-			newGameName := game.ReplayName(turn)
-			newGameCmd := CreateCommand{Meta: c.Meta, Force: c.Force, NewGameName: newGameName}
-			newGameCmd.run(parseContext)
+			newGameName := g.ReplayName(turn)
 			newGame, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(newGameName)
-			if err != nil {
-				return err
+
+			switch _, recorded := replays.Find(newGameName); {
+			case err == nil && !recorded:
+				c.Ui.Error(fmt.Sprintf("%v wasn't created by d4t, not replacing it. Skipping turn %v", newGame.Directory, turn))
+				continue
+			case err == nil && !c.Force:
+				c.Ui.Error(fmt.Sprintf("Replay %v already exists, overwrite with --force. Skipping turn %v", newGameName, turn))
+				continue
+			case err == nil:
+				c.Ui.Info(fmt.Sprintf("Overwriting %v", newGameName))
+			case err != nil:
+				newGameCmd := CreateCommand{Meta: c.Meta, NewGameName: newGameName}
+				err = newGameCmd.run(parseContext)
+				if err != nil {
+					return err
+				}
+
+				newGame, err = c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(newGameName)
+				if err != nil {
+					return err
+				}
 			}
 
 			backupTrnBasename, err := trnFile.BackupBasename()
@@ -86,12 +134,14 @@ func (c *ReplayCommand) run(parseContext *kingpin.ParseContext) error {
 				return err
 			}
 
-			err = utility.Cp(trnFile.Fullpath, filepath.Join(newGame.Directory, backupTrnBasename))
+			err = copyReplayFiles(trnFile, twohFile, filepath.Join(newGame.Directory, backupTrnBasename), filepath.Join(newGame.Directory, backupTwohBasename))
 			if err != nil {
 				return err
 			}
 
-			err = utility.Cp(twohFile.Fullpath, filepath.Join(newGame.Directory, backupTwohBasename))
+			replays.Add(game.ReplayRecord{Name: newGameName, TurnNumber: turn}, g.NationStem)
+
+			err = replays.Save()
 			if err != nil {
 				return err
 			}
@@ -101,6 +151,144 @@ func (c *ReplayCommand) run(parseContext *kingpin.ParseContext) error {
 	return nil
 }
 
+// Write both backed up files into a replay game, or neither
+func copyReplayFiles(trnFile game.TrnFile, twohFile game.TwohFile, trnPath string, twohPath string) (err error) {
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	trnContents, err := trnFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	err = tx.WriteFile(trnPath, trnContents.Data, 0644, trnContents.Modified)
+	if err != nil {
+		return err
+	}
+
+	twohContents, err := twohFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	return tx.WriteFile(twohPath, twohContents.Data, 0644, twohContents.Modified)
+}
+
+// Show a turn in the replay viewer, the newest backed up one unless given
+func (c *ReplayCommand) view(*kingpin.ParseContext) error {
+	g, err := c.Meta.FindGame(c.GameName, c.Nation)
+	if err != nil {
+		return err
+	}
+
+	if len(g.SortedTrnBackupKeys) == 0 {
+		return errors.New(fmt.Sprintf("No backups of %v to view", g.Name))
+	}
+
+	turnNumber := c.TurnNumber
+	if turnNumber <= 0 {
+		turnNumber, err = g.StepReplayTurn(math.MaxInt32, -1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.showReplay(g, turnNumber)
+}
+
+func (c *ReplayCommand) next(*kingpin.ParseContext) error {
+	return c.step(1)
+}
+
+func (c *ReplayCommand) prev(*kingpin.ParseContext) error {
+	return c.step(-1)
+}
+
+// Show the backed up turn after or before the one the viewer shows
+func (c *ReplayCommand) step(step int) error {
+	viewer, err := c.Meta.replayViewer(c.GameName)
+	if err != nil {
+		return err
+	}
+
+	if viewer.TurnNumber <= 0 {
+		return errors.New(fmt.Sprintf("The replay viewer doesn't show %v yet, start with: d4t replay view %v --turn TURN_NUMBER", c.GameName, c.GameName))
+	}
+
+	nation := c.Nation
+	if nation == "" {
+		nation = viewer.Nation
+	}
+
+	g, err := c.Meta.FindGame(c.GameName, nation)
+	if err != nil {
+		return err
+	}
+
+	turnNumber, err := g.StepReplayTurn(viewer.TurnNumber, step)
+	if err != nil {
+		return err
+	}
+
+	return c.showReplay(g, turnNumber)
+}
+
+func (c *ReplayCommand) showReplay(g *game.Game, turnNumber int) error {
+	viewer, err := c.Meta.replayViewer(g.Name)
+	if err != nil {
+		return err
+	}
+
+	viewerName := g.ReplayViewerName()
+
+	replays, err := game.LoadReplayManifest(g.ReplayManifestPath())
+	if err != nil {
+		return err
+	}
+
+	// Showing a turn replaces the files in the viewer, which must not be somebody's game
+	if _, recorded := replays.Find(viewerName); !recorded && utility.FileExists(viewer.Directory) {
+		return errors.New(fmt.Sprintf("%v wasn't created by d4t, not using it as the replay viewer", viewer.Directory))
+	}
+
+	err = g.ShowReplay(&viewer, turnNumber)
+	if err != nil {
+		return err
+	}
+
+	replays.Add(game.ReplayRecord{Name: viewerName, Viewer: true}, g.NationStem)
+
+	err = replays.Save()
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("%v shows turn %v of %v", viewerName, turnNumber, g.Name))
+
+	if !c.Launch {
+		return nil
+	}
+
+	executable, err := c.Meta.Dominions4Executable()
+	if err != nil {
+		return err
+	}
+
+	args, err := c.Meta.Config.PlayArgs(&game.Game{Name: viewerName, Directory: viewer.Directory, NationStem: g.NationStem})
+	if err != nil {
+		return err
+	}
+
+	return launch(executable, args)
+}
+
+// The replay viewer of a game, in its own directory next to the game
+func (m *Meta) replayViewer(gameName string) (game.ReplayViewer, error) {
+	g := game.Game{Name: gameName}
+
+	return game.LoadReplayViewer(filepath.Join(m.RunContext.GameInstallation.SavedGamesPath, g.ReplayViewerName()))
+}
+
 func (c *ReplayCommand) completion(parseContext *kingpin.ParseContext) error {
 	return completionWithGames(c.Meta, parseContext)
 }
@@ -108,17 +296,37 @@ func (c *ReplayCommand) completion(parseContext *kingpin.ParseContext) error {
 func ConfigureReplayCommand(app *kingpin.Application, meta *Meta) (commandName string) {
 	commandName = "replay"
 	c := &ReplayCommand{Meta: meta}
-	cmd := app.Command(commandName, "Create new games for every backed up turn for the given game.")
+	cmd := app.Command(commandName, "Create a game for every backed up turn of a game, or step through them in a single viewer game.")
 
 	if meta.CompletionOnly {
 		cmd.Action(c.completion)
 	} else {
-		cmd.Action(c.run)
-		cmd.Arg("game_name", "Name of the game to replay").Required().StringVar(&c.GameName)
-		cmd.Flag("force", "overwrite existing games").Short('f').BoolVar(&c.Force)
-		cmd.Flag("delete", "delete games instead of creating them").Short('d').BoolVar(&c.Destroy)
-		cmd.Flag("start-turn", "Start on which turn?").Short('s').Default("1").IntVar(&c.StartTurn)
-		cmd.Flag("count", "Replay how many turns?").Short('c').IntVar(&c.TurnCount)
+		createCmd := cmd.Command("create", "Create new games for every backed up turn for the given game.").Default()
+		createCmd.Action(c.run)
+		createCmd.Arg("game_name", "Name of the game to replay").Required().StringVar(&c.GameName)
+		createCmd.Flag("force", "overwrite existing games").Short('f').BoolVar(&c.Force)
+		createCmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+		createCmd.Flag("delete", "delete games instead of creating them").Short('d').BoolVar(&c.Destroy)
+		createCmd.Flag("start-turn", "Start on which turn?").Short('s').Default("1").IntVar(&c.StartTurn)
+		createCmd.Flag("count", "Replay how many turns?").Short('c').IntVar(&c.TurnCount)
+
+		viewCmd := cmd.Command("view", "Show a backed up turn in the replay viewer, a single game next to the game.")
+		viewCmd.Action(c.view)
+		viewCmd.Arg("game_name", "Name of the game to view").Required().StringVar(&c.GameName)
+		viewCmd.Flag("turn", "Show which turn? Defaults to the newest backup").Short('t').IntVar(&c.TurnNumber)
+
+		nextCmd := cmd.Command("next", "Show the backed up turn after the one in the replay viewer.")
+		nextCmd.Action(c.next)
+		nextCmd.Arg("game_name", "Name of the game to view").Required().StringVar(&c.GameName)
+
+		prevCmd := cmd.Command("prev", "Show the backed up turn before the one in the replay viewer.")
+		prevCmd.Action(c.prev)
+		prevCmd.Arg("game_name", "Name of the game to view").Required().StringVar(&c.GameName)
+
+		for _, viewerCmd := range []*kingpin.CmdClause{viewCmd, nextCmd, prevCmd} {
+			viewerCmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+			viewerCmd.Flag("launch", "start Dominions 4 on the viewer").Short('l').BoolVar(&c.Launch)
+		}
 	}
 
 	return commandName
@@ -10,15 +10,34 @@ type RestoreCommand struct {
 	*Meta
 
 	GameName   string
+	Nation     string
 	TurnNumber int
+	FromRemote bool
 }
 
 func (c *RestoreCommand) run(*kingpin.ParseContext) error {
-	game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+	game, err := c.Meta.FindGame(c.GameName, c.Nation)
 	if err != nil {
 		return err
 	}
 
+	game, err = c.Meta.recoverLeftovers(game)
+	if err != nil {
+		return err
+	}
+
+	if c.FromRemote {
+		err = c.Meta.pullBackups(game, c.TurnNumber)
+		if err != nil {
+			return err
+		}
+
+		game, err = c.Meta.reloadGame(game)
+		if err != nil {
+			return err
+		}
+	}
+
 	c.Ui.Output(fmt.Sprintf("Restoring turn %v for game %v", c.TurnNumber, game.Name))
 	err = game.Restore(c.TurnNumber)
 	if err != nil {
@@ -43,6 +62,8 @@ func ConfigureRestoreCommand(app *kingpin.Application, meta *Meta) (commandName
 		cmd.Action(c.run)
 		cmd.Arg("game_name", "Name of the game to restore for").Required().StringVar(&c.GameName)
 		cmd.Arg("turn_number", "Restore which turn number?").Required().IntVar(&c.TurnNumber)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+		cmd.Flag("from-remote", "fetch the backups from the configured storage first").BoolVar(&c.FromRemote)
 	}
 
 	return commandName
@@ -14,6 +14,11 @@ func ConfigureResubmitCommand(app *kingpin.Application, meta *Meta) (commandName
 	} else {
 		cmd.Arg("game_name", "Name of the game to resubmit").Required().StringVar(&c.GameName)
 		cmd.Arg("turn_number", "Resubmit which turn? Needed for backup").IntVar(&c.TurnNumber)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
+		cmd.Flag("yes", "don't ask for confirmation if the orders look stale").Short('y').BoolVar(&c.Yes)
+		cmd.Flag("defer", "queue in the outbox instead of sending right away").BoolVar(&c.Defer)
+		cmd.Flag("wait-receipt", "wait until the server confirms the turn").BoolVar(&c.WaitReceipt)
+		cmd.Flag("receipt-timeout", "how long to wait for the receipt").Default("15m").DurationVar(&c.ReceiptTimeout)
 		cmd.Action(c.run)
 	}
 
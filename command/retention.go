@@ -0,0 +1,50 @@
+package command
+
+import (
+	"github.com/promisedlandt/dom4tools/game"
+)
+
+// The retention settings for a game, its own if it has any, the global ones otherwise
+func (config ConfigStruct) RetentionFor(gameName string) Retentionsettings {
+	if settings := config.GameSettings(gameName).Retention; settings != nil {
+		return *settings
+	}
+
+	if config.Retention != nil {
+		return *config.Retention
+	}
+
+	return Retentionsettings{}
+}
+
+func (settings Retentionsettings) Policy() game.RetentionPolicy {
+	return game.RetentionPolicy{KeepLast: settings.KeepLast, KeepEvery: settings.KeepEvery}
+}
+
+// Work out what pruning a game does, and do it unless dryRun is set
+func (m *Meta) PruneGame(g *game.Game, dryRun bool) (game.PrunePlan, error) {
+	plan, err := g.PrunePlan(m.Config.RetentionFor(g.Name).Policy(), m.hasReplay(g))
+	if err != nil || dryRun {
+		return plan, err
+	}
+
+	return plan, g.Prune(plan)
+}
+
+// Tells whether a replay game d4t created holds both the trn and the 2h of a nation for a turn
+func (m *Meta) hasReplay(g *game.Game) func(nation *game.GameNation, turnNumber int) bool {
+	return func(nation *game.GameNation, turnNumber int) bool {
+		if recorded, err := g.HasReplay(nation.Stem, turnNumber); err != nil || !recorded {
+			return false
+		}
+
+		replayGame, err := m.RunContext.GameInstallation.AvailableGames.FindGameByName(g.ReplayName(turnNumber))
+		if err != nil {
+			return false
+		}
+
+		replayNation, ok := replayGame.Nations[nation.Stem]
+
+		return ok && replayNation.TrnFile.Fullpath != "" && replayNation.TwohFile.Fullpath != ""
+	}
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+// An installation with testgame, backed up for turns 1 to 6, and replays for turns 1 and 2. The replay of turn 2 lacks its 2h.
+func testRetentionMeta(t *testing.T, retention Retentionsettings) *Meta {
+	basePath := testDirectory(t)
+	gameDirectory := filepath.Join(basePath, "savedgames", "testgame")
+	assert.NoError(t, os.MkdirAll(gameDirectory, 0755))
+
+	for turn := 1; turn <= 6; turn++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, fmt.Sprintf("early_ulm-%v.trn", turn)), []byte("turn"), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, fmt.Sprintf("early_ulm-%v.2h", turn)), []byte("orders"), 0644))
+	}
+
+	g, err := game.NewGame("testgame", gameDirectory)
+	assert.NoError(t, err)
+
+	for turn, files := range map[int][]string{1: {"early_ulm.trn", "early_ulm.2h"}, 2: {"early_ulm.trn"}} {
+		replayDirectory := filepath.Join(basePath, "savedgames", g.ReplayName(turn))
+		assert.NoError(t, os.MkdirAll(replayDirectory, 0755))
+
+		for _, file := range files {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(replayDirectory, file), []byte("replay"), 0644))
+		}
+
+		assert.NoError(t, g.RecordReplay(game.ReplayRecord{Name: g.ReplayName(turn), TurnNumber: turn, Nations: []string{"early_ulm"}}))
+	}
+
+	config := ConfigStruct{Games: map[string]Gamesettings{"testgame": {Retention: &retention}}}
+
+	return &Meta{Ui: cli.NewMockUi(), Config: config, RunContext: &RunContext{GameInstallation: *game.NewGameInstallation(basePath)}}
+}
+
+func TestRetentionFor(t *testing.T) {
+	config := ConfigStruct{
+		Retention: &Retentionsettings{KeepLast: 10, KeepEvery: 5},
+		Games:     map[string]Gamesettings{"testgame": {Retention: &Retentionsettings{KeepLast: 3}}, "other": {Server: "club"}},
+	}
+
+	assert.Equal(t, Retentionsettings{KeepLast: 3}, config.RetentionFor("TestGame"))
+	assert.Equal(t, Retentionsettings{KeepLast: 10, KeepEvery: 5}, config.RetentionFor("other"))
+	assert.False(t, ConfigStruct{}.RetentionFor("testgame").Policy().Enabled())
+}
+
+func TestHasReplayNeedsBothFiles(t *testing.T) {
+	meta := testRetentionMeta(t, Retentionsettings{KeepLast: 2})
+	g, err := meta.FindGame("testgame", "")
+	assert.NoError(t, err)
+
+	hasReplay := meta.hasReplay(g)
+	nation := g.Nations["early_ulm"]
+
+	assert.True(t, hasReplay(nation, 1))
+	assert.False(t, hasReplay(nation, 2))
+	assert.False(t, hasReplay(nation, 3))
+}
+
+func TestPruneGame(t *testing.T) {
+	meta := testRetentionMeta(t, Retentionsettings{KeepLast: 2})
+	g, err := meta.FindGame("testgame", "")
+	assert.NoError(t, err)
+
+	plan, err := meta.PruneGame(g, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(g.Directory, "early_ulm-1.2h"), filepath.Join(g.Directory, "early_ulm-1.trn")}, plan.Delete)
+	assert.Equal(t, map[string][]int{"early_ulm": {2, 3, 4}}, plan.OnlyCopy)
+	assert.True(t, utility.FileExists(filepath.Join(g.Directory, "early_ulm-1.trn")))
+
+	_, err = meta.PruneGame(g, false)
+	assert.NoError(t, err)
+	assert.False(t, utility.FileExists(filepath.Join(g.Directory, "early_ulm-1.trn")))
+	assert.False(t, utility.FileExists(filepath.Join(g.Directory, "early_ulm-1.2h")))
+	assert.True(t, utility.FileExists(filepath.Join(g.Directory, "early_ulm-2.trn")))
+}
+
+func TestPruneCommand(t *testing.T) {
+	meta := testRetentionMeta(t, Retentionsettings{KeepLast: 2})
+	ui := meta.Ui.(*cli.MockUi)
+
+	c := PruneCommand{Meta: meta, GameName: "testgame", DryRun: true}
+	assert.NoError(t, c.run(nil))
+	assert.Contains(t, ui.OutputWriter.String(), "testgame: Would delete early_ulm-1.trn")
+	assert.Contains(t, ui.ErrorWriter.String(), "testgame: Kept early_ulm turns 2, 3, 4, there is no replay for them")
+	assert.True(t, utility.FileExists(filepath.Join(meta.RunContext.GameInstallation.SavedGamesPath, "testgame", "early_ulm-1.trn")))
+
+	// Without a game name, only games with a retention policy are pruned, and not the replays
+	c = PruneCommand{Meta: meta}
+	assert.NoError(t, c.run(nil))
+	assert.Contains(t, ui.OutputWriter.String(), "testgame: Deleted early_ulm-1.trn")
+	assert.NotContains(t, ui.OutputWriter.String(), "testgame_turn1:")
+	assert.False(t, utility.FileExists(filepath.Join(meta.RunContext.GameInstallation.SavedGamesPath, "testgame", "early_ulm-1.trn")))
+
+	c = PruneCommand{Meta: meta, GameName: "testgame_turn1"}
+	assert.EqualError(t, c.run(nil), "No retention policy for testgame_turn1, set keep_last in the retention settings")
+}
+
+func TestBackupPrunesAfterBackup(t *testing.T) {
+	meta := testRetentionMeta(t, Retentionsettings{KeepLast: 2, PruneAfterBackup: true})
+	gameDirectory := filepath.Join(meta.RunContext.GameInstallation.SavedGamesPath, "testgame")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, "early_ulm.trn"), []byte("turn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, "early_ulm.2h"), []byte("orders"), 0644))
+	meta.RunContext.GameInstallation.Update()
+
+	c := BackupCommand{Meta: meta, GameName: "testgame", TurnNumber: 7}
+	assert.NoError(t, c.run(nil))
+
+	assert.True(t, utility.FileExists(filepath.Join(gameDirectory, "early_ulm-7.trn")))
+	assert.False(t, utility.FileExists(filepath.Join(gameDirectory, "early_ulm-1.trn")))
+	assert.Contains(t, meta.Ui.(*cli.MockUi).OutputWriter.String(), "Pruned early_ulm-1.trn")
+
+	// Without prune_after_backup, backing up deletes nothing
+	meta.Config.Games["testgame"] = Gamesettings{Retention: &Retentionsettings{KeepLast: 2}}
+	c = BackupCommand{Meta: meta, GameName: "testgame", TurnNumber: 8}
+	assert.NoError(t, c.run(nil))
+	assert.True(t, utility.FileExists(filepath.Join(gameDirectory, "early_ulm-2.trn")))
+}
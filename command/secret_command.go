@@ -0,0 +1,131 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/promisedlandt/dom4tools/utility"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type SecretCommand struct {
+	*Meta
+
+	Name string
+}
+
+// Store a secret in the encrypted secrets file, creating the file if necessary
+func (c *SecretCommand) set(*kingpin.ParseContext) error {
+	// A typo in the passphrase of a new file would lock us out of it, so ask twice
+	if !utility.FileExists(c.Meta.SecretsPath()) && os.Getenv(SecretsPassphraseEnv) == "" {
+		passphrase, err := c.Ui.AskSecret(fmt.Sprintf("New passphrase for %v:", c.Meta.SecretsPath()))
+		if err != nil {
+			return err
+		}
+
+		confirmation, err := c.Ui.AskSecret("Repeat passphrase:")
+		if err != nil {
+			return err
+		}
+
+		if passphrase != confirmation {
+			return errors.New("Passphrases did not match")
+		}
+
+		c.Meta.secretStore, err = OpenSecretStore(c.Meta.SecretsPath(), passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	store, err := c.Meta.SecretStore()
+	if err != nil {
+		return err
+	}
+
+	value, err := c.Ui.AskSecret(fmt.Sprintf("Value for %v:", c.Name))
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		return errors.New("Not storing an empty secret")
+	}
+
+	store.Secrets[c.Name] = value
+
+	err = store.Save()
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("Stored %v in %v, use it with \"password_secret\": \"%v\"", c.Name, store.Path, c.Name))
+
+	return nil
+}
+
+// List the names, but not the values, of all stored secrets
+func (c *SecretCommand) list(*kingpin.ParseContext) error {
+	store, err := c.Meta.SecretStore()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range store.Names() {
+		c.Ui.Output(name)
+	}
+
+	return nil
+}
+
+// Remove a secret from the secrets file
+func (c *SecretCommand) delete(*kingpin.ParseContext) error {
+	store, err := c.Meta.SecretStore()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := store.Secrets[c.Name]; !ok {
+		return errors.New(fmt.Sprintf("No secret called %v in %v", c.Name, store.Path))
+	}
+
+	delete(store.Secrets, c.Name)
+
+	err = store.Save()
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("Deleted %v from %v", c.Name, store.Path))
+
+	return nil
+}
+
+func (c *SecretCommand) completion(parseContext *kingpin.ParseContext) error {
+	return noCompletion()
+}
+
+func ConfigureSecretCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "secret"
+	c := &SecretCommand{Meta: meta}
+	cmd := app.Command(commandName, "Manage passwords in the encrypted secrets file. The passphrase is read from "+SecretsPassphraseEnv+" or asked for.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		setCmd := cmd.Command("set", "Store a secret, asking for its value.")
+		setCmd.Arg("name", "Name of the secret, as used in password_secret").Required().StringVar(&c.Name)
+		setCmd.Action(c.set)
+
+		listCmd := cmd.Command("list", "List the names of all stored secrets.")
+		listCmd.Action(c.list)
+
+		deleteCmd := cmd.Command("delete", "Delete a stored secret.")
+		deleteCmd.Arg("name", "Name of the secret").Required().StringVar(&c.Name)
+		deleteCmd.Action(c.delete)
+	}
+
+	return commandName
+}
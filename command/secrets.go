@@ -0,0 +1,301 @@
+package command
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Environment variable to read the secrets file passphrase from, instead of asking for it
+const SecretsPassphraseEnv = "D4T_PASSPHRASE"
+
+// Secret describes where a password comes from. Exactly one of the fields should be set,
+// if several are, the first one in order of declaration wins.
+type Secret struct {
+	// The password itself, stored in plain text in the config
+	Plain string
+	// Name of an environment variable containing the password
+	Env string
+	// Command printing the password, e.g. "pass show mail"
+	Command string
+	// Name of the password in the encrypted secrets file
+	Name string
+}
+
+// SecretStore is an encrypted file of named secrets, unlocked with a passphrase
+type SecretStore struct {
+	Path    string
+	Secrets map[string]string
+
+	passphrase string
+}
+
+// On disk format of the secrets file. The data is a JSON object of all secrets, encrypted with AES-256-GCM
+// using a key derived from the passphrase with scrypt.
+type secretsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// scrypt parameters for the key derivation
+const (
+	scryptN       = 32768
+	scryptR       = 8
+	scryptP       = 1
+	secretsKeyLen = 32
+)
+
+func (s Smtpsettings) Secret() Secret {
+	return Secret{Plain: s.Password, Env: s.PasswordEnv, Command: s.PasswordCommand, Name: s.PasswordSecret}
+}
+
+func (s Imapsettings) Secret() Secret {
+	return Secret{Plain: s.Password, Env: s.PasswordEnv, Command: s.PasswordCommand, Name: s.PasswordSecret}
+}
+
+func (s Pop3settings) Secret() Secret {
+	return Secret{Plain: s.Password, Env: s.PasswordEnv, Command: s.PasswordCommand, Name: s.PasswordSecret}
+}
+
+func (s Storagesettings) Secret() Secret {
+	return Secret{Plain: s.Password, Env: s.PasswordEnv, Command: s.PasswordCommand, Name: s.PasswordSecret}
+}
+
+// Does the config contain any passwords in plain text, in the top level settings, any account profile or any storage?
+func (config ConfigStruct) HasPlainPasswords() bool {
+	if config.Smtpsettings.Password != "" || config.Imapsettings.Password != "" || config.Pop3settings.Password != "" {
+		return true
+	}
+
+	for _, profile := range config.Accounts {
+		if profile.Smtpsettings != nil && profile.Smtpsettings.Password != "" {
+			return true
+		}
+
+		if profile.Imapsettings != nil && profile.Imapsettings.Password != "" {
+			return true
+		}
+
+		if profile.Pop3settings != nil && profile.Pop3settings.Password != "" {
+			return true
+		}
+	}
+
+	storages := config.Storage
+	for _, settings := range config.Games {
+		storages = append(storages, settings.Storage...)
+	}
+
+	for _, storage := range storages {
+		if storage.Password != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The path of the encrypted secrets file, next to the config unless configured otherwise
+func (m *Meta) SecretsPath() string {
+	if m.Config.Secretsfile != "" {
+		return m.Config.Secretsfile
+	}
+
+	return filepath.Join(filepath.Dir(m.RunContext.BaseConfigurationPath), "secrets.json")
+}
+
+// Resolve a secret to the password it describes. Returns an empty string if the secret is empty.
+// settingsName is only used in error messages, e.g. smtpsettings
+func (m *Meta) ResolveSecret(secret Secret, settingsName string) (string, error) {
+	switch {
+	case secret.Plain != "":
+		return secret.Plain, nil
+	case secret.Env != "":
+		password := os.Getenv(secret.Env)
+		if password == "" {
+			return "", errors.New(fmt.Sprintf("%v, set as password_env in %v, is empty", secret.Env, settingsName))
+		}
+
+		return password, nil
+	case secret.Command != "":
+		return RunPasswordCommand(secret.Command)
+	case secret.Name != "":
+		store, err := m.SecretStore()
+		if err != nil {
+			return "", err
+		}
+
+		password, ok := store.Secrets[secret.Name]
+		if !ok {
+			return "", errors.New(fmt.Sprintf("No secret called %v in %v, set in %v", secret.Name, store.Path, settingsName))
+		}
+
+		return password, nil
+	}
+
+	return "", nil
+}
+
+// Open the secrets file, asking for the passphrase unless it is in the environment.
+// The unlocked store is kept for the rest of the run, so we ask at most once.
+func (m *Meta) SecretStore() (*SecretStore, error) {
+	if m.secretStore != nil {
+		return m.secretStore, nil
+	}
+
+	passphrase := os.Getenv(SecretsPassphraseEnv)
+	if passphrase == "" {
+		var err error
+		passphrase, err = m.Ui.AskSecret(fmt.Sprintf("Passphrase for %v:", m.SecretsPath()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := OpenSecretStore(m.SecretsPath(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	m.secretStore = store
+
+	return store, nil
+}
+
+// Run a password command through the shell, and return the first line it prints
+func RunPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	// Lets commands like pass or gpg ask for their own passphrase
+	cmd.Stdin = os.Stdin
+
+	err := cmd.Run()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Password command \"%v\" failed: %v", command, err.Error()))
+	}
+
+	password := strings.TrimRight(strings.SplitN(stdout.String(), "\n", 2)[0], "\r")
+	if password == "" {
+		return "", errors.New(fmt.Sprintf("Password command \"%v\" printed nothing", command))
+	}
+
+	return password, nil
+}
+
+// Open and decrypt the secrets file at path. A missing file is an empty store.
+func OpenSecretStore(path string, passphrase string) (*SecretStore, error) {
+	store := &SecretStore{Path: path, Secrets: make(map[string]string), passphrase: passphrase}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file secretsFile
+	err = json.Unmarshal(raw, &file)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%v is not a secrets file: %v", path, err.Error()))
+	}
+
+	gcm, err := secretsCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not decrypt %v, wrong passphrase?", path))
+	}
+
+	err = json.Unmarshal(plaintext, &store.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Encrypt and write the secrets file, readable by owner only
+func (store *SecretStore) Save() error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	gcm, err := secretsCipher(store.passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(store.Secrets)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(secretsFile{Version: 1, Salt: salt, Nonce: nonce, Data: gcm.Seal(nil, nonce, plaintext, nil)}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.Path, raw, 0600)
+}
+
+// The names of all secrets in the store, sorted
+func (store *SecretStore) Names() []string {
+	var names []string
+	for name := range store.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func secretsCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("The secrets passphrase must not be empty")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, secretsKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,156 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretStoreRoundtrip(t *testing.T) {
+	path := filepath.Join(testDirectory(t), "secrets.json")
+
+	store, err := OpenSecretStore(path, "correct horse")
+	assert.NoError(t, err)
+	assert.Empty(t, store.Secrets)
+
+	store.Secrets["smtp"] = "hunter2"
+	assert.NoError(t, store.Save())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode())
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "hunter2")
+
+	reopened, err := OpenSecretStore(path, "correct horse")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"smtp": "hunter2"}, reopened.Secrets)
+}
+
+func TestSecretStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(testDirectory(t), "secrets.json")
+
+	store, err := OpenSecretStore(path, "correct horse")
+	assert.NoError(t, err)
+	store.Secrets["smtp"] = "hunter2"
+	assert.NoError(t, store.Save())
+
+	_, err = OpenSecretStore(path, "battery staple")
+	assert.Error(t, err)
+}
+
+func TestResolveSecret(t *testing.T) {
+	directory := testDirectory(t)
+	meta := &Meta{RunContext: &RunContext{BaseConfigurationPath: filepath.Join(directory, "config.json")}}
+
+	store, err := OpenSecretStore(meta.SecretsPath(), "correct horse")
+	assert.NoError(t, err)
+	store.Secrets["smtp"] = "from the store"
+	assert.NoError(t, store.Save())
+
+	os.Setenv("D4T_TEST_PASSWORD", "from the environment")
+	defer os.Unsetenv("D4T_TEST_PASSWORD")
+	os.Setenv(SecretsPassphraseEnv, "correct horse")
+	defer os.Unsetenv(SecretsPassphraseEnv)
+
+	password, err := meta.ResolveSecret(Secret{Plain: "plain", Env: "D4T_TEST_PASSWORD"}, "smtpsettings")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", password)
+
+	password, err = meta.ResolveSecret(Secret{Env: "D4T_TEST_PASSWORD"}, "smtpsettings")
+	assert.NoError(t, err)
+	assert.Equal(t, "from the environment", password)
+
+	password, err = meta.ResolveSecret(Secret{Name: "smtp"}, "smtpsettings")
+	assert.NoError(t, err)
+	assert.Equal(t, "from the store", password)
+
+	password, err = meta.ResolveSecret(Secret{}, "smtpsettings")
+	assert.NoError(t, err)
+	assert.Equal(t, "", password)
+
+	_, err = meta.ResolveSecret(Secret{Env: "D4T_TEST_MISSING"}, "smtpsettings")
+	assert.Error(t, err)
+
+	_, err = meta.ResolveSecret(Secret{Name: "imap"}, "imapsettings")
+	assert.Error(t, err)
+}
+
+func TestRunPasswordCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a posix shell")
+	}
+
+	password, err := RunPasswordCommand("printf 'hunter2\\nsecond line'")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", password)
+
+	_, err = RunPasswordCommand("exit 1")
+	assert.Error(t, err)
+
+	_, err = RunPasswordCommand("true")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFromWithPasswordAlternatives(t *testing.T) {
+	configPath := filepath.Join(testDirectory(t), "config.json")
+	err := ioutil.WriteFile(configPath, []byte(`{
+		"smtpsettings": {"password_command": "pass show mail"},
+		"imapsettings": {"password_env": "IMAP_PASSWORD"},
+		"pop3settings": {"password_secret": "pop3"}
+	}`), 0644)
+	assert.NoError(t, err)
+
+	config, err := LoadConfigFrom(configPath)
+	assert.NoError(t, err)
+
+	assert.Equal(t, Secret{Command: "pass show mail"}, config.Smtpsettings.Secret())
+	assert.Equal(t, Secret{Env: "IMAP_PASSWORD"}, config.Imapsettings.Secret())
+	assert.Equal(t, Secret{Name: "pop3"}, config.Pop3settings.Secret())
+	assert.False(t, config.HasPlainPasswords())
+}
+
+func TestLoadConfigFromWithStorage(t *testing.T) {
+	configPath := filepath.Join(testDirectory(t), "config.json")
+	err := ioutil.WriteFile(configPath, []byte(`{
+		"storage": [
+			{"type": "directory", "path": "/mnt/backups"},
+			{"type": "s3", "endpoint": "https://s3.example.com", "region": "eu-central-1", "bucket": "turns", "username": "access", "password_env": "S3_SECRET"}
+		],
+		"games": {"testgame": {"storage": [{"type": "sftp", "server": "backup.example.com", "username": "me", "password": "hunter2", "hostkey": "SHA256:abc"}]}}
+	}`), 0644)
+	assert.NoError(t, err)
+
+	config, err := LoadConfigFrom(configPath)
+	assert.NoError(t, err)
+
+	assert.Len(t, config.StorageFor("other"), 2)
+	assert.Equal(t, Secret{Env: "S3_SECRET"}, config.StorageFor("other")[1].Secret())
+	assert.Equal(t, "sftp", config.StorageFor("testgame")[0].Type)
+	assert.True(t, config.HasPlainPasswords())
+
+	os.Setenv("S3_SECRET", "secret")
+	defer os.Unsetenv("S3_SECRET")
+
+	meta := &Meta{Config: config}
+
+	storages, err := meta.BackupStorages("other")
+	assert.NoError(t, err)
+	assert.Equal(t, []game.BackupStorage{
+		game.DirectoryStorage{Path: "/mnt/backups"},
+		game.S3Storage{Endpoint: "https://s3.example.com", Region: "eu-central-1", Bucket: "turns", AccessKey: "access", SecretKey: "secret"},
+	}, storages)
+
+	meta.Config.Storage = []Storagesettings{{Type: "ftp"}}
+	_, err = meta.BackupStorages("other")
+	assert.Error(t, err)
+}
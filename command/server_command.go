@@ -0,0 +1,74 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ServerCommand struct {
+	*Meta
+
+	GameName    string
+	ProfileName string
+}
+
+// Show the server profile a game submits through, or assign a new one
+func (c *ServerCommand) run(*kingpin.ParseContext) error {
+	game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+	if err != nil {
+		return err
+	}
+
+	if c.ProfileName == "" {
+		profileName, profile, err := c.Meta.Config.ServerProfileFor(game.Name)
+		if err != nil {
+			return err
+		}
+
+		c.Ui.Output(fmt.Sprintf("%v submits through %v (%v)", game.Name, profileName, profile.To))
+		return nil
+	}
+
+	if _, err := c.Meta.Config.ServerProfile(c.ProfileName); err != nil {
+		return err
+	}
+
+	settings := c.Meta.Config.GameSettings(game.Name)
+	settings.Server = c.ProfileName
+
+	if c.Meta.Config.Games == nil {
+		c.Meta.Config.Games = make(map[string]Gamesettings)
+	}
+	c.Meta.Config.Games[strings.ToLower(game.Name)] = settings
+
+	err = WriteConfigTo(c.Meta.Config, c.Meta.RunContext.BaseConfigurationPath)
+	if err != nil {
+		return err
+	}
+
+	c.Ui.Output(fmt.Sprintf("%v now submits through %v", game.Name, c.ProfileName))
+
+	return nil
+}
+
+func (c *ServerCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureServerCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "server"
+	c := &ServerCommand{Meta: meta}
+	cmd := app.Command(commandName, "Show the server profile used to submit a game, or assign a server profile to it.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game").Required().StringVar(&c.GameName)
+		cmd.Arg("profile_name", "Name of the server profile to assign").StringVar(&c.ProfileName)
+	}
+
+	return commandName
+}
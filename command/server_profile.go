@@ -0,0 +1,127 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// The server profile used for games that have none assigned
+const DefaultServerProfileName = "llamaserver"
+
+// Server profiles that are available without configuring them. Profiles in the config with the same name take precedence.
+var BuiltinServerProfiles = map[string]Serverprofile{
+	"llamaserver": {
+		To:      "turns@llamaserver.net",
+		Subject: "{{.Game}} turn {{.Turn}}",
+	},
+}
+
+// TurnTemplateData is available in the subject, body and attachment templates of a server profile.
+// Example subject: {{.Game}} turn {{.Turn}}
+type TurnTemplateData struct {
+	Game string
+	Turn int
+	// File name of the 2h without extension, e.g. early_agartha
+	Nation string
+	// Display name of the nation, e.g. Agartha (Early Age). Empty if unknown.
+	NationName string
+	Filename   string
+}
+
+// TurnMessage is a rendered server profile, ready to be mailed
+type TurnMessage struct {
+	To             string
+	Subject        string
+	Body           string
+	AttachmentName string
+}
+
+// Find the settings for a game. Game names are case insensitive.
+func (config ConfigStruct) GameSettings(gameName string) Gamesettings {
+	for name, settings := range config.Games {
+		if strings.ToLower(name) == strings.ToLower(gameName) {
+			return settings
+		}
+	}
+
+	return Gamesettings{}
+}
+
+// Find a server profile by name, either from the config or the builtin profiles. Profile names are case insensitive.
+func (config ConfigStruct) ServerProfile(profileName string) (Serverprofile, error) {
+	for name, profile := range config.Servers {
+		if strings.ToLower(name) == strings.ToLower(profileName) {
+			return profile, nil
+		}
+	}
+
+	if profile, ok := BuiltinServerProfiles[strings.ToLower(profileName)]; ok {
+		return profile, nil
+	}
+
+	return Serverprofile{}, errors.New(fmt.Sprintf("No server profile called %v in config", profileName))
+}
+
+// Find the name of the server profile assigned to a game, and the profile itself
+func (config ConfigStruct) ServerProfileFor(gameName string) (string, Serverprofile, error) {
+	profileName := config.GameSettings(gameName).Server
+	if profileName == "" {
+		profileName = DefaultServerProfileName
+	}
+
+	profile, err := config.ServerProfile(profileName)
+
+	return profileName, profile, err
+}
+
+// Fill in the templates of this profile for a turn
+func (profile Serverprofile) Render(data TurnTemplateData) (TurnMessage, error) {
+	turnMessage := TurnMessage{To: profile.To}
+
+	if len(profile.To) == 0 {
+		return turnMessage, errors.New("no \"to\" set in server profile")
+	}
+
+	subject, err := renderTemplate("subject", profile.Subject, data)
+	if err != nil {
+		return turnMessage, err
+	}
+
+	body, err := renderTemplate("body", profile.Body, data)
+	if err != nil {
+		return turnMessage, err
+	}
+
+	// Without an attachment rule, the 2h file is sent under its own name
+	attachmentName := data.Filename
+	if profile.Attachment != "" {
+		attachmentName, err = renderTemplate("attachment", profile.Attachment, data)
+		if err != nil {
+			return turnMessage, err
+		}
+	}
+
+	turnMessage.Subject = subject
+	turnMessage.Body = body
+	turnMessage.AttachmentName = attachmentName
+
+	return turnMessage, nil
+}
+
+func renderTemplate(name string, text string, data TurnTemplateData) (string, error) {
+	parsedTemplate, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid %v template in server profile: %v", name, err.Error()))
+	}
+
+	var rendered bytes.Buffer
+	err = parsedTemplate.Execute(&rendered, data)
+	if err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
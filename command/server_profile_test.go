@@ -0,0 +1,87 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerProfileForDefaultsToLlamaserver(t *testing.T) {
+	config := ConfigStruct{}
+
+	profileName, profile, err := config.ServerProfileFor("testgame")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "llamaserver", profileName)
+	assert.Equal(t, "turns@llamaserver.net", profile.To)
+}
+
+func TestServerProfileForAssignedProfile(t *testing.T) {
+	config := ConfigStruct{
+		Servers: map[string]Serverprofile{"club": {To: "turns@club.example"}},
+		Games:   map[string]Gamesettings{"testgame": {Server: "club"}},
+	}
+
+	profileName, profile, err := config.ServerProfileFor("TestGame")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "club", profileName)
+	assert.Equal(t, "turns@club.example", profile.To)
+}
+
+func TestServerProfileForUnknownProfile(t *testing.T) {
+	config := ConfigStruct{Games: map[string]Gamesettings{"testgame": {Server: "nowhere"}}}
+
+	_, _, err := config.ServerProfileFor("testgame")
+
+	assert.Error(t, err)
+}
+
+func TestServerProfileRender(t *testing.T) {
+	profile := Serverprofile{To: "turns@club.example", Subject: "[{{.Game}}] {{.Nation}} turn {{.Turn}}", Body: "Orders for turn {{.Turn}}", Attachment: "{{.Game}}_{{.Filename}}"}
+
+	turnMessage, err := profile.Render(TurnTemplateData{Game: "testgame", Turn: 12, Nation: "early_agartha", Filename: "early_agartha.2h"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, TurnMessage{To: "turns@club.example", Subject: "[testgame] early_agartha turn 12", Body: "Orders for turn 12", AttachmentName: "testgame_early_agartha.2h"}, turnMessage)
+}
+
+func TestServerProfileRenderKeepsAttachmentName(t *testing.T) {
+	turnMessage, err := BuiltinServerProfiles["llamaserver"].Render(TurnTemplateData{Game: "testgame", Turn: 3, Filename: "early_agartha.2h"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "testgame turn 3", turnMessage.Subject)
+	assert.Equal(t, "early_agartha.2h", turnMessage.AttachmentName)
+}
+
+func TestServerProfileRenderInvalidTemplate(t *testing.T) {
+	profile := Serverprofile{To: "turns@club.example", Subject: "{{.Gaem}}"}
+
+	_, err := profile.Render(TurnTemplateData{Game: "testgame"})
+
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFromWithServerProfiles(t *testing.T) {
+	directory, err := ioutil.TempDir("", "dom4tools")
+	assert.NoError(t, err)
+	defer os.RemoveAll(directory)
+
+	configPath := filepath.Join(directory, "config.json")
+	err = WriteConfigTo(ConfigStruct{
+		Submitstyle: "smtp",
+		Servers:     map[string]Serverprofile{"club": {To: "turns@club.example", Subject: "{{.Game}}"}},
+		Games:       map[string]Gamesettings{"testgame": {Server: "club"}},
+	}, configPath)
+	assert.NoError(t, err)
+
+	config, err := LoadConfigFrom(configPath)
+	assert.NoError(t, err)
+
+	_, profile, err := config.ServerProfileFor("testgame")
+	assert.NoError(t, err)
+	assert.Equal(t, "turns@club.example", profile.To)
+}
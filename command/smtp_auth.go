@@ -0,0 +1,77 @@
+package command
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+)
+
+// The SMTP LOGIN mechanism. Not standardized, but still the only thing some servers (and Outlook) speak.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func LoginAuth(username string, password string, host string) smtp.Auth {
+	return &loginAuth{username: username, password: password, host: host}
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Same rule as smtp.PlainAuth: never send the password in the clear, except to localhost
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection, refusing to send password")
+	}
+
+	if server.Name != auth.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(auth.username), nil
+	case "password:":
+		return []byte(auth.password), nil
+	default:
+		return nil, errors.New("unexpected server challenge: " + string(fromServer))
+	}
+}
+
+// The SMTP XOAUTH2 mechanism, as used by Gmail and Outlook.com. The password is the OAuth2 access token.
+type xoauth2Auth struct {
+	username string
+	token    string
+}
+
+func XOAuth2Auth(username string, token string) smtp.Auth {
+	return &xoauth2Auth{username: username, token: token}
+}
+
+func (auth *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection, refusing to send access token")
+	}
+
+	return "XOAUTH2", []byte("user=" + auth.username + "\x01auth=Bearer " + auth.token + "\x01\x01"), nil
+}
+
+func (auth *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	// On failure, the server sends a JSON error and expects an empty response before it fails the command
+	if more {
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -3,8 +3,11 @@ package command
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/promisedlandt/dom4tools/game"
+	"github.com/promisedlandt/dom4tools/utility"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -14,28 +17,45 @@ type SubmitCommand struct {
 
 	Resubmit   bool
 	SkipBackup bool
-	GameName   string
-	TurnNumber int
-	Game       *game.Game
-	SmtpConfig SmtpConfig
+	Defer      bool
+	// Submit without asking, even if the orders look stale
+	Yes bool
+	// Wait for the server to acknowledge the submission
+	WaitReceipt    bool
+	ReceiptTimeout time.Duration
+	GameName       string
+	Nation         string
+	TurnNumber     int
+	Game           *game.Game
+	Submission     TurnSubmission
 }
 
 // Submits the given game
 func (c *SubmitCommand) run(parseContext *kingpin.ParseContext) error {
 	if c.Game == nil {
-		game, err := c.Meta.RunContext.GameInstallation.AvailableGames.FindGameByName(c.GameName)
+		game, err := c.Meta.FindGame(c.GameName, c.Nation)
 		if err != nil {
 			return err
 		}
 
-		c.Game = &game
+		c.Game = game
+	}
+
+	err := c.Meta.UseAccountFor(c.Game.Name)
+	if err != nil {
+		return err
 	}
 
 	if c.TurnNumber <= 0 {
-		c.TurnNumber = c.Game.CurrentTurnNumber()
+		if turnNumber, ok := c.Game.HeaderTurnNumber(); ok {
+			c.TurnNumber = turnNumber
+		} else {
+			c.TurnNumber = c.Game.CurrentTurnNumber()
 
-		if c.Resubmit {
-			c.TurnNumber--
+			// Guessing from the backups, the turn we resubmit is already backed up
+			if c.Resubmit {
+				c.TurnNumber--
+			}
 		}
 	}
 
@@ -43,49 +63,215 @@ func (c *SubmitCommand) run(parseContext *kingpin.ParseContext) error {
 		return errors.New(fmt.Sprintf("No turn set to submit, try: d4t submit %v TURN_NUMBER", c.Game.Name))
 	}
 
+	// Check the config before backing anything up
+	submitter, err := c.Meta.ConfiguredSubmitter()
+	if err != nil {
+		return err
+	}
+
+	_, canQueue := submitter.(RawSubmitter)
+	if c.Defer && !canQueue {
+		return errors.New(fmt.Sprintf("Submitstyle %v can't queue submissions in the outbox", c.Meta.Config.Submitstyle))
+	}
+
+	if c.Defer && c.WaitReceipt {
+		return errors.New("Can't wait for a receipt of a deferred submission")
+	}
+
+	// This has to happen before the backup, which would make the orders look like the ones of the current turn
+	proceed, err := c.confirmOrders()
+	if err != nil {
+		return err
+	}
+
+	if !proceed {
+		return errors.New("Not submitting")
+	}
+
 	if !c.SkipBackup {
 		backupCommand := BackupCommand{Meta: c.Meta, Game: c.Game, TurnNumber: c.TurnNumber, Force: c.Resubmit}
-		err := backupCommand.run(parseContext)
+		err = backupCommand.run(parseContext)
 		if err != nil {
 			return err
 		}
 	}
 
-	switch c.Meta.Config.Submitstyle {
-	case "smtp":
-		if len(c.Meta.Config.Smtpsettings.From) == 0 {
-			return errors.New("no \"from\" set in smtpsettings")
-		}
+	serverName, serverProfile, err := c.Meta.Config.ServerProfileFor(c.Game.Name)
+	if err != nil {
+		return err
+	}
 
-		if len(c.Meta.Config.Smtpsettings.Port) == 0 {
-			return errors.New("no port set in smtpsettings")
-		}
+	templateData := TurnTemplateData{Game: c.Game.Name, Turn: c.TurnNumber, Nation: strings.TrimSuffix(c.Game.TwohFile.Filename, ".2h"), Filename: c.Game.TwohFile.Filename}
+	if nation, ok := c.Game.Nation(); ok {
+		templateData.NationName = nation.String()
+	}
+	turnMessage, err := serverProfile.Render(templateData)
+	if err != nil {
+		return err
+	}
+
+	c.Submission = TurnSubmission{Account: c.Meta.Account(), GameName: c.Game.Name, TurnNumber: c.TurnNumber, To: turnMessage.To, From: c.Meta.Config.Smtpsettings.From, Subject: turnMessage.Subject, Body: turnMessage.Body, AttachmentPath: c.Game.TwohFile.Fullpath, AttachmentName: turnMessage.AttachmentName}
+
+	// Only mails we build ourselves carry a Message-ID we know, receipts for the others are matched by game
+	if canQueue {
+		c.Submission.MessageId = NewMessageId(c.Meta.Config.Smtpsettings.From)
+	}
+
+	outbox := Outbox{Path: c.Meta.OutboxPath()}
 
-		if len(c.Meta.Config.Smtpsettings.Server) == 0 {
-			return errors.New("no server set in smtpsettings")
+	if c.Defer {
+		entry, err := outbox.Enqueue(c.Submission, nil)
+		if err != nil {
+			return err
 		}
 
-		if len(c.Meta.Config.Smtpsettings.Username) == 0 {
-			return errors.New("no username set in smtpsettings")
+		c.Ui.Output(fmt.Sprintf("Queued game %s, turn %v as %v, send it with: d4t outbox flush", c.Game.Name, c.TurnNumber, entry.Id))
+		return nil
+	}
+
+	c.Ui.Output(fmt.Sprintf("Submitting game %s, turn %v to %v (%v) via %v", c.Game.Name, c.TurnNumber, serverName, turnMessage.To, c.Meta.Config.Submitstyle))
+
+	err = submitter.Submit(c.Submission)
+	if err != nil {
+		if !canQueue || !IsTemporarySubmitError(err) {
+			return err
 		}
 
-		if len(c.Meta.Config.Smtpsettings.Password) == 0 {
-			return errors.New("no password set in smtpsettings")
+		entry, queueErr := outbox.Enqueue(c.Submission, err)
+		if queueErr != nil {
+			return err
 		}
 
-		c.SmtpConfig = SmtpConfig{To: "turns@llamaserver.net", From: c.Meta.Config.Smtpsettings.From, Port: c.Meta.Config.Smtpsettings.Port, Server: c.Meta.Config.Smtpsettings.Server, Username: c.Meta.Config.Smtpsettings.Username, Password: c.Meta.Config.Smtpsettings.Password, Subject: fmt.Sprintf("%v turn %v", c.Game.Name, c.TurnNumber), Body: "", AttachmentPath: c.Game.TwohFile.Fullpath}
+		c.Ui.Warn(fmt.Sprintf("Could not submit: %v", err.Error()))
+		c.Ui.Warn(fmt.Sprintf("Queued as %v, retry with: d4t outbox flush", entry.Id))
+		return nil
+	}
+
+	submissionLog := SubmissionLog{Path: c.Meta.SubmissionLogPath()}
+
+	record, err := submissionLog.Record(c.Submission)
+	if err != nil {
+		c.Ui.Warn(fmt.Sprintf("Could not record submission: %v", err.Error()))
+	}
 
-		c.Ui.Output(fmt.Sprintf("Submitting game %s, turn %v", c.Game.Name, c.TurnNumber))
+	// We're obviously online, so this is a good time to send whatever is waiting in the outbox
+	if canQueue {
+		c.flushOutbox(outbox, c.Meta.RawSubmitterFor, submissionLog)
+	}
+
+	if c.WaitReceipt {
+		return c.waitForReceipt(submissionLog, record)
+	}
+
+	return nil
+}
+
+// Warn if the orders look stale or were already submitted, and ask whether to submit anyway
+func (c *SubmitCommand) confirmOrders() (bool, error) {
+	if c.Game.TwohFile.Fullpath == "" {
+		return false, errors.New(fmt.Sprintf("No 2h file found for %v", c.Game.Name))
+	}
+
+	warnings, err := c.Game.StaleOrdersWarnings(c.TurnNumber)
+	if err != nil {
+		return false, err
+	}
 
-		err := c.SmtpConfig.SubmitTurnBuiltin()
+	twohHash, err := utility.Sha256File(c.Game.TwohFile.Fullpath)
+	if err != nil {
+		return false, err
+	}
+
+	submissionLog := SubmissionLog{Path: c.Meta.SubmissionLogPath()}
+
+	record, found, err := submissionLog.FindSubmittedOrders(c.Game.Name, twohHash)
+	if err != nil {
+		return false, err
+	}
+
+	if found {
+		warnings = append(warnings, fmt.Sprintf("These orders were already submitted for turn %v on %v", record.TurnNumber, record.Submitted.Format(time.RFC822)))
+	}
+
+	if len(warnings) == 0 {
+		return true, nil
+	}
+
+	for _, warning := range warnings {
+		c.Ui.Warn(warning)
+	}
+
+	if c.Yes {
+		return true, nil
+	}
+
+	answer, err := c.Ui.Ask("Submit anyway? [y/N]")
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes", nil
+}
+
+// Poll for the server's receipt until it arrives, the submission bounces, or we time out
+func (c *SubmitCommand) waitForReceipt(submissionLog SubmissionLog, submitted SubmissionRecord) error {
+	c.Ui.Output(fmt.Sprintf("Waiting up to %v for the receipt", c.ReceiptTimeout))
+
+	deadline := time.Now().Add(c.ReceiptTimeout)
+
+	for {
+		_, err := c.Meta.CheckReceipts()
 		if err != nil {
 			return err
 		}
-	default:
-		return errors.New("No submitstyle set in config")
+
+		record, found, err := submissionLog.FindRecord(submitted)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("Submission of game %v, turn %v is not in %v", submitted.GameName, submitted.TurnNumber, submissionLog.Path))
+		}
+
+		switch record.Status {
+		case ReceiptConfirmed:
+			c.Ui.Output(fmt.Sprintf("Server confirmed game %v, turn %v: %v", record.GameName, record.TurnNumber, record.Detail))
+			return nil
+		case ReceiptFailed:
+			return errors.New(fmt.Sprintf("Submission of game %v, turn %v failed: %v", record.GameName, record.TurnNumber, record.Detail))
+		}
+
+		if time.Now().Add(ReceiptPollInterval).After(deadline) {
+			return errors.New(fmt.Sprintf("No receipt for game %v, turn %v after %v, check later with: d4t receipts", record.GameName, record.TurnNumber, c.ReceiptTimeout))
+		}
+
+		time.Sleep(ReceiptPollInterval)
 	}
+}
 
-	return nil
+// Send what is waiting in the outbox after a direct submission, except older queued copies of the orders just sent
+func (c *SubmitCommand) flushOutbox(outbox Outbox, submitterFor func(account string) (RawSubmitter, error), submissionLog SubmissionLog) {
+	err := outbox.DropSubmission(c.Submission)
+	if err != nil {
+		c.Ui.Warn(fmt.Sprintf("Could not drop queued submission: %v", err.Error()))
+	}
+
+	sent, _, err := outbox.Flush(submitterFor, false)
+	if err != nil {
+		c.Ui.Warn(fmt.Sprintf("Could not flush outbox: %v", err.Error()))
+	}
+
+	for _, entry := range sent {
+		c.Ui.Output(fmt.Sprintf("Sent queued game %v, turn %v", entry.Submission.GameName, entry.Submission.TurnNumber))
+
+		_, err = submissionLog.Record(entry.Submission)
+		if err != nil {
+			c.Ui.Warn(fmt.Sprintf("Could not record submission: %v", err.Error()))
+		}
+	}
 }
 
 func (c *SubmitCommand) completion(parseContext *kingpin.ParseContext) error {
@@ -102,7 +288,12 @@ func ConfigureSubmitCommand(app *kingpin.Application, meta *Meta) (commandName s
 	} else {
 		cmd.Arg("game_name", "Name of the game to submit").Required().StringVar(&c.GameName)
 		cmd.Arg("turn_number", "Submit which turn? Needed for backup").IntVar(&c.TurnNumber)
+		cmd.Flag("nation", "which nation, for games with several nations in one directory").StringVar(&c.Nation)
 		cmd.Flag("skip-backup", "don't back up").Short('b').BoolVar(&c.SkipBackup)
+		cmd.Flag("yes", "don't ask for confirmation if the orders look stale").Short('y').BoolVar(&c.Yes)
+		cmd.Flag("defer", "queue in the outbox instead of sending right away").BoolVar(&c.Defer)
+		cmd.Flag("wait-receipt", "wait until the server confirms the turn").BoolVar(&c.WaitReceipt)
+		cmd.Flag("receipt-timeout", "how long to wait for the receipt").Default("15m").DurationVar(&c.ReceiptTimeout)
 		cmd.Action(c.run)
 	}
 
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/promisedlandt/dom4tools/game"
+	"github.com/stretchr/testify/assert"
+)
+
+// An installation with orders for testgame waiting to be submitted
+func testSubmitMeta(t *testing.T, config ConfigStruct) *Meta {
+	basePath := testDirectory(t)
+	gameDirectory := filepath.Join(basePath, "savedgames", "testgame")
+	assert.NoError(t, os.MkdirAll(gameDirectory, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, "early_ulm.trn"), []byte("turn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gameDirectory, "early_ulm.2h"), []byte("orders"), 0644))
+
+	config.Smtpsettings.From = "me@example.com"
+
+	return &Meta{Ui: cli.NewMockUi(), Config: config, RunContext: &RunContext{BaseConfigurationPath: filepath.Join(basePath, "config.json"), GameInstallation: *game.NewGameInstallation(basePath)}}
+}
+
+func TestSubmitRecordsMessageIdOnlyWhenSent(t *testing.T) {
+	meta := testSubmitMeta(t, ConfigStruct{Submitstyle: "command", Commandsettings: Commandsettings{Command: "true"}})
+
+	c := SubmitCommand{Meta: meta, GameName: "testgame", TurnNumber: 1}
+	assert.NoError(t, c.run(nil))
+	assert.Empty(t, c.Submission.MessageId)
+
+	records, err := (&SubmissionLog{Path: meta.SubmissionLogPath()}).Records()
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Empty(t, records[0].MessageId)
+
+	// sendmail gets the complete mail, Message-ID included
+	mailPath := filepath.Join(testDirectory(t), "mail")
+	sendmail := filepath.Join(testDirectory(t), "sendmail")
+	assert.NoError(t, ioutil.WriteFile(sendmail, []byte("#!/bin/sh\ncat > "+mailPath+"\n"), 0755))
+
+	meta = testSubmitMeta(t, ConfigStruct{Submitstyle: "sendmail", Sendmailsettings: Sendmailsettings{Path: sendmail}})
+
+	c = SubmitCommand{Meta: meta, GameName: "testgame", TurnNumber: 1}
+	assert.NoError(t, c.run(nil))
+	assert.NotEmpty(t, c.Submission.MessageId)
+
+	mail, err := ioutil.ReadFile(mailPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(mail), c.Submission.MessageId)
+
+	record, found, err := (&SubmissionLog{Path: meta.SubmissionLogPath()}).Find(c.Submission.MessageId)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, record.TurnNumber)
+}
@@ -0,0 +1,269 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Submitter hands a turn over to the game server, or to whatever takes care of that
+type Submitter interface {
+	Submit(submission TurnSubmission) error
+}
+
+// RawSubmitter can also send a complete mail as is. Only those can be used with the outbox.
+type RawSubmitter interface {
+	Submitter
+	SubmitRaw(from string, to string, message io.WriterTo) error
+}
+
+// Submits with the builtin SMTP client
+type SmtpSubmitter struct {
+	SmtpConfig SmtpConfig
+}
+
+// Submits by shelling out to mailsend
+type MailsendSubmitter struct {
+	SmtpConfig SmtpConfig
+}
+
+// Submits through the local MTA, by piping the mail into sendmail -t
+type SendmailSubmitter struct {
+	Path string
+}
+
+// Submits by running an arbitrary command.
+// The command gets the 2h path, game name and turn number as its last arguments, and as D4T_* environment variables.
+type CommandSubmitter struct {
+	Command string
+	Args    []string
+}
+
+// Submits by copying the 2h file into a folder per game inside the drop folder,
+// e.g. one that is synced to the machine that actually mails the turns
+type DropfolderSubmitter struct {
+	Path string
+}
+
+// Create the submitter for the submitstyle in the config
+func NewSubmitter(config ConfigStruct) (Submitter, error) {
+	switch config.Submitstyle {
+	case "smtp":
+		smtpConfig := SmtpConfig{Port: config.Smtpsettings.Port, Server: config.Smtpsettings.Server, Username: config.Smtpsettings.Username, Password: config.Smtpsettings.Password, Security: config.Smtpsettings.Security, Auth: config.Smtpsettings.Auth, CaFile: config.Smtpsettings.Cafile, PinnedCert: config.Smtpsettings.Pinnedcert}
+
+		err := smtpConfig.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		return SmtpSubmitter{SmtpConfig: smtpConfig}, nil
+	case "mailsend":
+		if len(config.Smtpsettings.Port) == 0 {
+			return nil, errors.New("no port set in smtpsettings")
+		}
+
+		if len(config.Smtpsettings.Server) == 0 {
+			return nil, errors.New("no server set in smtpsettings")
+		}
+
+		if len(config.Smtpsettings.Username) == 0 {
+			return nil, errors.New("no username set in smtpsettings")
+		}
+
+		// mailsend asks for the password itself if there is none
+		return MailsendSubmitter{SmtpConfig: SmtpConfig{Port: config.Smtpsettings.Port, Server: config.Smtpsettings.Server, Username: config.Smtpsettings.Username, Password: config.Smtpsettings.Password}}, nil
+	case "sendmail":
+		sendmailPath := config.Sendmailsettings.Path
+		if sendmailPath == "" {
+			sendmailPath = "sendmail"
+		}
+
+		return SendmailSubmitter{Path: sendmailPath}, nil
+	case "command":
+		if len(config.Commandsettings.Command) == 0 {
+			return nil, errors.New("no command set in commandsettings")
+		}
+
+		command, err := homedir.Expand(config.Commandsettings.Command)
+		if err != nil {
+			return nil, err
+		}
+
+		return CommandSubmitter{Command: command, Args: config.Commandsettings.Args}, nil
+	case "dropfolder":
+		if len(config.Dropfoldersettings.Path) == 0 {
+			return nil, errors.New("no path set in dropfoldersettings")
+		}
+
+		dropfolderPath, err := homedir.Expand(config.Dropfoldersettings.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return DropfolderSubmitter{Path: dropfolderPath}, nil
+	default:
+		return nil, errors.New("No submitstyle set in config")
+	}
+}
+
+// Create the submitter for the submitstyle in the config, with its password resolved
+func (m *Meta) ConfiguredSubmitter() (Submitter, error) {
+	return m.submitterFrom(m.Config)
+}
+
+// Create the submitter for an account profile, for sending queued messages.
+// Fails if the submitstyle can't send complete messages.
+func (m *Meta) RawSubmitterFor(account string) (RawSubmitter, error) {
+	config, err := m.globalConfig().WithAccount(account)
+	if err != nil {
+		return nil, err
+	}
+
+	submitter, err := m.submitterFrom(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rawSubmitter, ok := submitter.(RawSubmitter)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Submitstyle %v can't send queued submissions", config.Submitstyle))
+	}
+
+	return rawSubmitter, nil
+}
+
+func (m *Meta) submitterFrom(config ConfigStruct) (Submitter, error) {
+	if config.Submitstyle == "smtp" || config.Submitstyle == "mailsend" {
+		password, err := m.ResolveSecret(config.Smtpsettings.Secret(), "smtpsettings")
+		if err != nil {
+			return nil, err
+		}
+
+		config.Smtpsettings.Password = password
+	}
+
+	return NewSubmitter(config)
+}
+
+// A submission needs a sender for every style that actually sends mail
+func (submission TurnSubmission) validateSender() error {
+	if len(submission.From) == 0 {
+		return errors.New("no \"from\" set in smtpsettings")
+	}
+
+	return nil
+}
+
+func (submitter SmtpSubmitter) Submit(submission TurnSubmission) error {
+	if err := submission.validateSender(); err != nil {
+		return err
+	}
+
+	return submitter.SmtpConfig.SubmitTurnBuiltin(submission)
+}
+
+func (submitter SmtpSubmitter) SubmitRaw(from string, to string, message io.WriterTo) error {
+	return submitter.SmtpConfig.Send(from, to, message)
+}
+
+func (submitter MailsendSubmitter) Submit(submission TurnSubmission) error {
+	if err := submission.validateSender(); err != nil {
+		return err
+	}
+
+	return submitter.SmtpConfig.SubmitTurnMailsend(submission)
+}
+
+func (submitter SendmailSubmitter) Submit(submission TurnSubmission) error {
+	if err := submission.validateSender(); err != nil {
+		return err
+	}
+
+	return submitter.SubmitRaw(submission.From, submission.To, submission.Message())
+}
+
+// sendmail -t takes the recipients from the mail itself, so from and to are only there to satisfy RawSubmitter
+func (submitter SendmailSubmitter) SubmitRaw(from string, to string, message io.WriterTo) error {
+	// -i keeps lines with a single dot from ending the mail
+	cmd := exec.Command(submitter.Path, "-t", "-i")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Could not run %v: %v", submitter.Path, err.Error()))
+	}
+
+	_, err = message.WriteTo(stdin)
+	stdin.Close()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return waitWithTimeout(cmd, 30*time.Second)
+}
+
+func (submitter CommandSubmitter) Submit(submission TurnSubmission) error {
+	args := append(append([]string{}, submitter.Args...), submission.AttachmentPath, submission.GameName, strconv.Itoa(submission.TurnNumber))
+
+	cmd := exec.Command(submitter.Command, args...)
+	cmd.Env = append(os.Environ(),
+		"D4T_2H_PATH="+submission.AttachmentPath,
+		"D4T_ATTACHMENT_NAME="+submission.AttachmentName,
+		"D4T_GAME="+submission.GameName,
+		"D4T_TURN="+strconv.Itoa(submission.TurnNumber),
+		"D4T_TO="+submission.To,
+		"D4T_FROM="+submission.From,
+		"D4T_SUBJECT="+submission.Subject,
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return errors.New(fmt.Sprintf("%v failed: %v", submitter.Command, err.Error()))
+	}
+
+	return nil
+}
+
+func (submitter DropfolderSubmitter) Submit(submission TurnSubmission) error {
+	if !utility.FileExists(submitter.Path) {
+		return errors.New(fmt.Sprintf("Drop folder %v does not exist", submitter.Path))
+	}
+
+	filename := submission.AttachmentName
+	if filename == "" {
+		filename = submission.AttachmentPath
+	}
+
+	// The name comes from a template, and must not lead out of the drop folder
+	filename = filepath.Base(filename)
+	if filename == "." || filename == ".." || filename == string(filepath.Separator) {
+		return errors.New(fmt.Sprintf("Invalid attachment name %v", submission.AttachmentName))
+	}
+
+	gameFolder := filepath.Join(submitter.Path, submission.GameName)
+	err := os.MkdirAll(gameFolder, 0755)
+	if err != nil {
+		return err
+	}
+
+	return utility.Cp(submission.AttachmentPath, filepath.Join(gameFolder, filename))
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDirectory(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "dom4tools")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	return directory
+}
+
+// A submission with an actual 2h file to attach
+func testSubmission(t *testing.T) TurnSubmission {
+	twohPath := filepath.Join(testDirectory(t), "early_agartha.2h")
+	assert.NoError(t, ioutil.WriteFile(twohPath, []byte("orders"), 0644))
+
+	return TurnSubmission{GameName: "testgame", TurnNumber: 7, To: "turns@llamaserver.net", From: "me@example.com", Subject: "testgame turn 7", AttachmentPath: twohPath}
+}
+
+func TestNewSubmitter(t *testing.T) {
+	smtpsettings := Smtpsettings{From: "me@example.com", Server: "smtp.example.com", Port: "587", Username: "me", Password: "secret"}
+
+	submitter, err := NewSubmitter(ConfigStruct{Submitstyle: "smtp", Smtpsettings: smtpsettings})
+	assert.NoError(t, err)
+	assert.IsType(t, SmtpSubmitter{}, submitter)
+
+	submitter, err = NewSubmitter(ConfigStruct{Submitstyle: "mailsend", Smtpsettings: smtpsettings})
+	assert.NoError(t, err)
+	assert.IsType(t, MailsendSubmitter{}, submitter)
+
+	submitter, err = NewSubmitter(ConfigStruct{Submitstyle: "sendmail"})
+	assert.NoError(t, err)
+	assert.Equal(t, SendmailSubmitter{Path: "sendmail"}, submitter)
+
+	submitter, err = NewSubmitter(ConfigStruct{Submitstyle: "command", Commandsettings: Commandsettings{Command: "/usr/local/bin/send-turn"}})
+	assert.NoError(t, err)
+	assert.Equal(t, CommandSubmitter{Command: "/usr/local/bin/send-turn"}, submitter)
+
+	submitter, err = NewSubmitter(ConfigStruct{Submitstyle: "dropfolder", Dropfoldersettings: Dropfoldersettings{Path: "/srv/turns"}})
+	assert.NoError(t, err)
+	assert.Equal(t, DropfolderSubmitter{Path: "/srv/turns"}, submitter)
+}
+
+func TestNewSubmitterValidation(t *testing.T) {
+	_, err := NewSubmitter(ConfigStruct{})
+	assert.Error(t, err)
+
+	_, err = NewSubmitter(ConfigStruct{Submitstyle: "smtp", Smtpsettings: Smtpsettings{Server: "smtp.example.com", Port: "587", Username: "me"}})
+	assert.Error(t, err)
+
+	_, err = NewSubmitter(ConfigStruct{Submitstyle: "command"})
+	assert.Error(t, err)
+
+	_, err = NewSubmitter(ConfigStruct{Submitstyle: "dropfolder"})
+	assert.Error(t, err)
+}
+
+func TestDropfolderSubmitter(t *testing.T) {
+	submission := testSubmission(t)
+	submission.AttachmentName = "testgame_early_agartha.2h"
+	dropfolder := testDirectory(t)
+
+	err := DropfolderSubmitter{Path: dropfolder}.Submit(submission)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dropfolder, "testgame", "testgame_early_agartha.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", string(data))
+}
+
+func TestDropfolderSubmitterStaysInFolder(t *testing.T) {
+	submission := testSubmission(t)
+	submission.AttachmentName = "../../outside.2h"
+	dropfolder := filepath.Join(testDirectory(t), "drop")
+	assert.NoError(t, os.Mkdir(dropfolder, 0755))
+
+	err := DropfolderSubmitter{Path: dropfolder}.Submit(submission)
+	assert.NoError(t, err)
+	assert.True(t, utility.FileExists(filepath.Join(dropfolder, "testgame", "outside.2h")))
+	assert.False(t, utility.FileExists(filepath.Join(dropfolder, "..", "outside.2h")))
+
+	submission.AttachmentName = ".."
+	assert.Error(t, DropfolderSubmitter{Path: dropfolder}.Submit(submission))
+}
+
+func TestDropfolderSubmitterWithoutFolder(t *testing.T) {
+	err := DropfolderSubmitter{Path: filepath.Join(testDirectory(t), "missing")}.Submit(testSubmission(t))
+
+	assert.Error(t, err)
+}
+
+func TestCommandSubmitter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a posix shell")
+	}
+
+	submission := testSubmission(t)
+	outputPath := filepath.Join(testDirectory(t), "output")
+
+	submitter := CommandSubmitter{Command: "/bin/sh", Args: []string{"-c", `echo "$1 $2 $3 $D4T_GAME $D4T_TURN" > ` + outputPath, "sh"}}
+	err := submitter.Submit(submission)
+	assert.NoError(t, err)
+
+	output, err := ioutil.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Equal(t, submission.AttachmentPath+" testgame 7 testgame 7\n", string(output))
+}
+
+func TestSendmailSubmitter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a posix shell")
+	}
+
+	directory := testDirectory(t)
+	outputPath := filepath.Join(directory, "mail")
+	sendmailPath := filepath.Join(directory, "sendmail")
+	assert.NoError(t, ioutil.WriteFile(sendmailPath, []byte("#!/bin/sh\necho \"$@\" > "+outputPath+".args\ncat > "+outputPath+"\n"), 0755))
+
+	err := SendmailSubmitter{Path: sendmailPath}.Submit(testSubmission(t))
+	assert.NoError(t, err)
+
+	args, err := ioutil.ReadFile(outputPath + ".args")
+	assert.NoError(t, err)
+	assert.Equal(t, "-t -i\n", string(args))
+
+	mail, err := ioutil.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(mail), "To: turns@llamaserver.net")
+	assert.Contains(t, string(mail), "Subject: testgame turn 7")
+	assert.Contains(t, string(mail), `filename="early_agartha.2h"`)
+}
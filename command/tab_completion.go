@@ -8,7 +8,7 @@ type TabCompletable interface {
 
 // Tab completion with all games we can find
 func completionWithGames(meta *Meta, parseContext *kingpin.ParseContext) error {
-	listCommand := &ListCommand{Meta: meta}
+	listCommand := &ListCommand{Meta: meta, NamesOnly: true}
 	return listCommand.run(parseContext)
 }
 
@@ -1,41 +1,111 @@
 package command
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
 	"os"
 	"os/exec"
-	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/go-homedir"
+	"github.com/promisedlandt/dom4tools/utility"
 	"gopkg.in/gomail.v2"
 )
 
-type SmtpConfig struct {
+// TurnSubmission is a single turn, ready to be handed to a Submitter
+type TurnSubmission struct {
+	MessageId string
+	// Account profile the submission is sent with, empty for the top level settings
+	Account        string
+	GameName       string
+	TurnNumber     int
 	To             string
 	From           string
-	Port           string
-	Server         string
 	Subject        string
 	Body           string
-	Username       string
-	Password       string
 	AttachmentPath string
+	AttachmentName string
+}
+
+type SmtpConfig struct {
+	Port       string
+	Server     string
+	Username   string
+	Password   string
+	Security   string
+	Auth       string
+	CaFile     string
+	PinnedCert string
+}
+
+// Transport security modes for the builtin SMTP client
+var SmtpSecurityModes = []string{"starttls", "starttls-required", "tls", "none"}
+
+// Authentication mechanisms for the builtin SMTP client
+var SmtpAuthMechanisms = []string{"plain", "login", "cram-md5", "xoauth2", "none"}
+
+// Build the mail for a turn submission, dated now
+func (submission TurnSubmission) Message() *gomail.Message {
+	message := gomail.NewMessage()
+	if submission.MessageId != "" {
+		message.SetHeader("Message-ID", submission.MessageId)
+	}
+	message.SetDateHeader("Date", time.Now())
+	message.SetHeader("From", submission.From)
+	message.SetHeader("To", submission.To)
+	message.SetHeader("Subject", submission.Subject)
+	message.SetBody("text/plain", submission.Body)
+
+	if submission.AttachmentName != "" {
+		message.Attach(submission.AttachmentPath, gomail.Rename(submission.AttachmentName))
+	} else {
+		message.Attach(submission.AttachmentPath)
+	}
+
+	return message
+}
+
+// Create a new, globally unique Message-ID for a mail from the given sender
+func NewMessageId(from string) string {
+	random := make([]byte, 12)
+	rand.Read(random)
+
+	domain := "dom4tools.invalid"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = strings.Trim(from[at+1:], "<> ")
+	}
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().Unix(), hex.EncodeToString(random), domain)
 }
 
 // Submit the turn by shelling out to mailsend
-func (mailConfig SmtpConfig) SubmitTurnMailsend() error {
-	// export SMTP_USER_PASS=password
+func (mailConfig SmtpConfig) SubmitTurnMailsend(submission TurnSubmission) error {
 	cmdName := "mailsend"
 	err := exec.Command(cmdName, "-V").Run()
 	if err != nil {
-		return errors.New("Could not find 'mailsend'. Please see TODO")
+		return errors.New("Could not find 'mailsend'. Please install it from https://github.com/muquit/mailsend and place it in your $PATH")
 	}
 
-	cmdArgs := []string{"-to", mailConfig.To, "-from", mailConfig.From, "-starttls", "-port", mailConfig.Port, "-auth", "-smtp", mailConfig.Server, "-sub", mailConfig.Subject, "+cc", "+bc", "-user", mailConfig.Username, "-M", " ", "-mime-type", "application/octet-stream", "-attach", mailConfig.AttachmentPath}
+	cmdArgs := []string{"-to", submission.To, "-from", submission.From, "-starttls", "-port", mailConfig.Port, "-auth", "-smtp", mailConfig.Server, "-sub", submission.Subject, "+cc", "+bc", "-user", mailConfig.Username, "-M", " ", "-mime-type", "application/octet-stream", "-attach", submission.AttachmentPath}
 
 	cmd := exec.Command(cmdName, cmdArgs...)
 
+	// mailsend reads the password from the environment, and asks for it if it isn't set
+	cmd.Env = os.Environ()
+	if mailConfig.Password != "" {
+		cmd.Env = append(cmd.Env, "SMTP_USER_PASS="+mailConfig.Password)
+	}
+
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stdout
 	cmd.Stdout = os.Stdout
@@ -45,44 +115,264 @@ func (mailConfig SmtpConfig) SubmitTurnMailsend() error {
 		return errors.New(fmt.Sprintf("Failed to send mail: %v", err.Error()))
 	}
 
-	cmdDone := make(chan error, 1)
-	go func() {
-		cmdDone <- cmd.Wait()
-	}()
+	return waitWithTimeout(cmd, 10*time.Second)
+}
 
-	select {
-	case <-time.After(10 * time.Second):
-		if err := cmd.Process.Kill(); err != nil {
-			return errors.New(fmt.Sprintf("Timeout while sending mail: %s", err.Error()))
+// Submit the turn by using a builtin mailer
+func (mailConfig SmtpConfig) SubmitTurnBuiltin(submission TurnSubmission) error {
+	return mailConfig.Send(submission.From, submission.To, submission.Message())
+}
+
+// Send a complete mail with the builtin mailer
+func (mailConfig SmtpConfig) Send(from string, to string, message io.WriterTo) error {
+	client, err := mailConfig.dial()
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	auth, err := mailConfig.auth()
+	if err != nil {
+		return err
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New(fmt.Sprintf("%v does not support authentication, try auth \"none\" in smtpsettings", mailConfig.Server))
 		}
-		<-cmdDone
-	case err = <-cmdDone:
+
+		err = client.Auth(auth)
 		if err != nil {
-			return errors.New(fmt.Sprintf("Failed sending mail: %s", err.Error()))
+			return err
 		}
 	}
 
-	return nil
-}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
 
-// Submit the turn by using a builtin mailer
-func (mailConfig SmtpConfig) SubmitTurnBuiltin() error {
-	message := gomail.NewMessage()
-	message.SetHeader("From", mailConfig.From)
-	message.SetHeader("To", mailConfig.To)
-	message.SetHeader("Subject", mailConfig.Subject)
-	message.SetBody("text/plain", mailConfig.Body)
-	message.Attach(mailConfig.AttachmentPath)
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
 
-	port, err := strconv.Atoi(mailConfig.Port)
+	_, err = message.WriteTo(writer)
 	if err != nil {
 		return err
 	}
 
-	dialer := gomail.NewPlainDialer(mailConfig.Server, port, mailConfig.Username, mailConfig.Password)
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// The security mode to use. Port 465 is implicit TLS, everything else tries STARTTLS unless told otherwise.
+func (mailConfig SmtpConfig) security() string {
+	if mailConfig.Security != "" {
+		return strings.ToLower(mailConfig.Security)
+	}
+
+	if mailConfig.Port == "465" {
+		return "tls"
+	}
+
+	return "starttls"
+}
+
+// The authentication mechanism to use. Without a username, we assume a relay that doesn't need authentication.
+func (mailConfig SmtpConfig) authMechanism() string {
+	if mailConfig.Auth != "" {
+		return strings.ToLower(mailConfig.Auth)
+	}
+
+	if mailConfig.Username == "" {
+		return "none"
+	}
+
+	return "plain"
+}
+
+// Connect to the SMTP server, and secure the connection as configured
+func (mailConfig SmtpConfig) dial() (*smtp.Client, error) {
+	address := net.JoinHostPort(mailConfig.Server, mailConfig.Port)
+
+	tlsConfig, err := mailConfig.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	security := mailConfig.security()
+
+	if security == "tls" {
+		conn, err := tls.Dial("tcp", address, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := smtp.NewClient(conn, mailConfig.Server)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return client, nil
+	}
+
+	client, err := smtp.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if security == "none" {
+		return client, nil
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	} else if security == "starttls-required" {
+		client.Close()
+		return nil, errors.New(fmt.Sprintf("%v does not offer STARTTLS, which is required by smtpsettings", mailConfig.Server))
+	}
+
+	return client, nil
+}
+
+// TLS settings for the connection, with an optional custom CA bundle or pinned certificate
+func (mailConfig SmtpConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: mailConfig.Server}
+
+	if mailConfig.CaFile != "" {
+		caPath, err := homedir.Expand(mailConfig.CaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pem, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("No certificates found in %v", caPath))
+		}
+	}
+
+	if mailConfig.PinnedCert != "" {
+		pin := normalizeFingerprint(mailConfig.PinnedCert)
+
+		// The pin replaces the usual chain verification, which is the point of pinning self-signed certificates
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPinnedCertificate(rawCerts, pin)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Check that the server certificate has the given SHA-256 fingerprint
+func verifyPinnedCertificate(rawCerts [][]byte, pin string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("Server sent no certificate")
+	}
+
+	fingerprint := sha256.Sum256(rawCerts[0])
+	if hex.EncodeToString(fingerprint[:]) != pin {
+		return errors.New(fmt.Sprintf("Server certificate fingerprint %x does not match pinned certificate %v", fingerprint, pin))
+	}
+
+	return nil
+}
+
+// Fingerprints are often written with colons and in uppercase, e.g. AB:CD:...
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(fingerprint), ":", "", -1))
+}
+
+// The smtp.Auth for the configured mechanism, nil if we don't authenticate
+func (mailConfig SmtpConfig) auth() (smtp.Auth, error) {
+	switch mailConfig.authMechanism() {
+	case "none":
+		return nil, nil
+	case "plain":
+		return smtp.PlainAuth("", mailConfig.Username, mailConfig.Password, mailConfig.Server), nil
+	case "login":
+		return LoginAuth(mailConfig.Username, mailConfig.Password, mailConfig.Server), nil
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(mailConfig.Username, mailConfig.Password), nil
+	case "xoauth2":
+		return XOAuth2Auth(mailConfig.Username, mailConfig.Password), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown auth %v in smtpsettings, use one of %v", mailConfig.Auth, strings.Join(SmtpAuthMechanisms, ", ")))
+	}
+}
+
+// Check that the settings for the chosen security mode and authentication mechanism are complete
+func (mailConfig SmtpConfig) Validate() error {
+	if len(mailConfig.Port) == 0 {
+		return errors.New("no port set in smtpsettings")
+	}
+
+	if len(mailConfig.Server) == 0 {
+		return errors.New("no server set in smtpsettings")
+	}
+
+	if !utility.Contains(SmtpSecurityModes, mailConfig.security()) {
+		return errors.New(fmt.Sprintf("Unknown security %v in smtpsettings, use one of %v", mailConfig.Security, strings.Join(SmtpSecurityModes, ", ")))
+	}
+
+	mechanism := mailConfig.authMechanism()
+
+	if !utility.Contains(SmtpAuthMechanisms, mechanism) {
+		return errors.New(fmt.Sprintf("Unknown auth %v in smtpsettings, use one of %v", mailConfig.Auth, strings.Join(SmtpAuthMechanisms, ", ")))
+	}
+
+	if mechanism != "none" {
+		if len(mailConfig.Username) == 0 {
+			return errors.New("no username set in smtpsettings")
+		}
 
-	if err := dialer.DialAndSend(message); err != nil {
-		return (err)
+		if len(mailConfig.Password) == 0 {
+			return errors.New("no password set in smtpsettings")
+		}
+	}
+
+	return nil
+}
+
+// Wait for a started command to finish, killing it if it takes too long
+func waitWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	cmdDone := make(chan error, 1)
+	go func() {
+		cmdDone <- cmd.Wait()
+	}()
+
+	select {
+	case <-time.After(timeout):
+		if err := cmd.Process.Kill(); err != nil {
+			return errors.New(fmt.Sprintf("Timeout while sending mail: %s", err.Error()))
+		}
+		<-cmdDone
+		return errors.New(fmt.Sprintf("Timeout while sending mail, killed %v", cmd.Path))
+	case err := <-cmdDone:
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed sending mail: %s", err.Error()))
+		}
 	}
 
 	return nil
@@ -0,0 +1,169 @@
+package command
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A local SMTP stand-in without TLS or AUTH, like a local MTA relay. Received mails are sent to the channel.
+func startSmtpServer(t *testing.T) (SmtpConfig, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+
+		var envelope []string
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			command := strings.ToUpper(strings.Fields(line)[0])
+			switch command {
+			case "EHLO", "HELO":
+				fmt.Fprint(conn, "250 localhost\r\n")
+			case "MAIL", "RCPT":
+				envelope = append(envelope, strings.TrimSpace(line))
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+
+				received <- strings.Join(envelope, "\n") + "\n" + data.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 not implemented\r\n")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	return SmtpConfig{Server: host, Port: port}, received
+}
+
+func TestSubmitTurnBuiltinRelay(t *testing.T) {
+	smtpConfig, received := startSmtpServer(t)
+	smtpConfig.Security = "none"
+
+	err := smtpConfig.SubmitTurnBuiltin(testSubmission(t))
+	assert.NoError(t, err)
+
+	mail := <-received
+	assert.Contains(t, mail, "MAIL FROM:<me@example.com>")
+	assert.Contains(t, mail, "RCPT TO:<turns@llamaserver.net>")
+	assert.Contains(t, mail, "Subject: testgame turn 7")
+}
+
+func TestSubmitTurnBuiltinOpportunisticStartTLS(t *testing.T) {
+	smtpConfig, received := startSmtpServer(t)
+
+	err := smtpConfig.SubmitTurnBuiltin(testSubmission(t))
+	assert.NoError(t, err)
+	assert.Contains(t, <-received, "Subject: testgame turn 7")
+}
+
+func TestSubmitTurnBuiltinRequiredStartTLS(t *testing.T) {
+	smtpConfig, _ := startSmtpServer(t)
+	smtpConfig.Security = "starttls-required"
+
+	err := smtpConfig.SubmitTurnBuiltin(testSubmission(t))
+	assert.Error(t, err)
+}
+
+func TestSubmitTurnBuiltinAuthWithoutServerSupport(t *testing.T) {
+	smtpConfig, _ := startSmtpServer(t)
+	smtpConfig.Username = "me"
+	smtpConfig.Password = "secret"
+
+	err := smtpConfig.SubmitTurnBuiltin(testSubmission(t))
+	assert.Error(t, err)
+}
+
+func TestSmtpConfigValidate(t *testing.T) {
+	assert.NoError(t, SmtpConfig{Server: "localhost", Port: "25"}.Validate())
+	assert.NoError(t, SmtpConfig{Server: "smtp.gmail.com", Port: "465", Username: "me", Password: "app-password"}.Validate())
+
+	assert.Error(t, SmtpConfig{Server: "smtp.gmail.com", Port: "587", Username: "me"}.Validate())
+	assert.Error(t, SmtpConfig{Server: "smtp.gmail.com", Port: "587", Auth: "login", Password: "secret"}.Validate())
+	assert.Error(t, SmtpConfig{Server: "smtp.gmail.com", Port: "587", Security: "ssl"}.Validate())
+	assert.Error(t, SmtpConfig{Server: "smtp.gmail.com", Port: "587", Auth: "digest-md5"}.Validate())
+}
+
+func TestSmtpConfigSecurityDefaults(t *testing.T) {
+	assert.Equal(t, "tls", SmtpConfig{Port: "465"}.security())
+	assert.Equal(t, "starttls", SmtpConfig{Port: "587"}.security())
+	assert.Equal(t, "none", SmtpConfig{Port: "25", Security: "None"}.security())
+}
+
+func TestVerifyPinnedCertificate(t *testing.T) {
+	certificate := []byte("not really a certificate")
+	fingerprint := sha256.Sum256(certificate)
+	pin := strings.ToUpper(hex.EncodeToString(fingerprint[:2])) + ":" + hex.EncodeToString(fingerprint[2:])
+
+	assert.NoError(t, verifyPinnedCertificate([][]byte{certificate}, normalizeFingerprint(pin)))
+	assert.Error(t, verifyPinnedCertificate([][]byte{[]byte("another certificate")}, normalizeFingerprint(pin)))
+	assert.Error(t, verifyPinnedCertificate(nil, normalizeFingerprint(pin)))
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := LoginAuth("me", "secret", "smtp.example.com")
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "LOGIN", mechanism)
+
+	response, err := auth.Next([]byte("Username:"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "me", string(response))
+
+	response, err = auth.Next([]byte("Password:"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(response))
+}
+
+func TestLoginAuthRefusesUnencryptedConnections(t *testing.T) {
+	_, _, err := LoginAuth("me", "secret", "smtp.example.com").Start(&smtp.ServerInfo{Name: "smtp.example.com"})
+
+	assert.Error(t, err)
+}
+
+func TestXOAuth2Auth(t *testing.T) {
+	mechanism, initialResponse, err := XOAuth2Auth("me@gmail.com", "token").Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "XOAUTH2", mechanism)
+	assert.Equal(t, "user=me@gmail.com\x01auth=Bearer token\x01\x01", string(initialResponse))
+}
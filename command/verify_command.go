@@ -0,0 +1,98 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/promisedlandt/dom4tools/game"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type VerifyCommand struct {
+	*Meta
+
+	GameName string
+}
+
+// Check the backups of one or all games against their manifests
+func (c *VerifyCommand) run(*kingpin.ParseContext) error {
+	var games []*game.Game
+
+	if c.GameName != "" {
+		found, err := c.Meta.FindGame(c.GameName, "")
+		if err != nil {
+			return err
+		}
+
+		games = append(games, found)
+	} else {
+		allGames, err := c.Meta.AllGames()
+		if err != nil {
+			return err
+		}
+
+		games = allGames
+	}
+
+	problems := false
+
+	for _, g := range games {
+		result, err := g.VerifyBackups()
+		if err != nil {
+			return err
+		}
+
+		for _, filename := range result.Missing {
+			c.Ui.Error(fmt.Sprintf("%v: %v is missing", g.Name, filename))
+		}
+
+		for _, filename := range result.Altered {
+			c.Ui.Error(fmt.Sprintf("%v: %v was altered", g.Name, filename))
+		}
+
+		for _, filename := range result.Untracked {
+			c.Ui.Warn(fmt.Sprintf("%v: %v is not in the manifest", g.Name, filename))
+		}
+
+		for _, reason := range result.Broken {
+			c.Ui.Error(fmt.Sprintf("%v: %v", g.Name, reason))
+		}
+
+		for _, leftover := range result.Leftovers {
+			c.Ui.Error(fmt.Sprintf("%v: %v was left behind by an interrupted change to %v, keep one of them", g.Name, leftover.Path, filepath.Base(leftover.Original)))
+		}
+
+		if result.Ok() {
+			c.Ui.Output(fmt.Sprintf("%v: %v backups verified", g.Name, len(result.Verified)))
+		} else {
+			problems = true
+		}
+	}
+
+	if problems {
+		return errors.New("Some backups could not be verified")
+	}
+
+	return nil
+}
+
+func (c *VerifyCommand) completion(parseContext *kingpin.ParseContext) error {
+	return completionWithGames(c.Meta, parseContext)
+}
+
+func ConfigureVerifyCommand(app *kingpin.Application, meta *Meta) (commandName string) {
+	commandName = "verify"
+	c := &VerifyCommand{Meta: meta}
+	cmd := app.Command(commandName, "Check backups against the checksums recorded when they were made.")
+
+	if meta.CompletionOnly {
+		cmd.Action(c.completion)
+	} else {
+		cmd.Action(c.run)
+		cmd.Arg("game_name", "Name of the game to verify, all games if not given").StringVar(&c.GameName)
+	}
+
+	return commandName
+}
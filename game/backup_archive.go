@@ -0,0 +1,442 @@
+package game
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Name of the directory in the metadata directory that holds backup archives, unless configured otherwise
+const BackupArchiveDirectory = "backups"
+
+const BackupArchiveExtension = ".tar.gz"
+
+// Name of the file in a backup archive that describes it
+const BackupArchiveMetadataName = "metadata.json"
+
+// BackupArchiveMetadata describes the turn a backup archive holds
+type BackupArchiveMetadata struct {
+	Game       string                   `json:"game"`
+	Nation     string                   `json:"nation"`
+	TurnNumber int                      `json:"turn_number"`
+	Created    time.Time                `json:"created"`
+	Files      map[string]ManifestEntry `json:"files"`
+}
+
+// The contents of a backed up file, and when it was last modified before it was backed up
+type BackupContents struct {
+	Data     []byte
+	Modified time.Time
+}
+
+// BackupArchiveFilename returns the name of the archive for a nation's turn.
+// Example: early_agartha, 12 -> early_agartha-12.tar.gz
+func BackupArchiveFilename(stem string, turnNumber int) string {
+	return stem + "-" + strconv.Itoa(turnNumber) + BackupArchiveExtension
+}
+
+// Where backup archives go if no other directory is configured
+func (game *Game) DefaultBackupStore() string {
+	return filepath.Join(game.Directory, MetadataDirectory, BackupArchiveDirectory)
+}
+
+// The directory with the backup archives of this game
+func (game *Game) backupStore() string {
+	if game.BackupStore != "" {
+		return game.BackupStore
+	}
+
+	return game.DefaultBackupStore()
+}
+
+// Keep new backups as archives in the given directory, and add the archives already there to the backups
+func (game *Game) UseBackupStore(directory string) error {
+	game.BackupStore = directory
+
+	err := game.readBackupStore(directory)
+	if err != nil {
+		return err
+	}
+
+	for _, nation := range game.Nations {
+		nation.sortBackupKeys()
+	}
+
+	// The archives might hold the only files of a nation, or add backups to the selected one
+	if nation, ok := game.Nations[game.NationStem]; ok {
+		game.useNation(nation)
+		return nil
+	}
+
+	return game.SelectNation(game.defaultNationStem())
+}
+
+// Add the backups from all archives in the directory. Backups next to the game files take precedence.
+func (game *Game) readBackupStore(directory string) error {
+	files, err := ioutil.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	game.BrokenArchives = nil
+
+	archiveRegexp := regexp.MustCompile(`\A(.+)-(\d+)` + regexp.QuoteMeta(BackupArchiveExtension) + `\z`)
+
+	for _, f := range files {
+		matchData := archiveRegexp.FindStringSubmatch(f.Name())
+		if matchData == nil {
+			continue
+		}
+
+		turnNumber, err := strconv.Atoi(matchData[2])
+		if err != nil {
+			continue
+		}
+
+		archivePath := filepath.Join(directory, f.Name())
+
+		// Every d4t start reads the archives of every game, so only the metadata at the front is read.
+		// A broken archive is for verify to report, the other backups are still there.
+		metadata, err := readBackupArchiveMetadata(archivePath)
+		if err != nil {
+			game.BrokenArchives = append(game.BrokenArchives, err.Error())
+			continue
+		}
+
+		nation := game.gameNation(matchData[1])
+
+		for filename := range metadata.Files {
+			switch {
+			case strings.HasSuffix(filename, ".trn"):
+				if _, ok := nation.TrnBackups[turnNumber]; !ok {
+					nation.TrnBackups[turnNumber] = TrnFile{Filename: filename, Fullpath: archivePath, Archived: true}
+				}
+			case strings.HasSuffix(filename, ".2h"):
+				if _, ok := nation.TwohBackups[turnNumber]; !ok {
+					nation.TwohBackups[turnNumber] = TwohFile{Filename: filename, Fullpath: archivePath, Archived: true}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Read only the metadata of an archive, which is always its first file
+func readBackupArchiveMetadata(archivePath string) (BackupArchiveMetadata, error) {
+	metadata := BackupArchiveMetadata{}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return metadata, err
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return metadata, errors.New(fmt.Sprintf("Broken backup archive %v: %v", archivePath, err.Error()))
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil {
+		return metadata, errors.New(fmt.Sprintf("Broken backup archive %v: %v", archivePath, err.Error()))
+	}
+
+	if header.Name != BackupArchiveMetadataName {
+		return metadata, errors.New(fmt.Sprintf("Broken backup archive %v: %v is not its first file", archivePath, BackupArchiveMetadataName))
+	}
+
+	err = json.NewDecoder(tarReader).Decode(&metadata)
+	if err != nil {
+		return metadata, errors.New(fmt.Sprintf("Broken metadata in backup archive %v: %v", archivePath, err.Error()))
+	}
+
+	return metadata, nil
+}
+
+// Read an archive completely, files keyed by name
+func readBackupArchive(archivePath string) (BackupArchiveMetadata, map[string]BackupContents, error) {
+	metadata := BackupArchiveMetadata{}
+	files := make(map[string]BackupContents)
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return metadata, files, err
+	}
+
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return metadata, files, errors.New(fmt.Sprintf("Broken backup archive %v: %v", archivePath, err.Error()))
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return metadata, files, errors.New(fmt.Sprintf("Broken backup archive %v: %v", archivePath, err.Error()))
+		}
+
+		data, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return metadata, files, err
+		}
+
+		if header.Name == BackupArchiveMetadataName {
+			err = json.Unmarshal(data, &metadata)
+			if err != nil {
+				return metadata, files, errors.New(fmt.Sprintf("Broken metadata in backup archive %v: %v", archivePath, err.Error()))
+			}
+		} else {
+			files[header.Name] = BackupContents{Data: data, Modified: header.ModTime}
+		}
+	}
+
+	return metadata, files, nil
+}
+
+// Read a single file from an archive
+func readBackupArchiveFile(archivePath string, filename string) (BackupContents, error) {
+	_, files, err := readBackupArchive(archivePath)
+	if err != nil {
+		return BackupContents{}, err
+	}
+
+	contents, ok := files[filename]
+	if !ok {
+		return contents, errors.New(fmt.Sprintf("%v is not in backup archive %v", filename, archivePath))
+	}
+
+	return contents, nil
+}
+
+// Read a backup, from its archive if it's in one
+func readBackupFile(filename string, fullpath string, archived bool) (BackupContents, error) {
+	if archived {
+		return readBackupArchiveFile(fullpath, filename)
+	}
+
+	return readCurrentFile(fullpath)
+}
+
+// Read a file, keeping its modification time
+func readCurrentFile(fullpath string) (BackupContents, error) {
+	info, err := os.Stat(fullpath)
+	if err != nil {
+		return BackupContents{}, err
+	}
+
+	data, err := ioutil.ReadFile(fullpath)
+	if err != nil {
+		return BackupContents{}, err
+	}
+
+	return BackupContents{Data: data, Modified: info.ModTime()}, nil
+}
+
+// Write an archive with the given files and metadata describing them, as part of the transaction
+func writeBackupArchive(tx *utility.Transaction, archivePath string, metadata BackupArchiveMetadata, files map[string]BackupContents) error {
+	metadata.Files = make(map[string]ManifestEntry)
+
+	var filenames []string
+	for filename, contents := range files {
+		hash := sha256.Sum256(contents.Data)
+		metadata.Files[filename] = ManifestEntry{Sha256: hex.EncodeToString(hash[:]), Size: int64(len(contents.Data)), Recorded: metadata.Created}
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	rawMetadata, err := json.MarshalIndent(metadata, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	var archive bytes.Buffer
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = writeTarFile(tarWriter, BackupArchiveMetadataName, rawMetadata, metadata.Created)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		err = writeTarFile(tarWriter, filename, files[filename].Data, files[filename].Modified)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(archivePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return tx.WriteFile(archivePath, archive.Bytes(), 0644, time.Time{})
+}
+
+func writeTarFile(tarWriter *tar.Writer, filename string, data []byte, modified time.Time) error {
+	err := tarWriter.WriteHeader(&tar.Header{Name: filename, Mode: 0644, Size: int64(len(data)), ModTime: modified})
+	if err != nil {
+		return err
+	}
+
+	_, err = tarWriter.Write(data)
+
+	return err
+}
+
+// Archive files of the selected nation as the backup of a turn, keyed by their backup name.
+// Files already in the archive for that turn are kept unless replaced. Returns the path of the archive.
+func (game *Game) archiveBackup(tx *utility.Transaction, turnNumber int, files map[string]BackupContents) (string, error) {
+	archivePath := filepath.Join(game.BackupStore, BackupArchiveFilename(game.NationStem, turnNumber))
+
+	if _, err := os.Stat(archivePath); err == nil {
+		_, existing, err := readBackupArchive(archivePath)
+		if err != nil {
+			return archivePath, err
+		}
+
+		for filename, contents := range existing {
+			if _, ok := files[filename]; !ok {
+				files[filename] = contents
+			}
+		}
+	}
+
+	metadata := BackupArchiveMetadata{Game: game.Name, Nation: game.NationStem, TurnNumber: turnNumber, Created: time.Now()}
+
+	return archivePath, writeBackupArchive(tx, archivePath, metadata, files)
+}
+
+// Move the backups next to the game files of all nations into archives in the backup store.
+// Every turn is moved completely, or not at all. Returns the names of the files that were moved.
+func (game *Game) MigrateBackups() ([]string, error) {
+	var migrated []string
+
+	if game.BackupStore == "" {
+		return migrated, errors.New(fmt.Sprintf("No backup store set up for %v", game.Name))
+	}
+
+	selectedStem := game.NationStem
+	defer game.SelectNation(selectedStem)
+
+	for _, stem := range game.NationStems() {
+		game.useNation(game.Nations[stem])
+
+		for _, turnNumber := range game.Nations[stem].BackedUpTurns() {
+			fullpaths, err := game.migrateTurn(turnNumber)
+			if err != nil {
+				return migrated, err
+			}
+
+			for _, fullpath := range fullpaths {
+				migrated = append(migrated, filepath.Base(fullpath))
+			}
+		}
+	}
+
+	return migrated, nil
+}
+
+// Move the backups of the selected nation for a turn into its archive. Returns the files that were moved.
+func (game *Game) migrateTurn(turnNumber int) (fullpaths []string, err error) {
+	files := make(map[string]BackupContents)
+
+	trnBackup, hasTrn := game.TrnBackups[turnNumber]
+	if hasTrn && !trnBackup.Archived {
+		fullpaths = append(fullpaths, trnBackup.Fullpath)
+	}
+
+	twohBackup, hasTwoh := game.TwohBackups[turnNumber]
+	if hasTwoh && !twohBackup.Archived {
+		fullpaths = append(fullpaths, twohBackup.Fullpath)
+	}
+
+	if len(fullpaths) == 0 {
+		return fullpaths, nil
+	}
+
+	// Moving a damaged backup would make it look fine
+	err = game.checkBackups(fullpaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fullpath := range fullpaths {
+		contents, err := readCurrentFile(fullpath)
+		if err != nil {
+			return nil, err
+		}
+
+		files[filepath.Base(fullpath)] = contents
+	}
+
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	archivePath, err := game.archiveBackup(tx, turnNumber, files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fullpath := range fullpaths {
+		err = tx.Remove(fullpath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = game.moveManifestEntries(archivePath, fullpaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasTrn {
+		game.TrnBackups[turnNumber] = TrnFile{Filename: trnBackup.Filename, Fullpath: archivePath, Archived: true}
+	}
+
+	if hasTwoh {
+		game.TwohBackups[turnNumber] = TwohFile{Filename: twohBackup.Filename, Fullpath: archivePath, Archived: true}
+	}
+
+	return fullpaths, nil
+}
@@ -0,0 +1,165 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchivedBackup(t *testing.T) {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.trn"), []byte("turn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.2h"), []byte("orders"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.NoError(t, game.UseBackupStore(game.DefaultBackupStore()))
+	assert.NoError(t, game.Backup(3, false))
+
+	assert.False(t, utility.FileExists(filepath.Join(directory, "early_ulm-3.trn")))
+	assert.True(t, utility.FileExists(filepath.Join(directory, ".d4t", "backups", "early_ulm-3.tar.gz")))
+
+	// The store is found without asking for it
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.Equal(t, game.DefaultBackupStore(), game.BackupStore)
+	assert.Equal(t, []int{3}, game.SortedTrnBackupKeys)
+	assert.True(t, game.TwohBackups[3].Archived)
+	assert.Equal(t, "early_ulm-3.2h", game.TwohBackups[3].Filename)
+
+	data, err := game.TwohBackups[3].Data()
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", string(data))
+
+	assert.Error(t, game.Backup(3, false))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.2h"), []byte("new orders"), 0644))
+	assert.NoError(t, game.Restore(3))
+
+	data, err = ioutil.ReadFile(filepath.Join(directory, "early_ulm.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", string(data))
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.True(t, result.Ok())
+	assert.Equal(t, []string{"early_ulm-3.tar.gz"}, result.Verified)
+}
+
+func TestBrokenArchiveKeepsGame(t *testing.T) {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.trn"), []byte("turn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.2h"), []byte("orders"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.NoError(t, game.UseBackupStore(game.DefaultBackupStore()))
+	assert.NoError(t, game.Backup(3, false))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.DefaultBackupStore(), "early_ulm-4.tar.gz"), []byte("garbage"), 0644))
+
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3}, game.SortedTrnBackupKeys)
+	assert.Len(t, game.BrokenArchives, 1)
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.False(t, result.Ok())
+	assert.Len(t, result.Broken, 1)
+	assert.Contains(t, result.Broken[0], "early_ulm-4.tar.gz")
+}
+
+func TestMigrateBackups(t *testing.T) {
+	game := testBackedUpGame(t)
+	assert.NoError(t, game.LabelBackup(1, "start"))
+	assert.NoError(t, game.UseBackupStore(filepath.Join(testGameDirectory(t), "testgame")))
+
+	migrated, err := game.MigrateBackups()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"early_ulm-1.trn", "early_ulm-1.2h"}, migrated)
+	assert.False(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-1.trn")))
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Entries, 1)
+	assert.Equal(t, "start", manifest.Entries["early_ulm-1.tar.gz"].Label)
+
+	store := game.BackupStore
+	game, err = NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+	assert.Empty(t, game.SortedTrnBackupKeys)
+	assert.NoError(t, game.UseBackupStore(store))
+	assert.Equal(t, []int{1}, game.SortedTrnBackupKeys)
+	assert.Equal(t, "start", game.BackupLabel(1))
+
+	data, err := game.TrnBackups[1].Data()
+	assert.NoError(t, err)
+	assert.Equal(t, "turn", string(data))
+}
+
+func TestBackupCurrentTurnIntoArchive(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_ulm.trn"), FileHeader{Version: 433, TurnNumber: 4, GameName: "testgame"})
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.NoError(t, game.UseBackupStore(game.DefaultBackupStore()))
+
+	turnNumber, err := game.BackupCurrentTurn()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, turnNumber)
+
+	// Later orders end up in the same archive
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.2h"), []byte("orders"), 0644))
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	_, err = game.BackupCurrentTurn()
+	assert.NoError(t, err)
+
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4}, game.SortedTrnBackupKeys)
+	assert.Equal(t, []int{4}, game.SortedTwohBackupKeys)
+
+	writeTestTurnFile(t, filepath.Join(directory, "early_ulm.trn"), FileHeader{Version: 434, TurnNumber: 4, GameName: "testgame"})
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	_, err = game.BackupCurrentTurn()
+	assert.Error(t, err)
+}
+
+func TestRestoreKeepsModificationTime(t *testing.T) {
+	directory := testGameDirectory(t)
+	modified := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, filename := range []string{"early_ulm.trn", "early_ulm.2h"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, filename), []byte(filename), 0644))
+		assert.NoError(t, os.Chtimes(filepath.Join(directory, filename), modified, modified))
+	}
+
+	for _, store := range []string{"", filepath.Join(directory, ".d4t", "backups")} {
+		game, err := NewGame("testgame", directory)
+		assert.NoError(t, err)
+
+		if store != "" {
+			assert.NoError(t, game.UseBackupStore(store))
+		}
+
+		assert.NoError(t, game.Backup(1, true))
+
+		game, err = NewGame("testgame", directory)
+		assert.NoError(t, err)
+		assert.NoError(t, game.Restore(1))
+
+		info, err := os.Stat(filepath.Join(directory, "early_ulm.2h"))
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(modified), store)
+	}
+}
@@ -0,0 +1,212 @@
+package game
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// BackupStorage keeps copies of backups away from the game directory.
+// Files are named by game and backup file name, separated by a slash, e.g. testgame/early_agartha-12.trn
+type BackupStorage interface {
+	Put(name string, data []byte) error
+	Get(name string) ([]byte, error)
+	// Names of all stored files starting with the prefix, sorted
+	List(prefix string) ([]string, error)
+	// Where the files go, for messages
+	String() string
+}
+
+// DirectoryStorage stores backups in a local directory, e.g. a mounted network share or a synced folder
+type DirectoryStorage struct {
+	Path string
+}
+
+func (storage DirectoryStorage) Put(name string, data []byte) error {
+	fullpath := filepath.Join(storage.Path, filepath.FromSlash(name))
+
+	err := os.MkdirAll(filepath.Dir(fullpath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return utility.WriteFile(fullpath, data, 0644)
+}
+
+func (storage DirectoryStorage) Get(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(storage.Path, filepath.FromSlash(name)))
+}
+
+func (storage DirectoryStorage) List(prefix string) ([]string, error) {
+	var names []string
+
+	directory, filePrefix := path.Split(prefix)
+
+	files, err := ioutil.ReadDir(filepath.Join(storage.Path, filepath.FromSlash(directory)))
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return names, err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), filePrefix) {
+			names = append(names, directory+f.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (storage DirectoryStorage) String() string {
+	return storage.Path
+}
+
+// The backup files of the selected nation for a turn. Archived backups share one file.
+func (game *Game) BackupFiles(turnNumber int) []string {
+	var fullpaths []string
+
+	if backup, ok := game.TrnBackups[turnNumber]; ok {
+		fullpaths = append(fullpaths, backup.Fullpath)
+	}
+
+	if backup, ok := game.TwohBackups[turnNumber]; ok && (len(fullpaths) == 0 || fullpaths[0] != backup.Fullpath) {
+		fullpaths = append(fullpaths, backup.Fullpath)
+	}
+
+	return fullpaths
+}
+
+// Name of a backup file in storage
+func (game *Game) storageName(fullpath string) string {
+	return game.Name + "/" + filepath.Base(fullpath)
+}
+
+// Copy the backups of the selected nation for a turn to the storage. Returns the names they are stored as.
+func (game *Game) PushBackups(storage BackupStorage, turnNumber int) ([]string, error) {
+	var names []string
+
+	for _, fullpath := range game.BackupFiles(turnNumber) {
+		data, err := ioutil.ReadFile(fullpath)
+		if err != nil {
+			return names, err
+		}
+
+		name := game.storageName(fullpath)
+
+		err = storage.Put(name, data)
+		if err != nil {
+			return names, errors.New(fmt.Sprintf("Could not store %v in %v: %v", name, storage, err.Error()))
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Fetch the backups for a turn from the storage. Only the selected nation's, if one is selected.
+// Nothing the storage serves replaces a backup unchecked: local copies that still match the manifest are kept
+// without downloading, and fetched files have to match the manifest, or the local copy if there is no entry.
+// Backups that aren't in the manifest yet are added. Returns the paths of the backups, fetched or already there.
+func (game *Game) PullBackups(storage BackupStorage, turnNumber int) (fullpaths []string, err error) {
+	names, err := storage.List(game.Name + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return nil, err
+	}
+
+	backupRegexp := regexp.MustCompile(`\A(.+)-(\d+)(\.trn|\.2h|` + regexp.QuoteMeta(BackupArchiveExtension) + `)\z`)
+
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	var fetched []string
+
+	for _, name := range names {
+		filename := path.Base(name)
+
+		matchData := backupRegexp.FindStringSubmatch(filename)
+		if matchData == nil || matchData[2] != strconv.Itoa(turnNumber) || (game.NationStem != "" && matchData[1] != game.NationStem) {
+			continue
+		}
+
+		fullpath := filepath.Join(game.Directory, filename)
+		if matchData[3] == BackupArchiveExtension {
+			fullpath = filepath.Join(game.backupStore(), filename)
+		}
+
+		entry, recorded := manifest.Entries[filename]
+
+		if recorded {
+			if matches, err := manifest.Matches(fullpath); err == nil && matches {
+				fullpaths = append(fullpaths, fullpath)
+				continue
+			}
+		}
+
+		data, err := storage.Get(name)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Could not fetch %v from %v: %v", name, storage, err.Error()))
+		}
+
+		if recorded && !entry.MatchesData(data) {
+			return nil, errors.New(fmt.Sprintf("%v in %v differs from the backup recorded in the manifest, not using it", name, storage))
+		}
+
+		if local, err := ioutil.ReadFile(fullpath); !recorded && err == nil {
+			if !bytes.Equal(local, data) {
+				return nil, errors.New(fmt.Sprintf("%v in %v differs from the local backup, not replacing it", name, storage))
+			}
+
+			fullpaths = append(fullpaths, fullpath)
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(fullpath), 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.WriteFile(fullpath, data, 0644, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+
+		fullpaths = append(fullpaths, fullpath)
+		fetched = append(fetched, fullpath)
+	}
+
+	for _, fullpath := range fetched {
+		if _, ok := manifest.Entries[filepath.Base(fullpath)]; !ok {
+			err = manifest.Record(fullpath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(fetched) == 0 {
+		return fullpaths, nil
+	}
+
+	return fullpaths, manifest.Save()
+}
@@ -0,0 +1,132 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Push the backups of turn 1 of a game to the storage, lose them locally, pull and restore them again
+func assertStorageRoundTrip(t *testing.T, storage BackupStorage) {
+	game := testBackedUpGame(t)
+
+	names, err := game.PushBackups(storage, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testgame/early_ulm-1.trn", "testgame/early_ulm-1.2h"}, names)
+
+	names, err = storage.List("testgame/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testgame/early_ulm-1.2h", "testgame/early_ulm-1.trn"}, names)
+
+	names, err = storage.List("othergame/")
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	assert.NoError(t, os.Remove(filepath.Join(game.Directory, "early_ulm-1.trn")))
+	assert.NoError(t, os.Remove(filepath.Join(game.Directory, "early_ulm-1.2h")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm.2h"), []byte("new orders"), 0644))
+
+	fullpaths, err := game.PullBackups(storage, 1)
+	assert.NoError(t, err)
+	assert.Len(t, fullpaths, 2)
+
+	game, err = NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+	assert.NoError(t, game.Restore(1))
+
+	data, err := ioutil.ReadFile(filepath.Join(game.Directory, "early_ulm.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", string(data))
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.True(t, result.Ok())
+
+	// Nothing stored for other turns
+	fullpaths, err = game.PullBackups(storage, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, fullpaths)
+}
+
+// Counts the files fetched from a storage
+type countingStorage struct {
+	BackupStorage
+	gets int
+}
+
+func (storage *countingStorage) Get(name string) ([]byte, error) {
+	storage.gets++
+	return storage.BackupStorage.Get(name)
+}
+
+func TestPullBackupsChecksManifest(t *testing.T) {
+	game := testBackedUpGame(t)
+	storage := &countingStorage{BackupStorage: DirectoryStorage{Path: testGameDirectory(t)}}
+
+	_, err := game.PushBackups(storage, 1)
+	assert.NoError(t, err)
+
+	// Local copies are fine, nothing to fetch
+	fullpaths, err := game.PullBackups(storage, 1)
+	assert.NoError(t, err)
+	assert.Len(t, fullpaths, 2)
+	assert.Equal(t, 0, storage.gets)
+
+	// The stored copy was tampered with, and the local one damaged
+	assert.NoError(t, storage.Put("testgame/early_ulm-1.2h", []byte("other orders")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-1.2h"), []byte("damaged"), 0644))
+
+	_, err = game.PullBackups(storage, 1)
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(game.Directory, "early_ulm-1.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "damaged", string(data))
+}
+
+func TestPullBackupsKeepsUnrecordedLocalBackups(t *testing.T) {
+	game := testBackedUpGame(t)
+	storage := DirectoryStorage{Path: testGameDirectory(t)}
+	assert.NoError(t, storage.Put("testgame/early_ulm-2.trn", []byte("remote turn")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-2.trn"), []byte("local turn"), 0644))
+
+	_, err := game.PullBackups(storage, 2)
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(game.Directory, "early_ulm-2.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "local turn", string(data))
+}
+
+func TestDirectoryStorage(t *testing.T) {
+	assertStorageRoundTrip(t, DirectoryStorage{Path: testGameDirectory(t)})
+}
+
+func TestPushArchivedBackups(t *testing.T) {
+	game := testBackedUpGame(t)
+	assert.NoError(t, game.UseBackupStore(game.DefaultBackupStore()))
+	_, err := game.MigrateBackups()
+	assert.NoError(t, err)
+
+	storage := DirectoryStorage{Path: testGameDirectory(t)}
+
+	names, err := game.PushBackups(storage, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testgame/early_ulm-1.tar.gz"}, names)
+
+	assert.NoError(t, os.RemoveAll(game.DefaultBackupStore()))
+
+	fullpaths, err := game.PullBackups(storage, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(game.DefaultBackupStore(), "early_ulm-1.tar.gz")}, fullpaths)
+
+	game, err = NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+
+	data, err := game.TrnBackups[1].Data()
+	assert.NoError(t, err)
+	assert.Equal(t, "turn", string(data))
+}
@@ -0,0 +1,133 @@
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Every trn and 2h file starts with these bytes
+var FileHeaderMagic = []byte{0x01, 0x02, 0x04, 'D', 'O', 'M'}
+
+// Game names in the header are NUL terminated and never longer than this
+const fileHeaderMaxGameNameLength = 64
+
+// FileHeader is the metadata at the start of a trn or 2h file.
+// The layout is not documented by Illwinter, and the offsets after the magic are not confirmed against
+// files the game wrote, so fields nobody understands yet are skipped and the rest might be off.
+// Callers only trust a header that names their game, see Game.trustsHeader. A wrong offset moves the game name, too.
+type FileHeader struct {
+	// Game version times 100, e.g. 433 for 4.33
+	Version    int
+	TurnNumber int
+	NationId   int
+	GameName   string
+	// Turn key the server uses to check the 2h belongs to the trn it sent
+	Checksum uint32
+}
+
+// The fixed size part of the header, in file order, little endian
+type rawFileHeader struct {
+	Magic      [6]byte
+	UserId     uint32
+	Version    uint32
+	TurnNumber uint32
+	Unknown1   [8]byte
+	NationId   uint32
+	Unknown2   [16]byte
+	Checksum   uint32
+}
+
+// Parse the header at the start of a trn or 2h file
+func ParseFileHeader(r io.Reader) (FileHeader, error) {
+	header := FileHeader{}
+
+	var raw rawFileHeader
+	err := binary.Read(r, binary.LittleEndian, &raw)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return header, errors.New("File is too short for a Dominions 4 header")
+	}
+	if err != nil {
+		return header, err
+	}
+
+	if !bytes.Equal(raw.Magic[:], FileHeaderMagic) {
+		return header, errors.New("Not a Dominions 4 trn or 2h file")
+	}
+
+	name := make([]byte, 0, fileHeaderMaxGameNameLength)
+	b := make([]byte, 1)
+
+	for {
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return header, errors.New("Game name in header is not terminated")
+		}
+
+		if b[0] == 0 {
+			break
+		}
+
+		if len(name) == fileHeaderMaxGameNameLength {
+			return header, errors.New(fmt.Sprintf("Game name in header is longer than %v bytes", fileHeaderMaxGameNameLength))
+		}
+
+		name = append(name, b[0])
+	}
+
+	header.Version = int(raw.Version)
+	header.TurnNumber = int(raw.TurnNumber)
+	header.NationId = int(raw.NationId)
+	header.GameName = string(name)
+	header.Checksum = raw.Checksum
+
+	return header, nil
+}
+
+// Read the header of the trn or 2h file at the given path
+func ReadFileHeader(filepath string) (FileHeader, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return FileHeader{}, err
+	}
+
+	defer f.Close()
+
+	header, err := ParseFileHeader(f)
+	if err != nil {
+		return header, errors.New(fmt.Sprintf("%v: %v", filepath, err.Error()))
+	}
+
+	return header, nil
+}
+
+// Encode the header the way Dominions 4 writes it. Fields we don't know are zero.
+func (header FileHeader) MarshalBinary() ([]byte, error) {
+	if len(header.GameName) > fileHeaderMaxGameNameLength {
+		return nil, errors.New(fmt.Sprintf("Game name %v is longer than %v bytes", header.GameName, fileHeaderMaxGameNameLength))
+	}
+
+	raw := rawFileHeader{Version: uint32(header.Version), TurnNumber: uint32(header.TurnNumber), NationId: uint32(header.NationId), Checksum: header.Checksum}
+	copy(raw.Magic[:], FileHeaderMagic)
+
+	var buffer bytes.Buffer
+
+	err := binary.Write(&buffer, binary.LittleEndian, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.WriteString(header.GameName)
+	buffer.WriteByte(0)
+
+	return buffer.Bytes(), nil
+}
+
+// The game version in the usual notation.
+// Example: 4.33
+func (header FileHeader) VersionString() string {
+	return fmt.Sprintf("%d.%02d", header.Version/100, header.Version%100)
+}
@@ -0,0 +1,124 @@
+package game
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Write a trn or 2h file with the given header, followed by some game data
+func writeTestTurnFile(t *testing.T, path string, header FileHeader) {
+	data, err := header.MarshalBinary()
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, append(data, []byte("game data")...), 0644))
+}
+
+func TestParseFileHeader(t *testing.T) {
+	header := FileHeader{Version: 433, TurnNumber: 23, NationId: 12, GameName: "testgame", Checksum: 0xdeadbeef}
+	data, err := header.MarshalBinary()
+	assert.NoError(t, err)
+
+	parsed, err := ParseFileHeader(bytes.NewReader(append(data, []byte("game data")...)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, header, parsed)
+	assert.Equal(t, "4.33", parsed.VersionString())
+}
+
+// The offsets spelled out byte by byte, so a change to rawFileHeader can't slip through a round trip
+func TestParseFileHeaderLayout(t *testing.T) {
+	data := []byte{
+		0x01, 0x02, 0x04, 'D', 'O', 'M', // magic
+		0x00, 0x00, 0x00, 0x00, // user id
+		0xb1, 0x01, 0x00, 0x00, // version 433
+		0x17, 0x00, 0x00, 0x00, // turn 23
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0x0c, 0x00, 0x00, 0x00, // nation 12
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0xef, 0xbe, 0xad, 0xde, // checksum
+		't', 'e', 's', 't', 'g', 'a', 'm', 'e', 0,
+	}
+
+	parsed, err := ParseFileHeader(bytes.NewReader(data))
+
+	assert.NoError(t, err)
+	assert.Equal(t, FileHeader{Version: 433, TurnNumber: 23, NationId: 12, GameName: "testgame", Checksum: 0xdeadbeef}, parsed)
+}
+
+func TestParseFileHeaderWrongMagic(t *testing.T) {
+	data, _ := FileHeader{GameName: "testgame"}.MarshalBinary()
+	data[3] = 'X'
+
+	_, err := ParseFileHeader(bytes.NewReader(data))
+
+	assert.Error(t, err)
+}
+
+func TestParseFileHeaderTruncated(t *testing.T) {
+	data, _ := FileHeader{GameName: "testgame"}.MarshalBinary()
+
+	_, err := ParseFileHeader(bytes.NewReader(data[:20]))
+	assert.Error(t, err)
+
+	// Cut off in the middle of the game name
+	_, err = ParseFileHeader(bytes.NewReader(data[:len(data)-3]))
+	assert.Error(t, err)
+}
+
+func TestReadHeader(t *testing.T) {
+	directory := testGameDirectory(t)
+	trnfile := TrnFile{Filename: "early_agartha.trn", Fullpath: filepath.Join(directory, "early_agartha.trn")}
+	writeTestTurnFile(t, trnfile.Fullpath, FileHeader{TurnNumber: 5, NationId: 12, GameName: "testgame"})
+
+	assert.NoError(t, trnfile.ReadHeader())
+	assert.Equal(t, 5, trnfile.Header.TurnNumber)
+
+	assert.NoError(t, ioutil.WriteFile(trnfile.Fullpath, []byte("garbage"), 0644))
+	assert.Error(t, trnfile.ReadHeader())
+	assert.Nil(t, trnfile.Header)
+}
+
+func TestCurrentTurnNumberFromHeader(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha.trn"), FileHeader{TurnNumber: 17, NationId: 12, GameName: "testgame"})
+	// Backups are missing some turns, so guessing from them would be wrong
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha-3.2h"), FileHeader{TurnNumber: 3, NationId: 12, GameName: "testgame"})
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	turnNumber, ok := game.HeaderTurnNumber()
+	assert.True(t, ok)
+	assert.Equal(t, 17, turnNumber)
+	assert.Equal(t, 17, game.CurrentTurnNumber())
+}
+
+func TestHeaderTurnNumberOfAnotherGame(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha.trn"), FileHeader{TurnNumber: 17, NationId: 12, GameName: "othergame"})
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha-3.2h"), FileHeader{TurnNumber: 3, NationId: 12, GameName: "testgame"})
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	_, ok := game.HeaderTurnNumber()
+	assert.False(t, ok)
+	assert.Equal(t, 4, game.CurrentTurnNumber())
+}
+
+func TestCurrentTurnNumberWithoutHeader(t *testing.T) {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_agartha.trn"), []byte("garbage"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_agartha-3.2h"), []byte("garbage"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	_, ok := game.HeaderTurnNumber()
+	assert.False(t, ok)
+	assert.Equal(t, 4, game.CurrentTurnNumber())
+}
@@ -1,11 +1,13 @@
 package game
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -19,7 +21,9 @@ type GameCollection []Game
 // These game names are used by Dominions 4, and we want nothing to do with them
 var ReservedGameNames = []string{"newlords"}
 
-// Game represents a Dominions 4 game
+// Game represents a Dominions 4 game.
+// A game directory can hold files for several nations, e.g. in team games or when sitting for someone.
+// The files and backups of the selected nation are available directly on the game, see SelectNation.
 type Game struct {
 	Name      string
 	Directory string
@@ -30,24 +34,24 @@ type Game struct {
 	TrnBackups           map[int]TrnFile
 	SortedTwohBackupKeys []int
 	SortedTrnBackupKeys  []int
+
+	// All nations with files in the game directory, keyed by file stem
+	Nations map[string]*GameNation
+	// File stem of the selected nation, e.g. early_agartha
+	NationStem string
+
+	// Directory new backups are archived in, see UseBackupStore. Empty to back up next to the game files.
+	BackupStore string
+	// Archives in the backup store that couldn't be read, with the reason. See VerifyBackups.
+	BrokenArchives []string
+	// Back up the current turn along with installing a new one, see InstallTrn
+	BackupOnInstall bool
+	// The turn the last install backed up, 0 if it didn't
+	InstalledBackupTurn int
 }
 
 func NewGame(name string, basedir string) (*Game, error) {
-	game := Game{Name: name, Directory: basedir, TwohBackups: make(map[int]TwohFile), TrnBackups: make(map[int]TrnFile)}
-
-	current2hFile, err2hFile := game.Current2hFile()
-	current2hFilepath, err2hPath := game.Current2hFilepath()
-
-	if err2hFile == nil && err2hPath == nil {
-		game.TwohFile = TwohFile{Filename: current2hFile, Fullpath: current2hFilepath}
-	}
-
-	currentTrnFile, errTrnFile := game.CurrentTrnFile()
-	currentTrnFilepath, errTrnPath := game.CurrentTrnFilepath()
-
-	if errTrnFile == nil && errTrnPath == nil {
-		game.TrnFile = TrnFile{Filename: currentTrnFile, Fullpath: currentTrnFilepath}
-	}
+	game := Game{Name: name, Directory: basedir, TwohBackups: make(map[int]TwohFile), TrnBackups: make(map[int]TrnFile), Nations: make(map[string]*GameNation)}
 
 	files, err := ioutil.ReadDir(game.Directory)
 	if err != nil {
@@ -62,32 +66,53 @@ func NewGame(name string, basedir string) (*Game, error) {
 			turnNumber, err := strconv.Atoi(matchData[1])
 
 			if err == nil {
-				game.TwohBackups[turnNumber] = TwohFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
+				nation := game.gameNation(strings.TrimSuffix(Backup2hBasename(f.Name()), ".2h"))
+				nation.TwohBackups[turnNumber] = TwohFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
 			}
 		} else if matchData := trnRegexp.FindStringSubmatch(f.Name()); matchData != nil {
 			turnNumber, err := strconv.Atoi(matchData[1])
 
 			if err == nil {
-				game.TrnBackups[turnNumber] = TrnFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
+				nation := game.gameNation(strings.TrimSuffix(BackupTrnBasename(f.Name()), ".trn"))
+				nation.TrnBackups[turnNumber] = TrnFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
 			}
+		} else if Valid2hFileName(f.Name()) {
+			nation := game.gameNation(strings.TrimSuffix(f.Name(), ".2h"))
+			nation.TwohFile = TwohFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
+			// A 2h we can't parse is still a 2h file, we just know less about it
+			nation.TwohFile.ReadHeader()
+		} else if ValidTrnFileName(f.Name()) {
+			nation := game.gameNation(strings.TrimSuffix(f.Name(), ".trn"))
+			nation.TrnFile = TrnFile{Filename: f.Name(), Fullpath: path.Join(basedir, f.Name())}
+			nation.TrnFile.ReadHeader()
 		}
 	}
 
-	for key := range game.TwohBackups {
-		game.SortedTwohBackupKeys = append(game.SortedTwohBackupKeys, key)
+	for _, nation := range game.Nations {
+		nation.sortBackupKeys()
 	}
-	sort.Ints(game.SortedTwohBackupKeys)
 
-	for key := range game.TrnBackups {
-		game.SortedTrnBackupKeys = append(game.SortedTrnBackupKeys, key)
+	game.SelectNation(game.defaultNationStem())
+
+	// Once there are archives, backups keep going there
+	if utility.FileExists(game.DefaultBackupStore()) {
+		err = game.UseBackupStore(game.DefaultBackupStore())
+		if err != nil {
+			return &game, err
+		}
 	}
-	sort.Ints(game.SortedTrnBackupKeys)
 
 	return &game, nil
 }
 
-// Return the number of the current game turn, that is the turn number of the highest 2h backup + 1
+// Return the number of the current game turn.
+// That is the turn number in the header of the trn or 2h file, or if neither can be read,
+// the turn number of the highest 2h backup + 1
 func (game *Game) CurrentTurnNumber() (currentTurnNumber int) {
+	if turnNumber, ok := game.HeaderTurnNumber(); ok {
+		return turnNumber
+	}
+
 	if len(game.SortedTwohBackupKeys) > 0 {
 		currentTurnNumber = game.SortedTwohBackupKeys[len(game.SortedTwohBackupKeys)-1] + 1
 	} else {
@@ -97,8 +122,31 @@ func (game *Game) CurrentTurnNumber() (currentTurnNumber int) {
 	return currentTurnNumber
 }
 
-// Backup the current trn and 2h files for this game
-func (game *Game) Backup(turnNumber int, force bool) error {
+// Return the turn number from the header of the current trn file, or the 2h file if the trn can't be read.
+// Headers that don't name this game are ignored, callers fall back to guessing from the backups.
+func (game *Game) HeaderTurnNumber() (int, bool) {
+	if game.trustsHeader(game.TrnFile.Header) && game.TrnFile.Header.TurnNumber > 0 {
+		return game.TrnFile.Header.TurnNumber, true
+	}
+
+	if game.trustsHeader(game.TwohFile.Header) && game.TwohFile.Header.TurnNumber > 0 {
+		return game.TwohFile.Header.TurnNumber, true
+	}
+
+	return 0, false
+}
+
+// Was the header read, and does it name this game? A header parsed with the wrong layout wouldn't.
+func (game *Game) trustsHeader(header *FileHeader) bool {
+	return header != nil && strings.ToLower(header.GameName) == strings.ToLower(game.Name)
+}
+
+// Backup the current trn and 2h files for this game. Either both are backed up, or neither.
+func (game *Game) Backup(turnNumber int, force bool) (err error) {
+	if game.BackupStore != "" {
+		return game.archiveCurrentFiles(turnNumber, force)
+	}
+
 	current2hPath := game.TwohFile.Fullpath
 
 	target2hPath, err := game.TwohFile.BackupFilepath(turnNumber)
@@ -117,52 +165,234 @@ func (game *Game) Backup(turnNumber int, force bool) error {
 		return errors.New(fmt.Sprintf("Backup for turn %v already exists in %v, not forcing", turnNumber, game.Directory))
 	}
 
-	err = utility.Cp(current2hPath, target2hPath)
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	err = tx.Copy(current2hPath, target2hPath)
 	if err != nil {
 		return err
 	}
 
-	err = utility.Cp(currentTrnPath, targetTrnPath)
+	err = tx.Copy(currentTrnPath, targetTrnPath)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return game.recordBackups(target2hPath, targetTrnPath)
 }
 
-// Restore backed up trn and 2h file for this game
-func (game *Game) Restore(turnNumber int) error {
-	current2hPath, err := game.Current2hFilepath()
+// Backup the current trn and 2h files into the archive for the turn
+func (game *Game) archiveCurrentFiles(turnNumber int, force bool) (err error) {
+	if game.TwohFile.Fullpath == "" || game.TrnFile.Fullpath == "" {
+		return errors.New("No turn file to back up found")
+	}
+
+	_, twohExists := game.TwohBackups[turnNumber]
+	_, trnExists := game.TrnBackups[turnNumber]
+
+	if !force && (twohExists || trnExists) {
+		return errors.New(fmt.Sprintf("Backup for turn %v already exists in %v, not forcing", turnNumber, game.BackupStore))
+	}
+
+	files, err := game.currentFiles(turnNumber, true, true)
 	if err != nil {
 		return err
 	}
 
-	currentTrnPath, err := game.CurrentTrnFilepath()
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	archivePath, err := game.archiveBackup(tx, turnNumber, files)
 	if err != nil {
 		return err
 	}
 
+	return game.recordBackups(archivePath)
+}
+
+// The contents of the current files, keyed by their backup names for the turn
+func (game *Game) currentFiles(turnNumber int, withTrn bool, withTwoh bool) (map[string]BackupContents, error) {
+	files := make(map[string]BackupContents)
+
+	if withTrn {
+		contents, err := readCurrentFile(game.TrnFile.Fullpath)
+		if err != nil {
+			return files, err
+		}
+
+		files[BackupTrnFilename(game.TrnFile.Filename, turnNumber)] = contents
+	}
+
+	if withTwoh {
+		contents, err := readCurrentFile(game.TwohFile.Fullpath)
+		if err != nil {
+			return files, err
+		}
+
+		files[Backup2hFilename(game.TwohFile.Filename, turnNumber)] = contents
+	}
+
+	return files, nil
+}
+
+// Backup the current turn before a new trn replaces it, and return the turn number it was backed up as.
+// Only the files that exist are backed up, and nothing if there is no current trn yet.
+// Errors if a different trn was already backed up for that turn, since one of them would be lost.
+func (game *Game) BackupCurrentTurn() (turnNumber int, err error) {
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	turnNumber, backedUp, err := game.backupCurrentTurn(tx)
+	if err != nil || len(backedUp) == 0 {
+		return turnNumber, err
+	}
+
+	return turnNumber, game.recordBackups(backedUp...)
+}
+
+// Back up the current turn as part of tx. Returns the backup files for the manifest, which is left to the caller.
+func (game *Game) backupCurrentTurn(tx *utility.Transaction) (turnNumber int, backedUp []string, err error) {
+	if !utility.FileExists(game.TrnFile.Fullpath) {
+		return 0, nil, nil
+	}
+
+	current, err := ioutil.ReadFile(game.TrnFile.Fullpath)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	turnNumber = game.CurrentTurnNumber()
+
+	// Without a header, the current turn counts up from the backups, so a turn that's already backed up looks like the next one
+	if _, ok := game.HeaderTurnNumber(); !ok && len(game.SortedTrnBackupKeys) > 0 {
+		newestTurnNumber := game.SortedTrnBackupKeys[len(game.SortedTrnBackupKeys)-1]
+		newestBackup := game.TrnBackups[newestTurnNumber]
+
+		newestData, err := newestBackup.Data()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if bytes.Equal(current, newestData) {
+			return newestTurnNumber, nil, nil
+		}
+	}
+
+	backupTrn := true
+
+	if backup, ok := game.TrnBackups[turnNumber]; ok {
+		backupData, err := backup.Data()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if !bytes.Equal(current, backupData) {
+			return turnNumber, nil, errors.New(fmt.Sprintf("%v differs from the backup for turn %v, not replacing it", game.TrnFile.Filename, turnNumber))
+		}
+
+		backupTrn = false
+	}
+
+	// An existing 2h backup might hold orders the player wants to keep, so it's never replaced
+	_, twohBackedUp := game.TwohBackups[turnNumber]
+	backupTwoh := utility.FileExists(game.TwohFile.Fullpath) && !twohBackedUp
+
+	if !backupTrn && !backupTwoh {
+		return turnNumber, nil, nil
+	}
+
+	if game.BackupStore != "" {
+		files, err := game.currentFiles(turnNumber, backupTrn, backupTwoh)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		archivePath, err := game.archiveBackup(tx, turnNumber, files)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return turnNumber, []string{archivePath}, nil
+	}
+
+	if backupTrn {
+		targetTrnPath, err := game.TrnFile.BackupFilepath(turnNumber)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		err = tx.Copy(game.TrnFile.Fullpath, targetTrnPath)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		backedUp = append(backedUp, targetTrnPath)
+	}
+
+	if backupTwoh {
+		target2hPath, err := game.TwohFile.BackupFilepath(turnNumber)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		err = tx.Copy(game.TwohFile.Fullpath, target2hPath)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		backedUp = append(backedUp, target2hPath)
+	}
+
+	return turnNumber, backedUp, nil
+}
+
+// Restore backed up trn and 2h file for this game. Either both are restored, or neither.
+func (game *Game) Restore(turnNumber int) (err error) {
 	// It's fine if only the 2h or the trn file have backups we'll just restore the one that exists.
 	// But if neither file exists, we error out.
-	backup2hPath, err := game.TwohFile.BackupFilepath(turnNumber)
-	backup2hExists := err == nil
-
-	backupTrnPath, err := game.TrnFile.BackupFilepath(turnNumber)
-	backupTrnExists := err == nil
+	backup2h, backup2hExists := game.TwohBackups[turnNumber]
+	backupTrn, backupTrnExists := game.TrnBackups[turnNumber]
 
 	if !(backup2hExists || backupTrnExists) {
 		return errors.New(fmt.Sprintf("Neither trn nor 2h backups exist for turn %v in %v", turnNumber, game.Directory))
 	}
 
+	// Restoring a damaged backup would only make things worse
+	if backup2hExists {
+		if err := game.checkBackups(backup2h.Fullpath); err != nil {
+			return err
+		}
+	}
+
+	if backupTrnExists {
+		if err := game.checkBackups(backupTrn.Fullpath); err != nil {
+			return err
+		}
+	}
+
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	// The current files might be missing, so their names come from the backups
 	if backup2hExists {
-		err = utility.Cp(backup2hPath, current2hPath)
+		contents, err := backup2h.Contents()
+		if err != nil {
+			return err
+		}
+
+		err = tx.WriteFile(path.Join(game.Directory, Backup2hBasename(backup2h.Filename)), contents.Data, 0644, contents.Modified)
 		if err != nil {
 			return err
 		}
 	}
 
 	if backupTrnExists {
-		err = utility.Cp(backupTrnPath, currentTrnPath)
+		contents, err := backupTrn.Contents()
+		if err != nil {
+			return err
+		}
+
+		err = tx.WriteFile(path.Join(game.Directory, BackupTrnBasename(backupTrn.Filename)), contents.Data, 0644, contents.Modified)
 		if err != nil {
 			return err
 		}
@@ -222,7 +452,8 @@ func (game *Game) Current2hFile() (string, error) {
 	case len(possibleMatches) == 0:
 		return "", errors.New(fmt.Sprintf("Could not find a 2h file for %s", game.Name))
 	case len(possibleMatches) > 1:
-		// Take the shortest filename. Ugly, but we have no way to check for valid nation names yet
+		// Files named after a nation win, backups and other copies usually aren't. Then take the shortest filename.
+		possibleMatches = preferNationFiles(possibleMatches)
 		sort.Sort(utility.ByLength(possibleMatches))
 	}
 
@@ -248,17 +479,35 @@ func (game *Game) CurrentTrnFile() (string, error) {
 	case len(possibleMatches) == 0:
 		return "", errors.New(fmt.Sprintf("Could not find a trn file for %s", game.Name))
 	case len(possibleMatches) > 1:
-		// Take the shortest filename. Ugly, but we have no way to check for valid nation names yet
+		// Files named after a nation win, backups and other copies usually aren't. Then take the shortest filename.
+		possibleMatches = preferNationFiles(possibleMatches)
 		sort.Sort(utility.ByLength(possibleMatches))
 	}
 
 	return possibleMatches[0], nil
 }
 
-// The name of the replay for the given turn number for this game.
-// Example: PretendersOfReddit13
+// Only keep the file names that belong to a known nation, unless there are none
+func preferNationFiles(filenames []string) []string {
+	var nationFiles []string
+
+	for _, filename := range filenames {
+		if _, ok := NationByFilename(filename); ok && BackupBasename(filename, strings.TrimPrefix(filepath.Ext(filename), ".")) == filename {
+			nationFiles = append(nationFiles, filename)
+		}
+	}
+
+	if len(nationFiles) == 0 {
+		return filenames
+	}
+
+	return nationFiles
+}
+
+// The name of the replay for the given turn number for this game, see ParseReplayName.
+// Example: PretendersOfReddit_turn13
 func (game *Game) ReplayName(turnNumber int) string {
-	return game.Name + strconv.Itoa(turnNumber)
+	return game.Name + ReplaySeparator + strconv.Itoa(turnNumber)
 }
 
 // Is the given filename a valid 2h file name?
@@ -1,11 +1,19 @@
 package game
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
 )
 
+// Names of the Dominions 4 executable on the different platforms, relative to the install directory
+var ExecutableNames = []string{"Dominions4.exe", "dom4.exe", "dom4.sh", "dom4_amd64", "dom4_x86", "Dominions4.app/Contents/MacOS/Dominions4", "dom4_mac"}
+
 // GameInstallation represents a Dominions 4 installation
 type GameInstallation struct {
 	BasePath       string
@@ -49,3 +57,18 @@ func availableGames(gameInstallation GameInstallation) []Game {
 
 	return games
 }
+
+// Find the Dominions 4 executable in the first of the directories that has one
+func FindExecutable(directories []string) (string, error) {
+	for _, directory := range directories {
+		for _, name := range ExecutableNames {
+			executable := filepath.Join(directory, filepath.FromSlash(name))
+
+			if info, err := os.Stat(executable); err == nil && !info.IsDir() {
+				return executable, nil
+			}
+		}
+	}
+
+	return "", errors.New(fmt.Sprintf("No Dominions 4 executable found in %v", strings.Join(directories, ", ")))
+}
@@ -1,6 +1,8 @@
 package game
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,3 +13,16 @@ func TestsavedGamesPath(t *testing.T) {
 
 	assert.Equal(t, "/home/nl/dominions4/savedgames", savedGamesPath(gameInstallation))
 }
+
+func TestFindExecutable(t *testing.T) {
+	empty := testGameDirectory(t)
+	installed := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(installed, "dom4.sh"), []byte("#!/bin/sh"), 0755))
+
+	executable, err := FindExecutable([]string{empty, installed})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(installed, "dom4.sh"), executable)
+
+	_, err = FindExecutable([]string{empty})
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GameNation is a nation played in a game, with its own current files and backups
+type GameNation struct {
+	// File name of the trn and 2h files without extension, e.g. early_agartha
+	Stem string
+
+	TwohFile             TwohFile
+	TrnFile              TrnFile
+	TwohBackups          map[int]TwohFile
+	TrnBackups           map[int]TrnFile
+	SortedTwohBackupKeys []int
+	SortedTrnBackupKeys  []int
+}
+
+// The nation for the given file stem, created if we haven't seen it yet
+func (game *Game) gameNation(stem string) *GameNation {
+	if nation, ok := game.Nations[stem]; ok {
+		return nation
+	}
+
+	nation := &GameNation{Stem: stem, TwohBackups: make(map[int]TwohFile), TrnBackups: make(map[int]TrnFile)}
+	game.Nations[stem] = nation
+
+	return nation
+}
+
+func (nation *GameNation) sortBackupKeys() {
+	nation.SortedTwohBackupKeys = nil
+	for key := range nation.TwohBackups {
+		nation.SortedTwohBackupKeys = append(nation.SortedTwohBackupKeys, key)
+	}
+	sort.Ints(nation.SortedTwohBackupKeys)
+
+	nation.SortedTrnBackupKeys = nil
+	for key := range nation.TrnBackups {
+		nation.SortedTrnBackupKeys = append(nation.SortedTrnBackupKeys, key)
+	}
+	sort.Ints(nation.SortedTrnBackupKeys)
+}
+
+// The nation from the built-in table, by header or file stem
+func (nation *GameNation) Nation() (Nation, bool) {
+	for _, header := range []*FileHeader{nation.TrnFile.Header, nation.TwohFile.Header} {
+		if header == nil {
+			continue
+		}
+
+		if n, ok := NationById(header.NationId); ok {
+			return n, true
+		}
+	}
+
+	return NationByFilename(nation.Stem + ".trn")
+}
+
+// The nation as it should be shown to the user.
+// Example: Agartha (Early Age), or the file stem for nations we don't know
+func (nation *GameNation) DisplayName() string {
+	if n, ok := nation.Nation(); ok {
+		return n.String()
+	}
+
+	return nation.Stem
+}
+
+// File stems of all nations in this game, sorted
+func (game *Game) NationStems() []string {
+	var stems []string
+
+	for stem := range game.Nations {
+		stems = append(stems, stem)
+	}
+
+	sort.Strings(stems)
+
+	return stems
+}
+
+// The nation to select if nobody asks for a specific one: the one with the current trn file,
+// the one with the current 2h file, or the only one there is
+func (game *Game) defaultNationStem() string {
+	// Without current files, these find backups, which aren't a nation of their own
+	if trnFile, err := game.CurrentTrnFile(); err == nil {
+		if _, ok := game.Nations[strings.TrimSuffix(trnFile, ".trn")]; ok {
+			return strings.TrimSuffix(trnFile, ".trn")
+		}
+	}
+
+	if twohFile, err := game.Current2hFile(); err == nil {
+		if _, ok := game.Nations[strings.TrimSuffix(twohFile, ".2h")]; ok {
+			return strings.TrimSuffix(twohFile, ".2h")
+		}
+	}
+
+	stems := game.NationStems()
+	if len(stems) == 0 {
+		return ""
+	}
+
+	return stems[0]
+}
+
+// Select the nation the game's files and backups refer to.
+// The nation can be given by file stem (early_agartha), by name (agartha, T'ien Ch'i) or by id (17),
+// as long as that is unambiguous within this game. An empty name selects no nation at all.
+func (game *Game) SelectNation(name string) error {
+	if name == "" {
+		game.useNation(&GameNation{TwohBackups: make(map[int]TwohFile), TrnBackups: make(map[int]TrnFile)})
+		return nil
+	}
+
+	nation, err := game.FindNation(name)
+	if err != nil {
+		return err
+	}
+
+	game.useNation(nation)
+
+	return nil
+}
+
+// Find a nation of this game, see SelectNation for the accepted names
+func (game *Game) FindNation(name string) (*GameNation, error) {
+	query := strings.ToLower(name)
+
+	var matches []*GameNation
+
+	for _, stem := range game.NationStems() {
+		nation := game.Nations[stem]
+
+		// The exact file stem always wins
+		if strings.ToLower(stem) == query {
+			return nation, nil
+		}
+
+		_, stemWithoutEra := splitEra(strings.ToLower(stem))
+		known, ok := nation.Nation()
+
+		switch {
+		case stemWithoutEra == query:
+			matches = append(matches, nation)
+		case ok && (strings.ToLower(known.Name) == query || fmt.Sprint(known.Id) == query):
+			matches = append(matches, nation)
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, errors.New(fmt.Sprintf("No nation %v in %v, available are: %v", name, game.Name, strings.Join(game.NationStems(), ", ")))
+	default:
+		var stems []string
+		for _, nation := range matches {
+			stems = append(stems, nation.Stem)
+		}
+
+		return nil, errors.New(fmt.Sprintf("%v could mean any of %v in %v", name, strings.Join(stems, ", "), game.Name))
+	}
+}
+
+// The selected nation, nil if there is none
+func (game *Game) SelectedNation() *GameNation {
+	return game.Nations[game.NationStem]
+}
+
+func (game *Game) useNation(nation *GameNation) {
+	game.NationStem = nation.Stem
+	game.TwohFile = nation.TwohFile
+	game.TrnFile = nation.TrnFile
+	game.TwohBackups = nation.TwohBackups
+	game.TrnBackups = nation.TrnBackups
+	game.SortedTwohBackupKeys = nation.SortedTwohBackupKeys
+	game.SortedTrnBackupKeys = nation.SortedTrnBackupKeys
+}
+
+// Split a file stem into era prefix and the rest.
+// Example: early_agartha -> early, agartha
+func splitEra(stem string) (string, string) {
+	for _, era := range []string{"early_", "mid_", "late_"} {
+		if strings.HasPrefix(stem, era) {
+			return strings.TrimSuffix(era, "_"), strings.TrimPrefix(stem, era)
+		}
+	}
+
+	return "", stem
+}
+
+// Every turn with a trn or 2h backup, sorted
+func (nation *GameNation) BackedUpTurns() []int {
+	var turns []int
+
+	for _, turn := range nation.SortedTrnBackupKeys {
+		turns = append(turns, turn)
+	}
+
+	for _, turn := range nation.SortedTwohBackupKeys {
+		if _, ok := nation.TrnBackups[turn]; !ok {
+			turns = append(turns, turn)
+		}
+	}
+
+	sort.Ints(turns)
+
+	return turns
+}
+
+// Turns between the first and the last backup that have no backup at all
+func (nation *GameNation) MissingTurns() []int {
+	var missing []int
+
+	turns := nation.BackedUpTurns()
+	if len(turns) == 0 {
+		return missing
+	}
+
+	for turn := turns[0]; turn < turns[len(turns)-1]; turn++ {
+		_, hasTrn := nation.TrnBackups[turn]
+		_, hasTwoh := nation.TwohBackups[turn]
+
+		if !hasTrn && !hasTwoh {
+			missing = append(missing, turn)
+		}
+	}
+
+	return missing
+}
+
+// Turns where only the trn or only the 2h was backed up
+func (nation *GameNation) UnpairedTurns() (trnOnly []int, twohOnly []int) {
+	for _, turn := range nation.SortedTrnBackupKeys {
+		if _, ok := nation.TwohBackups[turn]; !ok {
+			trnOnly = append(trnOnly, turn)
+		}
+	}
+
+	for _, turn := range nation.SortedTwohBackupKeys {
+		if _, ok := nation.TrnBackups[turn]; !ok {
+			twohOnly = append(twohOnly, turn)
+		}
+	}
+
+	return trnOnly, twohOnly
+}
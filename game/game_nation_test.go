@@ -0,0 +1,100 @@
+package game
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A game directory with two nations, as in a team game
+func testMultiNationGame(t *testing.T) *Game {
+	directory := testGameDirectory(t)
+
+	for _, filename := range []string{"early_ulm.trn", "early_ulm.2h", "early_ulm-1.trn", "early_ulm-1.2h", "early_ulm-2.trn", "early_ulm-2.2h", "early_agartha.trn", "early_agartha-2.trn", "early_agartha-2.2h"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, filename), []byte(filename), 0644))
+	}
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	return game
+}
+
+func TestNewGameFindsAllNations(t *testing.T) {
+	game := testMultiNationGame(t)
+
+	assert.Equal(t, []string{"early_agartha", "early_ulm"}, game.NationStems())
+	assert.Equal(t, []int{1, 2}, game.Nations["early_ulm"].SortedTrnBackupKeys)
+	assert.Equal(t, []int{2}, game.Nations["early_agartha"].SortedTwohBackupKeys)
+	assert.Equal(t, "", game.Nations["early_agartha"].TwohFile.Filename)
+}
+
+func TestSelectNation(t *testing.T) {
+	game := testMultiNationGame(t)
+
+	assert.NoError(t, game.SelectNation("early_ulm"))
+	assert.Equal(t, "early_ulm.trn", game.TrnFile.Filename)
+	assert.Equal(t, "early_ulm.2h", game.TwohFile.Filename)
+	assert.Equal(t, []int{1, 2}, game.SortedTwohBackupKeys)
+
+	assert.NoError(t, game.SelectNation("Agartha"))
+	assert.Equal(t, "early_agartha", game.NationStem)
+	assert.Equal(t, "early_agartha.trn", game.TrnFile.Filename)
+	assert.Equal(t, []int{2}, game.SortedTwohBackupKeys)
+
+	// By nation id
+	assert.NoError(t, game.SelectNation("7"))
+	assert.Equal(t, "early_ulm", game.NationStem)
+
+	assert.Error(t, game.SelectNation("mictlan"))
+}
+
+func TestSelectNationAmbiguous(t *testing.T) {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.trn"), []byte("trn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "late_ulm.trn"), []byte("trn"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	assert.Error(t, game.SelectNation("ulm"))
+	assert.NoError(t, game.SelectNation("late_ulm"))
+}
+
+func TestRestoreSelectedNation(t *testing.T) {
+	game := testMultiNationGame(t)
+	assert.NoError(t, game.SelectNation("agartha"))
+
+	assert.NoError(t, game.Restore(2))
+
+	// The missing 2h is restored from its backup, the other nation is left alone
+	data, err := ioutil.ReadFile(filepath.Join(game.Directory, "early_agartha.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "early_agartha-2.2h", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(game.Directory, "early_ulm.2h"))
+	assert.NoError(t, err)
+	assert.Equal(t, "early_ulm.2h", string(data))
+
+	assert.Error(t, game.Restore(1))
+}
+
+func TestBackupSummary(t *testing.T) {
+	nation := &GameNation{TwohBackups: make(map[int]TwohFile), TrnBackups: make(map[int]TrnFile)}
+	for _, turn := range []int{2, 3, 6} {
+		nation.TrnBackups[turn] = TrnFile{}
+	}
+	for _, turn := range []int{2, 4, 6} {
+		nation.TwohBackups[turn] = TwohFile{}
+	}
+	nation.sortBackupKeys()
+
+	assert.Equal(t, []int{2, 3, 4, 6}, nation.BackedUpTurns())
+	assert.Equal(t, []int{5}, nation.MissingTurns())
+
+	trnOnly, twohOnly := nation.UnpairedTurns()
+	assert.Equal(t, []int{3}, trnOnly)
+	assert.Equal(t, []int{4}, twohOnly)
+}
@@ -25,5 +25,25 @@ func TestReplayName(t *testing.T) {
 
 	replayName := game.ReplayName(24)
 
-	assert.Equal(t, "testgame24", replayName)
+	assert.Equal(t, "testgame_turn24", replayName)
+}
+
+func TestReplayNamesDontCollide(t *testing.T) {
+	foo1 := Game{Name: "foo1"}
+	foo12 := Game{Name: "foo12"}
+
+	assert.NotEqual(t, foo1.ReplayName(23), foo12.ReplayName(3))
+
+	gameName, turnNumber, ok := ParseReplayName(foo1.ReplayName(23))
+	assert.True(t, ok)
+	assert.Equal(t, "foo1", gameName)
+	assert.Equal(t, 23, turnNumber)
+
+	gameName, turnNumber, ok = ParseReplayName("foo_turn1_turn2")
+	assert.True(t, ok)
+	assert.Equal(t, "foo_turn1", gameName)
+	assert.Equal(t, 2, turnNumber)
+
+	_, _, ok = ParseReplayName("foo123")
+	assert.False(t, ok)
 }
@@ -0,0 +1,75 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MaildirMessage is a single message file in a Maildir
+type MaildirMessage struct {
+	Path  string
+	Flags string
+}
+
+// The unique part of the message file name, without the flags
+func (message MaildirMessage) uniqueName() string {
+	return strings.SplitN(filepath.Base(message.Path), ":", 2)[0]
+}
+
+// Has the message the given flag set? Flags are single uppercase letters, e.g. S for seen.
+func (message MaildirMessage) HasFlag(flag string) bool {
+	return strings.Contains(message.Flags, flag)
+}
+
+// All messages in the new/ and cur/ directories of a Maildir
+func ListMaildir(maildirPath string) ([]MaildirMessage, error) {
+	var messages []MaildirMessage
+
+	for _, subdirectory := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(maildirPath, subdirectory))
+		if err != nil {
+			return messages, err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+
+			message := MaildirMessage{Path: filepath.Join(maildirPath, subdirectory, f.Name())}
+
+			if info := strings.SplitN(f.Name(), ":2,", 2); len(info) == 2 {
+				message.Flags = info[1]
+			}
+
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// Add a flag to a message, which moves it to cur/ as well.
+// Returns the message with its new path.
+func (message MaildirMessage) AddFlag(flag string) (MaildirMessage, error) {
+	if message.HasFlag(flag) {
+		return message, nil
+	}
+
+	// Flags have to be in ASCII order
+	flags := strings.Split(message.Flags+flag, "")
+	sort.Strings(flags)
+
+	maildirPath := filepath.Dir(filepath.Dir(message.Path))
+	flagged := MaildirMessage{Path: filepath.Join(maildirPath, "cur", message.uniqueName()+":2,"+strings.Join(flags, "")), Flags: strings.Join(flags, "")}
+
+	err := os.Rename(message.Path, flagged.Path)
+	if err != nil {
+		return message, err
+	}
+
+	return flagged, nil
+}
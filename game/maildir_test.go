@@ -0,0 +1,58 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+// Create an empty Maildir in a temporary directory
+func testMaildir(t *testing.T) string {
+	maildirPath := testGameDirectory(t)
+
+	for _, subdirectory := range []string{"new", "cur", "tmp"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(maildirPath, subdirectory), 0700))
+	}
+
+	return maildirPath
+}
+
+func TestListMaildir(t *testing.T) {
+	maildirPath := testMaildir(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(maildirPath, "new", "1.host"), []byte{}, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(maildirPath, "cur", "2.host:2,FS"), []byte{}, 0600))
+
+	messages, err := ListMaildir(maildirPath)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []MaildirMessage{
+		{Path: filepath.Join(maildirPath, "new", "1.host")},
+		{Path: filepath.Join(maildirPath, "cur", "2.host:2,FS"), Flags: "FS"},
+	}, messages)
+}
+
+func TestMaildirMessageAddFlag(t *testing.T) {
+	maildirPath := testMaildir(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(maildirPath, "cur", "1.host:2,T"), []byte{}, 0600))
+
+	message, err := MaildirMessage{Path: filepath.Join(maildirPath, "cur", "1.host:2,T"), Flags: "T"}.AddFlag("S")
+
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(maildirPath, "cur", "1.host:2,ST"), message.Path)
+	assert.True(t, message.HasFlag("S"))
+	assert.True(t, utility.FileExists(message.Path))
+}
+
+func TestMaildirMessageAddFlagMovesNewMessages(t *testing.T) {
+	maildirPath := testMaildir(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(maildirPath, "new", "1.host"), []byte{}, 0600))
+
+	message, err := MaildirMessage{Path: filepath.Join(maildirPath, "new", "1.host")}.AddFlag("S")
+
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(maildirPath, "cur", "1.host:2,S"), message.Path)
+}
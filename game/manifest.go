@@ -0,0 +1,308 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Name of the directory in a game directory where d4t keeps its own files
+const MetadataDirectory = ".d4t"
+
+// Manifest records the checksum of every backup d4t made for a game, so we can tell if one was altered later
+type Manifest struct {
+	Path    string                   `json:"-"`
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry describes a backup file when it was written. Keyed by file name in the manifest.
+type ManifestEntry struct {
+	Sha256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	Recorded time.Time `json:"recorded"`
+	// Set by the player to keep the backup when pruning
+	Label string `json:"label,omitempty"`
+}
+
+// The result of checking the backups of a game against its manifest. All lists hold file names.
+type VerifyResult struct {
+	Verified  []string
+	Missing   []string
+	Altered   []string
+	Untracked []string
+	// Files interrupted changes left behind, see RecoverLeftovers
+	Leftovers []utility.Leftover
+	// Archives that couldn't be read, with the reason
+	Broken []string
+}
+
+// Path of the backup manifest of this game
+func (game *Game) ManifestPath() string {
+	return filepath.Join(game.Directory, MetadataDirectory, "manifest.json")
+}
+
+// Load the manifest at path. A missing manifest is simply empty.
+func LoadManifest(path string) (*Manifest, error) {
+	manifest := &Manifest{Path: path, Entries: make(map[string]ManifestEntry)}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(raw, manifest)
+	if err != nil {
+		return manifest, errors.New(fmt.Sprintf("Broken manifest %v: %v", path, err.Error()))
+	}
+
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]ManifestEntry)
+	}
+
+	return manifest, nil
+}
+
+// Describe the file as it is now
+func newManifestEntry(fullpath string) (ManifestEntry, error) {
+	info, err := os.Stat(fullpath)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	hash, err := utility.Sha256File(fullpath)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	return ManifestEntry{Sha256: hash, Size: info.Size(), Recorded: time.Now()}, nil
+}
+
+// Record the file as it is now, replacing any earlier entry for it
+func (manifest *Manifest) Record(fullpath string) error {
+	entry, err := newManifestEntry(fullpath)
+	if err != nil {
+		return err
+	}
+
+	// A new backup of a labelled turn is still labelled
+	entry.Label = manifest.Entries[filepath.Base(fullpath)].Label
+	manifest.Entries[filepath.Base(fullpath)] = entry
+
+	return nil
+}
+
+// Is the data what the entry describes?
+func (entry ManifestEntry) MatchesData(data []byte) bool {
+	hash := sha256.Sum256(data)
+
+	return int64(len(data)) == entry.Size && hex.EncodeToString(hash[:]) == entry.Sha256
+}
+
+// Does the file still match its entry? Files without an entry are fine.
+func (manifest *Manifest) Matches(fullpath string) (bool, error) {
+	entry, ok := manifest.Entries[filepath.Base(fullpath)]
+	if !ok {
+		return true, nil
+	}
+
+	current, err := newManifestEntry(fullpath)
+	if err != nil {
+		return false, err
+	}
+
+	return current.Size == entry.Size && current.Sha256 == entry.Sha256, nil
+}
+
+func (manifest *Manifest) Save() error {
+	raw, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(manifest.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return utility.WriteFile(manifest.Path, raw, 0644)
+}
+
+// Add the given backup files to the manifest of this game
+func (game *Game) recordBackups(fullpaths ...string) error {
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return err
+	}
+
+	for _, fullpath := range fullpaths {
+		err = manifest.Record(fullpath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return manifest.Save()
+}
+
+// Replace the entries of backup files by one for the archive they were moved to, keeping their label
+func (game *Game) moveManifestEntries(archivePath string, fullpaths ...string) error {
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return err
+	}
+
+	label := ""
+
+	for _, fullpath := range fullpaths {
+		if entry, ok := manifest.Entries[filepath.Base(fullpath)]; ok && entry.Label != "" {
+			label = entry.Label
+		}
+
+		delete(manifest.Entries, filepath.Base(fullpath))
+	}
+
+	err = manifest.Record(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if label != "" {
+		entry := manifest.Entries[filepath.Base(archivePath)]
+		entry.Label = label
+		manifest.Entries[filepath.Base(archivePath)] = entry
+	}
+
+	return manifest.Save()
+}
+
+// Make sure the given backup files weren't altered since we made them
+func (game *Game) checkBackups(fullpaths ...string) error {
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return err
+	}
+
+	for _, fullpath := range fullpaths {
+		matches, err := manifest.Matches(fullpath)
+		if err != nil {
+			return err
+		}
+
+		if !matches {
+			return errors.New(fmt.Sprintf("%v was altered since it was backed up, see d4t verify %v", fullpath, game.Name))
+		}
+	}
+
+	return nil
+}
+
+// Check every backup of every nation in this game against the manifest
+func (game *Game) VerifyBackups() (VerifyResult, error) {
+	result := VerifyResult{}
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return result, err
+	}
+
+	backups := make(map[string]bool)
+
+	// Archived backups share their archive, which is what the manifest tracks
+	for _, nation := range game.Nations {
+		for _, backup := range nation.TwohBackups {
+			backups[filepath.Base(backup.Fullpath)] = true
+		}
+
+		for _, backup := range nation.TrnBackups {
+			backups[filepath.Base(backup.Fullpath)] = true
+		}
+	}
+
+	for filename := range backups {
+		if _, ok := manifest.Entries[filename]; !ok {
+			result.Untracked = append(result.Untracked, filename)
+		}
+	}
+
+	for filename, entry := range manifest.Entries {
+		fullpath := filepath.Join(game.Directory, filename)
+		if strings.HasSuffix(filename, BackupArchiveExtension) {
+			fullpath = filepath.Join(game.backupStore(), filename)
+		}
+
+		current, err := newManifestEntry(fullpath)
+		switch {
+		case os.IsNotExist(err):
+			result.Missing = append(result.Missing, filename)
+		case err != nil:
+			return result, err
+		case current.Size != entry.Size || current.Sha256 != entry.Sha256:
+			result.Altered = append(result.Altered, filename)
+		default:
+			result.Verified = append(result.Verified, filename)
+		}
+	}
+
+	result.Broken = append(result.Broken, game.BrokenArchives...)
+
+	for _, directory := range game.transactionDirectories() {
+		leftovers, err := utility.FindLeftovers(directory)
+		if err != nil {
+			return result, err
+		}
+
+		result.Leftovers = append(result.Leftovers, leftovers...)
+	}
+
+	sort.Strings(result.Verified)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Altered)
+	sort.Strings(result.Untracked)
+
+	return result, nil
+}
+
+// Did the verification find anything wrong?
+func (result VerifyResult) Ok() bool {
+	return len(result.Missing) == 0 && len(result.Altered) == 0 && len(result.Untracked) == 0 && len(result.Leftovers) == 0 && len(result.Broken) == 0
+}
+
+// Clean up what interrupted changes left in the directories of the game, see utility.RecoverLeftovers.
+// Returns the leftovers that were cleaned up, and the ones that are left for the user to sort out.
+func (game *Game) RecoverLeftovers() (recovered []utility.Leftover, left []utility.Leftover, err error) {
+	for _, directory := range game.transactionDirectories() {
+		directoryRecovered, directoryLeft, err := utility.RecoverLeftovers(directory)
+		recovered = append(recovered, directoryRecovered...)
+		left = append(left, directoryLeft...)
+
+		if err != nil {
+			return recovered, left, err
+		}
+	}
+
+	return recovered, left, nil
+}
+
+// The directories d4t changes files of the game in
+func (game *Game) transactionDirectories() []string {
+	directories := []string{game.Directory, filepath.Join(game.Directory, MetadataDirectory)}
+
+	if !utility.Contains(directories, game.backupStore()) {
+		directories = append(directories, game.backupStore())
+	}
+
+	return directories
+}
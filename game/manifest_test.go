@@ -0,0 +1,127 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+// A game with current files, backed up as turn 1
+func testBackedUpGame(t *testing.T) *Game {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.trn"), []byte("turn"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm.2h"), []byte("orders"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	assert.NoError(t, game.Backup(1, false))
+
+	game, err = NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	return game
+}
+
+func TestBackupRecordsManifest(t *testing.T) {
+	game := testBackedUpGame(t)
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Entries, 2)
+	assert.Equal(t, int64(6), manifest.Entries["early_ulm-1.2h"].Size)
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.True(t, result.Ok())
+	assert.Equal(t, []string{"early_ulm-1.2h", "early_ulm-1.trn"}, result.Verified)
+}
+
+func TestVerifyBackupsFindsProblems(t *testing.T) {
+	game := testBackedUpGame(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-1.2h"), []byte("other orders"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(game.Directory, "early_ulm-1.trn")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-2.trn"), []byte("turn"), 0644))
+
+	game, err := NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.False(t, result.Ok())
+	assert.Equal(t, []string{"early_ulm-1.2h"}, result.Altered)
+	assert.Equal(t, []string{"early_ulm-1.trn"}, result.Missing)
+	assert.Equal(t, []string{"early_ulm-2.trn"}, result.Untracked)
+}
+
+func TestVerifyBackupsFindsLeftovers(t *testing.T) {
+	game := testBackedUpGame(t)
+	// A crash while replacing the backup, and while removing the current 2h, a day ago
+	crashed := strconv.FormatInt(time.Now().AddDate(0, 0, -1).Unix(), 10)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, ".early_ulm-1.trn.old"+crashed+"-1"), []byte("turn"), 0644))
+	assert.NoError(t, os.Rename(filepath.Join(game.Directory, "early_ulm.2h"), filepath.Join(game.Directory, ".early_ulm.2h.old"+crashed+"-2")))
+
+	result, err := game.VerifyBackups()
+	assert.NoError(t, err)
+	assert.False(t, result.Ok())
+	assert.Len(t, result.Leftovers, 2)
+
+	recovered, left, err := game.RecoverLeftovers()
+	assert.NoError(t, err)
+	assert.Len(t, recovered, 1)
+	assert.Equal(t, filepath.Join(game.Directory, "early_ulm.2h"), recovered[0].Original)
+	assert.Len(t, left, 1)
+	assert.Equal(t, filepath.Join(game.Directory, "early_ulm-1.trn"), left[0].Original)
+	assert.True(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm.2h")))
+}
+
+func TestRestoreRefusesAlteredBackup(t *testing.T) {
+	game := testBackedUpGame(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-1.2h"), []byte("other orders"), 0644))
+
+	assert.Error(t, game.Restore(1))
+}
+
+func TestBackupCurrentTurn(t *testing.T) {
+	game := testBackedUpGame(t)
+
+	// Already backed up as turn 1
+	turnNumber, err := game.BackupCurrentTurn()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, turnNumber)
+	assert.False(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-2.trn")))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm.trn"), []byte("next turn"), 0644))
+	game, err = NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+
+	turnNumber, err = game.BackupCurrentTurn()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, turnNumber)
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	assert.NoError(t, err)
+	assert.Contains(t, manifest.Entries, "early_ulm-2.trn")
+	assert.Contains(t, manifest.Entries, "early_ulm-2.2h")
+}
+
+func TestBackupCurrentTurnRefusesDifferentBackup(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_ulm.trn"), FileHeader{Version: 433, TurnNumber: 3, GameName: "testgame"})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm-3.trn"), []byte("another turn"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	_, err = game.BackupCurrentTurn()
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_ulm-3.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "another turn", string(data))
+}
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Split an mbox file into its raw messages.
+// Messages start with a "From " line, ">From " escapes (mboxrd and mboxo) inside the messages are undone.
+func SplitMbox(r io.Reader) ([][]byte, error) {
+	var messages [][]byte
+	var current *bytes.Buffer
+
+	reader := bufio.NewReader(r)
+	previousLineBlank := true
+
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			content := strings.TrimRight(line, "\r\n")
+
+			switch {
+			case previousLineBlank && strings.HasPrefix(content, "From "):
+				if current != nil {
+					messages = append(messages, current.Bytes())
+				}
+				current = new(bytes.Buffer)
+			case current != nil:
+				if strings.HasPrefix(content, ">") && strings.HasPrefix(strings.TrimLeft(content, ">"), "From ") {
+					line = line[1:]
+				}
+				current.WriteString(line)
+			}
+
+			previousLineBlank = content == ""
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return messages, err
+		}
+	}
+
+	if current != nil {
+		messages = append(messages, current.Bytes())
+	}
+
+	return messages, nil
+}
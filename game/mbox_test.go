@@ -0,0 +1,35 @@
+package game
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMbox(t *testing.T) {
+	mbox := "From turns@llamaserver.net Wed May 11 14:31:59 2016\n" +
+		"Subject: first\n" +
+		"\n" +
+		">From the archives\n" +
+		">>From deeper\n" +
+		"\n" +
+		"From turns@llamaserver.net Thu May 12 14:31:59 2016\n" +
+		"Subject: second\n" +
+		"\n" +
+		"body\n"
+
+	messages, err := SplitMbox(strings.NewReader(mbox))
+
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "Subject: first\n\nFrom the archives\n>From deeper\n\n", string(messages[0]))
+	assert.Equal(t, "Subject: second\n\nbody\n", string(messages[1]))
+}
+
+func TestSplitMboxEmpty(t *testing.T) {
+	messages, err := SplitMbox(strings.NewReader(""))
+
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+}
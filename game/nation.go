@@ -0,0 +1,192 @@
+package game
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type Era int
+
+const (
+	EarlyAge Era = iota + 1
+	MiddleAge
+	LateAge
+)
+
+// Nation is a Dominions 4 nation. Every era has its own nations, even if they share a name.
+type Nation struct {
+	Id   int
+	Era  Era
+	Stem string
+	Name string
+}
+
+// All nations of the unmodded game. Stem is the file name without extension, as used for trn and 2h files.
+// The game leaves gaps in the ids, kept free for new nations of each era.
+var Nations = []Nation{
+	{5, EarlyAge, "early_arcoscephale", "Arcoscephale"},
+	{6, EarlyAge, "early_ermor", "Ermor"},
+	{7, EarlyAge, "early_ulm", "Ulm"},
+	{8, EarlyAge, "early_marverni", "Marverni"},
+	{9, EarlyAge, "early_sauromatia", "Sauromatia"},
+	{10, EarlyAge, "early_tienchi", "T'ien Ch'i"},
+	{11, EarlyAge, "early_machaka", "Machaka"},
+	{12, EarlyAge, "early_mictlan", "Mictlan"},
+	{13, EarlyAge, "early_abysia", "Abysia"},
+	{14, EarlyAge, "early_caelum", "Caelum"},
+	{15, EarlyAge, "early_ctis", "C'tis"},
+	{16, EarlyAge, "early_pangaea", "Pangaea"},
+	{17, EarlyAge, "early_agartha", "Agartha"},
+	{18, EarlyAge, "early_tirnanog", "Tir na n'Og"},
+	{19, EarlyAge, "early_fomoria", "Fomoria"},
+	{20, EarlyAge, "early_vanheim", "Vanheim"},
+	{21, EarlyAge, "early_helheim", "Helheim"},
+	{22, EarlyAge, "early_niefelheim", "Niefelheim"},
+	{24, EarlyAge, "early_kailasa", "Kailasa"},
+	{25, EarlyAge, "early_lanka", "Lanka"},
+	{26, EarlyAge, "early_yomi", "Yomi"},
+	{27, EarlyAge, "early_hinnom", "Hinnom"},
+	{28, EarlyAge, "early_ur", "Ur"},
+	{29, EarlyAge, "early_berytos", "Berytos"},
+	{30, EarlyAge, "early_xibalba", "Xibalba"},
+	{31, EarlyAge, "early_mekone", "Mekone"},
+	{36, EarlyAge, "early_atlantis", "Atlantis"},
+	{37, EarlyAge, "early_rlyeh", "R'lyeh"},
+	{38, EarlyAge, "early_pelagia", "Pelagia"},
+	{39, EarlyAge, "early_oceania", "Oceania"},
+	{40, EarlyAge, "early_therodos", "Therodos"},
+	{43, MiddleAge, "mid_arcoscephale", "Arcoscephale"},
+	{44, MiddleAge, "mid_ermor", "Ermor"},
+	{45, MiddleAge, "mid_sceleria", "Sceleria"},
+	{46, MiddleAge, "mid_pythium", "Pythium"},
+	{47, MiddleAge, "mid_man", "Man"},
+	{48, MiddleAge, "mid_eriu", "Eriu"},
+	{49, MiddleAge, "mid_ulm", "Ulm"},
+	{50, MiddleAge, "mid_marignon", "Marignon"},
+	{51, MiddleAge, "mid_mictlan", "Mictlan"},
+	{52, MiddleAge, "mid_tienchi", "T'ien Ch'i"},
+	{53, MiddleAge, "mid_machaka", "Machaka"},
+	{54, MiddleAge, "mid_agartha", "Agartha"},
+	{55, MiddleAge, "mid_abysia", "Abysia"},
+	{56, MiddleAge, "mid_caelum", "Caelum"},
+	{57, MiddleAge, "mid_ctis", "C'tis"},
+	{58, MiddleAge, "mid_pangaea", "Pangaea"},
+	{59, MiddleAge, "mid_asphodel", "Asphodel"},
+	{60, MiddleAge, "mid_vanheim", "Vanheim"},
+	{61, MiddleAge, "mid_jotunheim", "Jotunheim"},
+	{62, MiddleAge, "mid_vanarus", "Vanarus"},
+	{63, MiddleAge, "mid_bandarlog", "Bandar Log"},
+	{64, MiddleAge, "mid_shinuyama", "Shinuyama"},
+	{65, MiddleAge, "mid_ashdod", "Ashdod"},
+	{66, MiddleAge, "mid_uruk", "Uruk"},
+	{67, MiddleAge, "mid_nazca", "Nazca"},
+	{68, MiddleAge, "mid_xibalba", "Xibalba"},
+	{69, MiddleAge, "mid_phlegra", "Phlegra"},
+	{70, MiddleAge, "mid_phaeacia", "Phaeacia"},
+	{73, MiddleAge, "mid_atlantis", "Atlantis"},
+	{74, MiddleAge, "mid_rlyeh", "R'lyeh"},
+	{75, MiddleAge, "mid_pelagia", "Pelagia"},
+	{76, MiddleAge, "mid_oceania", "Oceania"},
+	{77, MiddleAge, "mid_ys", "Ys"},
+	{80, LateAge, "late_arcoscephale", "Arcoscephale"},
+	{81, LateAge, "late_pythium", "Pythium"},
+	{82, LateAge, "late_lemuria", "Lemuria"},
+	{83, LateAge, "late_man", "Man"},
+	{84, LateAge, "late_ulm", "Ulm"},
+	{85, LateAge, "late_marignon", "Marignon"},
+	{86, LateAge, "late_mictlan", "Mictlan"},
+	{87, LateAge, "late_tienchi", "T'ien Ch'i"},
+	{89, LateAge, "late_jomon", "Jomon"},
+	{90, LateAge, "late_agartha", "Agartha"},
+	{91, LateAge, "late_abysia", "Abysia"},
+	{92, LateAge, "late_caelum", "Caelum"},
+	{93, LateAge, "late_ctis", "C'tis"},
+	{94, LateAge, "late_pangaea", "Pangaea"},
+	{95, LateAge, "late_midgard", "Midgård"},
+	{96, LateAge, "late_utgard", "Utgård"},
+	{97, LateAge, "late_bogarus", "Bogarus"},
+	{98, LateAge, "late_patala", "Patala"},
+	{99, LateAge, "late_gath", "Gath"},
+	{100, LateAge, "late_ragha", "Ragha"},
+	{101, LateAge, "late_xibalba", "Xibalba"},
+	{102, LateAge, "late_phlegra", "Phlegra"},
+	{106, LateAge, "late_atlantis", "Atlantis"},
+	{107, LateAge, "late_rlyeh", "R'lyeh"},
+	{108, LateAge, "late_erytheia", "Erytheia"},
+}
+
+// The name of the era, as the game shows it
+func (era Era) String() string {
+	switch era {
+	case EarlyAge:
+		return "Early Age"
+	case MiddleAge:
+		return "Middle Age"
+	case LateAge:
+		return "Late Age"
+	default:
+		return "Unknown Age"
+	}
+}
+
+// The display name with the era.
+// Example: Agartha (Early Age)
+func (nation Nation) String() string {
+	return fmt.Sprintf("%v (%v)", nation.Name, nation.Era)
+}
+
+// Find a nation by the id Dominions 4 uses in trn and 2h headers
+func NationById(id int) (Nation, bool) {
+	for _, nation := range Nations {
+		if nation.Id == id {
+			return nation, true
+		}
+	}
+
+	return Nation{}, false
+}
+
+// Find the nation a trn or 2h file belongs to by its name. Backup file names work, too.
+// Example: early_agartha-12.trn -> Agartha (Early Age)
+func NationByFilename(filename string) (Nation, bool) {
+	base := filepath.Base(filename)
+
+	switch filepath.Ext(base) {
+	case ".trn":
+		base = BackupTrnBasename(base)
+	case ".2h":
+		base = Backup2hBasename(base)
+	}
+
+	stem := strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base)))
+
+	for _, nation := range Nations {
+		if nation.Stem == stem {
+			return nation, true
+		}
+	}
+
+	return Nation{}, false
+}
+
+// The nation this game is played as, from the header of the trn or 2h file if it names the game, or from their names
+func (game *Game) Nation() (Nation, bool) {
+	for _, header := range []*FileHeader{game.TrnFile.Header, game.TwohFile.Header} {
+		if !game.trustsHeader(header) {
+			continue
+		}
+
+		if nation, ok := NationById(header.NationId); ok {
+			return nation, true
+		}
+	}
+
+	for _, filename := range []string{game.TrnFile.Filename, game.TwohFile.Filename} {
+		if nation, ok := NationByFilename(filename); ok {
+			return nation, true
+		}
+	}
+
+	return Nation{}, false
+}
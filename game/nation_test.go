@@ -0,0 +1,108 @@
+package game
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNationsAreUnique(t *testing.T) {
+	ids := make(map[int]bool)
+	stems := make(map[string]bool)
+
+	for _, nation := range Nations {
+		assert.False(t, ids[nation.Id], "duplicate id %v", nation.Id)
+		assert.False(t, stems[nation.Stem], "duplicate stem %v", nation.Stem)
+
+		ids[nation.Id] = true
+		stems[nation.Stem] = true
+	}
+}
+
+func TestNationsPerEra(t *testing.T) {
+	count := make(map[Era]int)
+	for _, nation := range Nations {
+		count[nation.Era]++
+	}
+
+	assert.Equal(t, map[Era]int{EarlyAge: 31, MiddleAge: 33, LateAge: 25}, count)
+
+	nation, ok := NationById(31)
+	assert.True(t, ok)
+	assert.Equal(t, "Mekone (Early Age)", nation.String())
+
+	nation, ok = NationByFilename("late_xibalba.trn")
+	assert.True(t, ok)
+	assert.Equal(t, 101, nation.Id)
+}
+
+func TestNationString(t *testing.T) {
+	nation, ok := NationById(17)
+
+	assert.True(t, ok)
+	assert.Equal(t, "Agartha (Early Age)", nation.String())
+}
+
+func TestNationById(t *testing.T) {
+	nation, ok := NationById(87)
+	assert.True(t, ok)
+	assert.Equal(t, "late_tienchi", nation.Stem)
+	assert.Equal(t, LateAge, nation.Era)
+
+	_, ok = NationById(1000)
+	assert.False(t, ok)
+}
+
+func TestNationByFilename(t *testing.T) {
+	nation, ok := NationByFilename("early_agartha.trn")
+	assert.True(t, ok)
+	assert.Equal(t, 17, nation.Id)
+
+	nation, ok = NationByFilename("/home/test/dominions4/savedgames/testgame/mid_bandarlog-12.2h")
+	assert.True(t, ok)
+	assert.Equal(t, "Bandar Log (Middle Age)", nation.String())
+
+	_, ok = NationByFilename("ftherlnd")
+	assert.False(t, ok)
+}
+
+func TestGameNationPrefersHeader(t *testing.T) {
+	directory := testGameDirectory(t)
+	// Renamed file, but the header knows better
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha.trn"), FileHeader{TurnNumber: 3, NationId: 13, GameName: "testgame"})
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	nation, ok := game.Nation()
+	assert.True(t, ok)
+	assert.Equal(t, "Abysia (Early Age)", nation.String())
+}
+
+func TestGameNationFromFilename(t *testing.T) {
+	directory := testGameDirectory(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "late_ulm.trn"), []byte("garbage"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	nation, ok := game.Nation()
+	assert.True(t, ok)
+	assert.Equal(t, "Ulm (Late Age)", nation.String())
+}
+
+func TestCurrentFilesPreferNationFiles(t *testing.T) {
+	directory := testGameDirectory(t)
+	for _, filename := range []string{"early_ulm.trn", "x.trn", "early_ulm.2h", "mid_ys.2h"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, filename), []byte("garbage"), 0644))
+	}
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "early_ulm.trn", game.TrnFile.Filename)
+	// mid_ys.2h is shorter, but we got the turn for early_ulm
+	assert.Equal(t, "early_ulm.2h", game.TwohFile.Filename)
+}
@@ -0,0 +1,94 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// OrdersSnapshot is what the 2h file of a nation looked like at some point, to tell whether it was saved since
+type OrdersSnapshot struct {
+	Fullpath string
+	Exists   bool
+	Modified time.Time
+	Sha256   string
+}
+
+// Look for signs that the current 2h file doesn't hold new orders for the given turn:
+// it is older than the trn file, its header is for an earlier turn, or it is identical to the 2h backed up for the turn before.
+// Returns a description of every problem found, nothing if the orders look fine.
+func (game *Game) StaleOrdersWarnings(turnNumber int) ([]string, error) {
+	var warnings []string
+
+	twohInfo, err := os.Stat(game.TwohFile.Fullpath)
+	if err != nil {
+		return warnings, err
+	}
+
+	if game.TrnFile.Fullpath != "" {
+		if trnInfo, err := os.Stat(game.TrnFile.Fullpath); err == nil && twohInfo.ModTime().Before(trnInfo.ModTime()) {
+			warnings = append(warnings, fmt.Sprintf("%v is older than %v, were the orders saved?", game.TwohFile.Filename, game.TrnFile.Filename))
+		}
+	}
+
+	if game.trustsHeader(game.TwohFile.Header) && game.trustsHeader(game.TrnFile.Header) && game.TwohFile.Header.TurnNumber < game.TrnFile.Header.TurnNumber {
+		warnings = append(warnings, fmt.Sprintf("%v has orders for turn %v, but %v is turn %v", game.TwohFile.Filename, game.TwohFile.Header.TurnNumber, game.TrnFile.Filename, game.TrnFile.Header.TurnNumber))
+	}
+
+	if previousBackup, ok := game.TwohBackups[turnNumber-1]; ok {
+		current, err := ioutil.ReadFile(game.TwohFile.Fullpath)
+		if err != nil {
+			return warnings, err
+		}
+
+		previous, err := previousBackup.Data()
+		if err == nil && bytes.Equal(current, previous) {
+			warnings = append(warnings, fmt.Sprintf("%v is identical to the orders of turn %v", game.TwohFile.Filename, turnNumber-1))
+		}
+	}
+
+	return warnings, nil
+}
+
+// Remember the current 2h file of the selected nation. A nation that hasn't saved orders yet gets a snapshot of a missing file.
+func (game *Game) OrdersSnapshot() (OrdersSnapshot, error) {
+	fullpath := game.TwohFile.Fullpath
+	if fullpath == "" {
+		fullpath = filepath.Join(game.Directory, game.NationStem+".2h")
+	}
+
+	return takeOrdersSnapshot(fullpath)
+}
+
+// Was the 2h file written since the snapshot was taken?
+func (snapshot OrdersSnapshot) Changed() (bool, error) {
+	current, err := takeOrdersSnapshot(snapshot.Fullpath)
+	if err != nil {
+		return false, err
+	}
+
+	return current != snapshot, nil
+}
+
+func takeOrdersSnapshot(fullpath string) (OrdersSnapshot, error) {
+	snapshot := OrdersSnapshot{Fullpath: fullpath}
+
+	info, err := os.Stat(fullpath)
+	if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.Exists = true
+	snapshot.Modified = info.ModTime()
+	snapshot.Sha256, err = utility.Sha256File(fullpath)
+
+	return snapshot, err
+}
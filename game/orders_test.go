@@ -0,0 +1,107 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOrdersGame(t *testing.T, twohAge time.Duration, trnAge time.Duration) *Game {
+	directory := testGameDirectory(t)
+	now := time.Now()
+
+	writeTestTurnFile(t, filepath.Join(directory, "early_ulm.trn"), FileHeader{TurnNumber: 5, NationId: 7, GameName: "testgame"})
+	writeTestTurnFile(t, filepath.Join(directory, "early_ulm.2h"), FileHeader{TurnNumber: 5, NationId: 7, GameName: "testgame"})
+	assert.NoError(t, os.Chtimes(filepath.Join(directory, "early_ulm.trn"), now.Add(-trnAge), now.Add(-trnAge)))
+	assert.NoError(t, os.Chtimes(filepath.Join(directory, "early_ulm.2h"), now.Add(-twohAge), now.Add(-twohAge)))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_ulm-4.2h"), []byte("last turn's orders"), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	return game
+}
+
+func TestStaleOrdersWarningsForFreshOrders(t *testing.T) {
+	game := testOrdersGame(t, time.Minute, time.Hour)
+
+	warnings, err := game.StaleOrdersWarnings(5)
+
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestStaleOrdersWarningsForUnsavedOrders(t *testing.T) {
+	game := testOrdersGame(t, time.Hour, time.Minute)
+
+	warnings, err := game.StaleOrdersWarnings(5)
+
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+}
+
+func TestStaleOrdersWarningsForOldTurn(t *testing.T) {
+	game := testOrdersGame(t, time.Minute, time.Hour)
+	writeTestTurnFile(t, game.TwohFile.Fullpath, FileHeader{TurnNumber: 4, NationId: 7, GameName: "testgame"})
+	assert.NoError(t, game.TwohFile.ReadHeader())
+
+	warnings, err := game.StaleOrdersWarnings(5)
+
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "turn 4")
+}
+
+func TestStaleOrdersWarningsForRepeatedOrders(t *testing.T) {
+	game := testOrdersGame(t, time.Minute, time.Hour)
+	assert.NoError(t, ioutil.WriteFile(game.TwohBackups[4].Fullpath, []byte("same orders"), 0644))
+	assert.NoError(t, ioutil.WriteFile(game.TwohFile.Fullpath, []byte("same orders"), 0644))
+
+	warnings, err := game.StaleOrdersWarnings(5)
+
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "identical")
+}
+
+func TestOrdersSnapshot(t *testing.T) {
+	game := testOrdersGame(t, time.Hour, time.Minute)
+
+	snapshot, err := game.OrdersSnapshot()
+	assert.NoError(t, err)
+	assert.True(t, snapshot.Exists)
+
+	changed, err := snapshot.Changed()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Saving the same orders again still counts
+	assert.NoError(t, os.Chtimes(game.TwohFile.Fullpath, time.Now(), time.Now()))
+
+	changed, err = snapshot.Changed()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestOrdersSnapshotWithoutOrders(t *testing.T) {
+	game := testOrdersGame(t, time.Hour, time.Minute)
+	assert.NoError(t, os.Remove(game.TwohFile.Fullpath))
+
+	game, err := NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+
+	snapshot, err := game.OrdersSnapshot()
+	assert.NoError(t, err)
+	assert.False(t, snapshot.Exists)
+	assert.Equal(t, filepath.Join(game.Directory, "early_ulm.2h"), snapshot.Fullpath)
+
+	assert.NoError(t, ioutil.WriteFile(snapshot.Fullpath, []byte("orders"), 0644))
+
+	changed, err := snapshot.Changed()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
@@ -0,0 +1,165 @@
+package game
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// A minimal POP3 client (RFC 1939), just enough to fetch and delete turn mails
+type pop3Client struct {
+	conn *textproto.Conn
+}
+
+// Connect to a POP3 server. Port 995 means implicit TLS, everything else uses STLS if the server offers it.
+func dialPop3(server string, port string) (*pop3Client, error) {
+	address := net.JoinHostPort(server, port)
+
+	var conn net.Conn
+	var err error
+
+	if port == "995" {
+		conn, err = tls.Dial("tcp", address, &tls.Config{ServerName: server})
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &pop3Client{conn: textproto.NewConn(conn)}
+
+	// Greeting
+	if _, err := client.response(); err != nil {
+		client.conn.Close()
+		return nil, err
+	}
+
+	if port != "995" && client.supportsStartTLS() {
+		if _, err := client.cmd("STLS"); err != nil {
+			client.conn.Close()
+			return nil, err
+		}
+
+		client.conn = textproto.NewConn(tls.Client(conn, &tls.Config{ServerName: server}))
+	}
+
+	return client, nil
+}
+
+// Read a single line response, turning -ERR into an error
+func (client *pop3Client) response() (string, error) {
+	line, err := client.conn.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(line, "+OK") {
+		return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+	}
+
+	return "", errors.New(fmt.Sprintf("POP3 server error: %v", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+}
+
+// Send a command and read its single line response
+func (client *pop3Client) cmd(format string, args ...interface{}) (string, error) {
+	if err := client.conn.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+
+	return client.response()
+}
+
+// Send a command and read its multi line response, with dot-stuffing removed
+func (client *pop3Client) multilineCmd(format string, args ...interface{}) ([]byte, error) {
+	if _, err := client.cmd(format, args...); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(client.conn.DotReader())
+}
+
+func (client *pop3Client) supportsStartTLS() bool {
+	capabilities, err := client.multilineCmd("CAPA")
+	if err != nil {
+		return false
+	}
+
+	for _, capability := range strings.Split(string(capabilities), "\n") {
+		if strings.ToUpper(strings.TrimSpace(capability)) == "STLS" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (client *pop3Client) login(username string, password string) error {
+	if _, err := client.cmd("USER %s", username); err != nil {
+		return err
+	}
+
+	_, err := client.cmd("PASS %s", password)
+	return err
+}
+
+// The message numbers of all messages in the mailbox
+func (client *pop3Client) list() ([]int, error) {
+	var messageNumbers []int
+
+	listing, err := client.multilineCmd("LIST")
+	if err != nil {
+		return messageNumbers, err
+	}
+
+	for _, line := range strings.Split(string(bytes.TrimSpace(listing)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		messageNumber, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return messageNumbers, err
+		}
+
+		messageNumbers = append(messageNumbers, messageNumber)
+	}
+
+	return messageNumbers, nil
+}
+
+// Only the header of a message
+func (client *pop3Client) top(messageNumber int) ([]byte, error) {
+	return client.multilineCmd("TOP %d 0", messageNumber)
+}
+
+// The complete message
+func (client *pop3Client) retr(messageNumber int) ([]byte, error) {
+	return client.multilineCmd("RETR %d", messageNumber)
+}
+
+// Mark a message for deletion, which only happens once we quit
+func (client *pop3Client) dele(messageNumber int) error {
+	_, err := client.cmd("DELE %d", messageNumber)
+	return err
+}
+
+// Unmark all messages marked for deletion
+func (client *pop3Client) rset() error {
+	_, err := client.cmd("RSET")
+	return err
+}
+
+func (client *pop3Client) quit() error {
+	_, err := client.cmd("QUIT")
+	client.conn.Close()
+
+	return err
+}
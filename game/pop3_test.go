@@ -0,0 +1,184 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A local POP3 stand-in serving the given messages to a single client at a time
+type fakePop3Server struct {
+	mutex    sync.Mutex
+	messages []string
+	deleted  map[int]bool
+}
+
+func startPop3Server(t *testing.T, messages ...string) (*fakePop3Server, Pop3Config) {
+	server := &fakePop3Server{messages: messages, deleted: make(map[int]bool)}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			server.serve(conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	return server, Pop3Config{Server: host, Port: port, Username: "username", Password: "password"}
+}
+
+// The messages that are still on the server
+func (server *fakePop3Server) remaining() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.messages
+}
+
+func (server *fakePop3Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	reader := bufio.NewReader(conn)
+	pendingDeletes := make(map[int]bool)
+
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	multiline := func(text string) {
+		reply("+OK")
+		for _, line := range strings.Split(strings.TrimSuffix(text, "\r\n"), "\r\n") {
+			if strings.HasPrefix(line, ".") {
+				line = "." + line
+			}
+			reply("%s", line)
+		}
+		reply(".")
+	}
+
+	message := func(argument string) (int, bool) {
+		messageNumber, err := strconv.Atoi(argument)
+		if err != nil || messageNumber < 1 || messageNumber > len(server.messages) || pendingDeletes[messageNumber] {
+			reply("-ERR no such message")
+			return 0, false
+		}
+
+		return messageNumber, true
+	}
+
+	reply("+OK fake POP3 server ready")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "USER":
+			reply("+OK")
+		case "PASS":
+			if fields[1] != "password" {
+				reply("-ERR invalid password")
+				return
+			}
+			reply("+OK logged in")
+		case "LIST":
+			listing := ""
+			for index, message := range server.messages {
+				if !pendingDeletes[index+1] {
+					listing += fmt.Sprintf("%d %d\r\n", index+1, len(message))
+				}
+			}
+			multiline(listing)
+		case "TOP":
+			if messageNumber, ok := message(fields[1]); ok {
+				multiline(strings.SplitN(server.messages[messageNumber-1], "\r\n\r\n", 2)[0] + "\r\n")
+			}
+		case "RETR":
+			if messageNumber, ok := message(fields[1]); ok {
+				multiline(server.messages[messageNumber-1])
+			}
+		case "DELE":
+			if messageNumber, ok := message(fields[1]); ok {
+				pendingDeletes[messageNumber] = true
+				reply("+OK")
+			}
+		case "RSET":
+			pendingDeletes = make(map[int]bool)
+			reply("+OK")
+		case "QUIT":
+			var remaining []string
+			for index, message := range server.messages {
+				if !pendingDeletes[index+1] {
+					remaining = append(remaining, message)
+				}
+			}
+			server.messages = remaining
+			reply("+OK bye")
+			return
+		default:
+			reply("-ERR unknown command")
+		}
+	}
+}
+
+func TestPop3ClientDotStuffing(t *testing.T) {
+	_, mailConfig := startPop3Server(t, "Subject: dots\r\n\r\n.leading dot\r\n")
+
+	client, err := dialPop3(mailConfig.Server, mailConfig.Port)
+	assert.NoError(t, err)
+	defer client.quit()
+
+	assert.NoError(t, client.login(mailConfig.Username, mailConfig.Password))
+
+	message, err := client.retr(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Subject: dots\n\n.leading dot\n", string(message))
+}
+
+func TestPop3ClientWrongPassword(t *testing.T) {
+	_, mailConfig := startPop3Server(t)
+
+	client, err := dialPop3(mailConfig.Server, mailConfig.Port)
+	assert.NoError(t, err)
+	defer client.quit()
+
+	assert.Error(t, client.login(mailConfig.Username, "wrong"))
+}
+
+func TestPop3ClientRset(t *testing.T) {
+	server, mailConfig := startPop3Server(t, "Subject: one\r\n\r\nbody\r\n", "Subject: two\r\n\r\nbody\r\n")
+
+	client, err := dialPop3(mailConfig.Server, mailConfig.Port)
+	assert.NoError(t, err)
+	assert.NoError(t, client.login(mailConfig.Username, mailConfig.Password))
+	assert.NoError(t, client.dele(1))
+	assert.NoError(t, client.rset())
+	assert.NoError(t, client.quit())
+
+	assert.Len(t, server.remaining(), 2)
+}
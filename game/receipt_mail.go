@@ -0,0 +1,160 @@
+package game
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// ReceiptMail is a mail the game server or a mailer daemon sends in reply to a submitted turn
+type ReceiptMail struct {
+	From    string
+	Subject string
+	Date    time.Time
+	// Message-IDs this mail refers to, from In-Reply-To, References, or the original headers quoted in a bounce
+	References []string
+	Bounce     bool
+}
+
+var quotedMessageIdPattern = regexp.MustCompile(`(?im)^\s*message-id:\s*(<[^<>\s]+>)`)
+var messageIdPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// Parse a mail that might be a receipt or a bounce for a submitted turn
+func ParseReceiptMail(r io.Reader) (ReceiptMail, error) {
+	receipt := ReceiptMail{}
+
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return receipt, err
+	}
+
+	receipt.From = decodeHeader(message.Header.Get("From"))
+	receipt.Subject = decodeHeader(message.Header.Get("Subject"))
+
+	if date, err := message.Header.Date(); err == nil {
+		receipt.Date = date
+	}
+
+	receipt.References = append(receipt.References, messageIdPattern.FindAllString(message.Header.Get("In-Reply-To"), -1)...)
+	receipt.References = append(receipt.References, messageIdPattern.FindAllString(message.Header.Get("References"), -1)...)
+
+	// Bounces quote the headers of the original mail somewhere in the body, and so do some servers' receipts
+	body, err := ioutil.ReadAll(message.Body)
+	if err != nil {
+		return receipt, err
+	}
+
+	for _, match := range quotedMessageIdPattern.FindAllStringSubmatch(string(body), -1) {
+		receipt.References = append(receipt.References, match[1])
+	}
+
+	receipt.Bounce = isBounce(message.Header, receipt.From, receipt.Subject)
+
+	return receipt, nil
+}
+
+// Does this receipt refer to the mail with the given Message-ID?
+func (receipt ReceiptMail) RefersTo(messageId string) bool {
+	for _, reference := range receipt.References {
+		if reference == messageId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery status notifications are multipart/report, but plenty of mailers still send plain text bounces
+func isBounce(header mail.Header, from string, subject string) bool {
+	if mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if mediaType == "multipart/report" && strings.ToLower(params["report-type"]) == "delivery-status" {
+			return true
+		}
+	}
+
+	from = strings.ToLower(from)
+	if strings.Contains(from, "mailer-daemon") || strings.Contains(from, "postmaster") {
+		return true
+	}
+
+	subject = strings.ToLower(subject)
+	for _, bounceSubject := range []string{"undeliverable", "undelivered", "delivery status notification (failure)", "delivery failure", "mail delivery failed", "returned mail", "failure notice"} {
+		if strings.Contains(subject, bounceSubject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get all mails that arrived since the given time, without marking them as read
+func (mailConfig ImapConfig) FetchReceiptMails(since time.Time) ([]ReceiptMail, error) {
+	var receipts []ReceiptMail
+
+	imapClient, err := mailConfig.dial()
+	if err != nil {
+		return receipts, err
+	}
+
+	defer imapClient.Logout()
+
+	err = imapClient.Login(mailConfig.Username, mailConfig.Password)
+	if err != nil {
+		return receipts, err
+	}
+
+	mailbox := mailConfig.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	_, err = imapClient.Select(mailbox, true)
+	if err != nil {
+		return receipts, err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Since = since
+
+	uids, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return receipts, err
+	}
+
+	if len(uids) == 0 {
+		return receipts, nil
+	}
+
+	candidates := new(imap.SeqSet)
+	candidates.AddNum(uids...)
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	fetchDone := make(chan error, 1)
+
+	go func() {
+		fetchDone <- imapClient.UidFetch(candidates, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	for message := range messages {
+		body := message.GetBody(section)
+		if body == nil {
+			continue
+		}
+
+		receipt, err := ParseReceiptMail(body)
+		if err != nil {
+			continue
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, <-fetchDone
+}
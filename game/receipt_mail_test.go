@@ -0,0 +1,79 @@
+package game
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+)
+
+const receiptFixture = "From: Llamaserver <turns@llamaserver.net>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Received turn for testgame\r\n" +
+	"Date: Wed, 11 May 2016 14:31:59 +0000\r\n" +
+	"In-Reply-To: <1.abc@example.com>\r\n" +
+	"\r\n" +
+	"Your turn file for testgame has been received.\r\n"
+
+const bounceFixture = "From: Mail Delivery Subsystem <MAILER-DAEMON@example.com>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Date: Wed, 11 May 2016 14:32:59 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"bounce\"\r\n" +
+	"\r\n" +
+	"--bounce\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"The mail could not be delivered.\r\n" +
+	"--bounce\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: me@example.com\r\n" +
+	"Message-ID: <2.def@example.com>\r\n" +
+	"Subject: testgame turn 7\r\n" +
+	"--bounce--\r\n"
+
+func TestParseReceiptMail(t *testing.T) {
+	receipt, err := ParseReceiptMail(bytes.NewBufferString(receiptFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, "Received turn for testgame", receipt.Subject)
+	assert.True(t, receipt.RefersTo("<1.abc@example.com>"))
+	assert.False(t, receipt.Bounce)
+}
+
+func TestParseReceiptMailBounce(t *testing.T) {
+	receipt, err := ParseReceiptMail(bytes.NewBufferString(bounceFixture))
+	assert.NoError(t, err)
+	assert.True(t, receipt.Bounce)
+	assert.True(t, receipt.RefersTo("<2.def@example.com>"))
+	assert.False(t, receipt.RefersTo("<1.abc@example.com>"))
+}
+
+func TestParseReceiptMailPlainTextBounce(t *testing.T) {
+	receipt, err := ParseReceiptMail(bytes.NewBufferString("From: postmaster@example.com\r\nSubject: failure notice\r\n\r\nSorry.\r\n"))
+	assert.NoError(t, err)
+	assert.True(t, receipt.Bounce)
+}
+
+func TestFetchReceiptMails(t *testing.T) {
+	imapConfig, inbox := startImapServer(t, receiptFixture, bounceFixture)
+
+	receipts, err := imapConfig.FetchReceiptMails(time.Now().AddDate(0, 0, -1))
+	assert.NoError(t, err)
+
+	// The memory backend starts out with a message of its own
+	assert.Len(t, receipts, 3)
+
+	// Fetching receipts must not touch the mails
+	seqset, _ := imap.ParseSeqSet("2:3")
+	messages := make(chan *imap.Message, 3)
+	err = inbox.ListMessages(false, seqset, []imap.FetchItem{imap.FetchFlags}, messages)
+	assert.NoError(t, err)
+
+	for message := range messages {
+		assert.NotContains(t, message.Flags, imap.SeenFlag)
+	}
+}
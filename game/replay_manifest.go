@@ -0,0 +1,171 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Separates the game name from the turn number in the name of a replay.
+// Turn numbers are always last, so a replay name can only come from one game and turn.
+const ReplaySeparator = "_turn"
+
+// ReplayManifest records the replay games d4t created for a game, so it never touches directories it didn't create
+type ReplayManifest struct {
+	Path    string         `json:"-"`
+	Replays []ReplayRecord `json:"replays"`
+}
+
+// ReplayRecord describes a replay game, or the replay viewer
+type ReplayRecord struct {
+	Name       string `json:"name"`
+	TurnNumber int    `json:"turn_number,omitempty"`
+	// Stems of the nations whose files are in the replay
+	Nations []string  `json:"nations"`
+	Viewer  bool      `json:"viewer,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Split a replay name into the name of the game and the turn number
+func ParseReplayName(name string) (gameName string, turnNumber int, ok bool) {
+	matchData := regexp.MustCompile(`\A(.+)` + regexp.QuoteMeta(ReplaySeparator) + `(\d+)\z`).FindStringSubmatch(name)
+	if matchData == nil {
+		return "", 0, false
+	}
+
+	turnNumber, err := strconv.Atoi(matchData[2])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return matchData[1], turnNumber, true
+}
+
+// Path of the manifest of the replays of this game
+func (game *Game) ReplayManifestPath() string {
+	return filepath.Join(game.Directory, MetadataDirectory, "replays.json")
+}
+
+// Load the replay manifest at path. A missing manifest is simply empty.
+func LoadReplayManifest(path string) (*ReplayManifest, error) {
+	manifest := &ReplayManifest{Path: path}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(raw, manifest)
+	if err != nil {
+		return manifest, errors.New(fmt.Sprintf("Broken replay manifest %v: %v", path, err.Error()))
+	}
+
+	return manifest, nil
+}
+
+func (manifest *ReplayManifest) Save() error {
+	raw, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(manifest.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return utility.WriteFile(manifest.Path, raw, 0644)
+}
+
+// Find the replay with the given name. Case insensitive, like game names.
+func (manifest *ReplayManifest) Find(name string) (ReplayRecord, bool) {
+	for _, record := range manifest.Replays {
+		if strings.ToLower(record.Name) == strings.ToLower(name) {
+			return record, true
+		}
+	}
+
+	return ReplayRecord{}, false
+}
+
+// Record that a replay holds the files of a nation, adding the replay if it's new
+func (manifest *ReplayManifest) Add(record ReplayRecord, nationStem string) {
+	for i := range manifest.Replays {
+		existing := &manifest.Replays[i]
+
+		if strings.ToLower(existing.Name) == strings.ToLower(record.Name) {
+			existing.TurnNumber = record.TurnNumber
+			existing.Viewer = record.Viewer
+			existing.Nations = addNationStem(existing.Nations, nationStem)
+			return
+		}
+	}
+
+	record.Nations = addNationStem(record.Nations, nationStem)
+	if record.Created.IsZero() {
+		record.Created = time.Now()
+	}
+
+	manifest.Replays = append(manifest.Replays, record)
+}
+
+func addNationStem(stems []string, stem string) []string {
+	if stem == "" || utility.Contains(stems, stem) {
+		return stems
+	}
+
+	stems = append(stems, stem)
+	sort.Strings(stems)
+
+	return stems
+}
+
+// Forget a replay, e.g. after deleting it
+func (manifest *ReplayManifest) Remove(name string) {
+	var kept []ReplayRecord
+
+	for _, record := range manifest.Replays {
+		if strings.ToLower(record.Name) != strings.ToLower(name) {
+			kept = append(kept, record)
+		}
+	}
+
+	manifest.Replays = kept
+}
+
+// Record that the selected nation's files for a turn are in the replay with the given name
+func (game *Game) RecordReplay(record ReplayRecord) error {
+	manifest, err := LoadReplayManifest(game.ReplayManifestPath())
+	if err != nil {
+		return err
+	}
+
+	manifest.Add(record, game.NationStem)
+
+	return manifest.Save()
+}
+
+// Does a replay d4t created hold the files of a nation for a turn?
+func (game *Game) HasReplay(nationStem string, turnNumber int) (bool, error) {
+	manifest, err := LoadReplayManifest(game.ReplayManifestPath())
+	if err != nil {
+		return false, err
+	}
+
+	record, ok := manifest.Find(game.ReplayName(turnNumber))
+
+	return ok && utility.Contains(record.Nations, nationStem), nil
+}
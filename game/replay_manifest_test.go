@@ -0,0 +1,44 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayManifest(t *testing.T) {
+	game := testLongGame(t)
+
+	recorded, err := game.HasReplay("early_ulm", 3)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	assert.NoError(t, game.RecordReplay(ReplayRecord{Name: game.ReplayName(3), TurnNumber: 3}))
+
+	game.NationStem = "mid_ulm"
+	assert.NoError(t, game.RecordReplay(ReplayRecord{Name: "TESTGAME_turn3", TurnNumber: 3}))
+
+	manifest, err := LoadReplayManifest(game.ReplayManifestPath())
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Replays, 1)
+
+	record, ok := manifest.Find("testgame_turn3")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"early_ulm", "mid_ulm"}, record.Nations)
+	assert.False(t, record.Created.IsZero())
+
+	recorded, err = game.HasReplay("early_ulm", 3)
+	assert.NoError(t, err)
+	assert.True(t, recorded)
+
+	recorded, err = game.HasReplay("early_ulm", 4)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+
+	manifest.Remove("testgame_turn3")
+	assert.NoError(t, manifest.Save())
+
+	recorded, err = game.HasReplay("early_ulm", 3)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+}
@@ -0,0 +1,159 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// Appended to the name of a game to get the name of its replay viewer
+const ReplayViewerSuffix = "_viewer"
+
+// ReplayViewer is a single game directory the backed up turns of a game are shown in, one at a time
+type ReplayViewer struct {
+	Game       string `json:"game"`
+	Nation     string `json:"nation"`
+	TurnNumber int    `json:"turn_number"`
+
+	Directory string `json:"-"`
+}
+
+// The name of the replay viewer for this game.
+// Example: PretendersOfReddit_viewer
+func (game *Game) ReplayViewerName() string {
+	return game.Name + ReplayViewerSuffix
+}
+
+// Read which turn the viewer in the directory shows. A viewer that shows nothing yet is empty.
+func LoadReplayViewer(directory string) (ReplayViewer, error) {
+	viewer := ReplayViewer{Directory: directory}
+
+	raw, err := ioutil.ReadFile(viewer.statePath())
+	if os.IsNotExist(err) {
+		return viewer, nil
+	}
+	if err != nil {
+		return viewer, err
+	}
+
+	err = json.Unmarshal(raw, &viewer)
+	if err != nil {
+		return viewer, errors.New(fmt.Sprintf("Broken replay viewer state %v: %v", viewer.statePath(), err.Error()))
+	}
+
+	return viewer, nil
+}
+
+func (viewer ReplayViewer) statePath() string {
+	return filepath.Join(viewer.Directory, MetadataDirectory, "viewer.json")
+}
+
+// Put the backups of the selected nation for a turn into the viewer, replacing the turn it showed before
+func (game *Game) ShowReplay(viewer *ReplayViewer, turnNumber int) (err error) {
+	trnFile, ok := game.TrnBackups[turnNumber]
+	if !ok {
+		return errors.New(fmt.Sprintf("No .trn file backed up for turn %v of %v", turnNumber, game.Name))
+	}
+
+	twohFile, ok := game.TwohBackups[turnNumber]
+	if !ok {
+		return errors.New(fmt.Sprintf("No .2h file backed up for turn %v of %v", turnNumber, game.Name))
+	}
+
+	trnContents, err := trnFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	twohContents, err := twohFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	trnPath := filepath.Join(viewer.Directory, BackupTrnBasename(trnFile.Filename))
+	twohPath := filepath.Join(viewer.Directory, Backup2hBasename(twohFile.Filename))
+
+	err = os.MkdirAll(filepath.Join(viewer.Directory, MetadataDirectory), 0755)
+	if err != nil {
+		return err
+	}
+
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	// Files of another nation shown before would be loaded along with the turn
+	files, err := ioutil.ReadDir(viewer.Directory)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		fullpath := filepath.Join(viewer.Directory, f.Name())
+
+		if (Valid2hFileName(f.Name()) || ValidTrnFileName(f.Name())) && fullpath != trnPath && fullpath != twohPath {
+			err = tx.Remove(fullpath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tx.WriteFile(trnPath, trnContents.Data, 0644, trnContents.Modified)
+	if err != nil {
+		return err
+	}
+
+	err = tx.WriteFile(twohPath, twohContents.Data, 0644, twohContents.Modified)
+	if err != nil {
+		return err
+	}
+
+	shown := ReplayViewer{Game: game.Name, Nation: game.NationStem, TurnNumber: turnNumber, Directory: viewer.Directory}
+
+	raw, err := json.MarshalIndent(shown, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.WriteFile(shown.statePath(), raw, 0644, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	*viewer = shown
+
+	return nil
+}
+
+// The closest turn after (step 1) or before (step -1) the given one that has both backups
+func (game *Game) StepReplayTurn(turnNumber int, step int) (int, error) {
+	keys := game.SortedTrnBackupKeys
+
+	for i := range keys {
+		next := keys[i]
+		if step < 0 {
+			next = keys[len(keys)-1-i]
+		}
+
+		if (next-turnNumber)*step <= 0 {
+			continue
+		}
+
+		if _, ok := game.TwohBackups[next]; ok {
+			return next, nil
+		}
+	}
+
+	direction := "after"
+	if step < 0 {
+		direction = "before"
+	}
+
+	return turnNumber, errors.New(fmt.Sprintf("No backed up turn of %v %v turn %v", game.Name, direction, turnNumber))
+}
@@ -0,0 +1,65 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowReplay(t *testing.T) {
+	game := testLongGame(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(game.Directory, "early_ulm-4.trn"), []byte("turn 4"), 0644))
+
+	viewer, err := LoadReplayViewer(filepath.Join(testGameDirectory(t), game.ReplayViewerName()))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, viewer.TurnNumber)
+
+	assert.NoError(t, game.ShowReplay(&viewer, 4))
+
+	data, err := ioutil.ReadFile(filepath.Join(viewer.Directory, "early_ulm.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "turn 4", string(data))
+	assert.True(t, utility.FileExists(filepath.Join(viewer.Directory, "early_ulm.2h")))
+
+	// Another nation's files go, the state stays
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(viewer.Directory, "mid_ulm.trn"), []byte("other"), 0644))
+	assert.NoError(t, game.ShowReplay(&viewer, 5))
+	assert.False(t, utility.FileExists(filepath.Join(viewer.Directory, "mid_ulm.trn")))
+
+	viewer, err = LoadReplayViewer(viewer.Directory)
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayViewer{Game: "testgame", Nation: "early_ulm", TurnNumber: 5, Directory: viewer.Directory}, viewer)
+
+	assert.Error(t, game.ShowReplay(&viewer, 11))
+	assert.Equal(t, 5, viewer.TurnNumber)
+}
+
+func TestStepReplayTurn(t *testing.T) {
+	game := testLongGame(t)
+	assert.NoError(t, os.Remove(filepath.Join(game.Directory, "early_ulm-6.2h")))
+
+	game, err := NewGame("testgame", game.Directory)
+	assert.NoError(t, err)
+
+	turnNumber, err := game.StepReplayTurn(5, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, turnNumber)
+
+	turnNumber, err = game.StepReplayTurn(7, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, turnNumber)
+
+	turnNumber, err = game.StepReplayTurn(100, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, turnNumber)
+
+	_, err = game.StepReplayTurn(10, 1)
+	assert.Error(t, err)
+
+	_, err = game.StepReplayTurn(1, -1)
+	assert.Error(t, err)
+}
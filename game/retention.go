@@ -0,0 +1,172 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RetentionPolicy decides which backed up turns are kept when pruning.
+// The last KeepLast turns are always kept, older ones only if their turn number is a multiple of KeepEvery.
+// Labelled turns are always kept.
+type RetentionPolicy struct {
+	KeepLast  int
+	KeepEvery int
+}
+
+// PrunePlan lists what pruning a game would do
+type PrunePlan struct {
+	// Backup files to delete, full paths
+	Delete []string
+	// Turns whose backups would be deleted, but are the only copy because there's no replay game for them.
+	// Keyed by nation stem.
+	OnlyCopy map[string][]int
+}
+
+// Without KeepLast, a policy keeps everything
+func (policy RetentionPolicy) Enabled() bool {
+	return policy.KeepLast > 0
+}
+
+// Does the policy keep the turn? turns are all backed up turns, sorted
+func (policy RetentionPolicy) keeps(turns []int, turn int, labelled bool) bool {
+	if !policy.Enabled() || labelled {
+		return true
+	}
+
+	if len(turns) <= policy.KeepLast || turn >= turns[len(turns)-policy.KeepLast] {
+		return true
+	}
+
+	return policy.KeepEvery > 0 && turn%policy.KeepEvery == 0
+}
+
+// Work out which backups of all nations the policy drops.
+// hasReplay tells whether a replay game still has the files of a turn, otherwise the backup is the only copy and stays.
+func (game *Game) PrunePlan(policy RetentionPolicy, hasReplay func(nation *GameNation, turnNumber int) bool) (PrunePlan, error) {
+	plan := PrunePlan{OnlyCopy: make(map[string][]int)}
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return plan, err
+	}
+
+	for _, stem := range game.NationStems() {
+		nation := game.Nations[stem]
+		turns := nation.BackedUpTurns()
+
+		for _, turn := range turns {
+			var files []string
+
+			if backup, ok := nation.TrnBackups[turn]; ok {
+				files = append(files, backup.Fullpath)
+			}
+
+			// Archived backups share one file
+			if backup, ok := nation.TwohBackups[turn]; ok && (len(files) == 0 || files[0] != backup.Fullpath) {
+				files = append(files, backup.Fullpath)
+			}
+
+			if policy.keeps(turns, turn, manifest.Labelled(files...)) {
+				continue
+			}
+
+			if !hasReplay(nation, turn) {
+				plan.OnlyCopy[stem] = append(plan.OnlyCopy[stem], turn)
+				continue
+			}
+
+			plan.Delete = append(plan.Delete, files...)
+		}
+	}
+
+	sort.Strings(plan.Delete)
+
+	return plan, nil
+}
+
+// Delete the backups of a plan, and forget them in the manifest
+func (game *Game) Prune(plan PrunePlan) error {
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return err
+	}
+
+	for _, fullpath := range plan.Delete {
+		err = os.Remove(fullpath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		delete(manifest.Entries, filepath.Base(fullpath))
+	}
+
+	return manifest.Save()
+}
+
+// Label the backups of the selected nation for a turn, so pruning keeps them. An empty label removes it.
+func (game *Game) LabelBackup(turnNumber int, label string) error {
+	var files []string
+
+	if backup, ok := game.TrnBackups[turnNumber]; ok {
+		files = append(files, backup.Fullpath)
+	}
+
+	if backup, ok := game.TwohBackups[turnNumber]; ok {
+		files = append(files, backup.Fullpath)
+	}
+
+	if len(files) == 0 {
+		return errors.New(fmt.Sprintf("Neither trn nor 2h backups exist for turn %v in %v", turnNumber, game.Directory))
+	}
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return err
+	}
+
+	for _, fullpath := range files {
+		entry, ok := manifest.Entries[filepath.Base(fullpath)]
+		if !ok {
+			// Backups from before the manifest get an entry now
+			entry, err = newManifestEntry(fullpath)
+			if err != nil {
+				return err
+			}
+		}
+
+		entry.Label = label
+		manifest.Entries[filepath.Base(fullpath)] = entry
+	}
+
+	return manifest.Save()
+}
+
+// The label of the backups of the selected nation for a turn, if any
+func (game *Game) BackupLabel(turnNumber int) string {
+	manifest, err := LoadManifest(game.ManifestPath())
+	if err != nil {
+		return ""
+	}
+
+	for _, backup := range []string{game.TrnBackups[turnNumber].Fullpath, game.TwohBackups[turnNumber].Fullpath} {
+		if backup != "" && manifest.Labelled(backup) {
+			return manifest.Entries[filepath.Base(backup)].Label
+		}
+	}
+
+	return ""
+}
+
+// Is any of the files labelled?
+func (manifest *Manifest) Labelled(fullpaths ...string) bool {
+	for _, fullpath := range fullpaths {
+		if manifest.Entries[filepath.Base(fullpath)].Label != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package game
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+// A game with trn and 2h backups for turns 1 to 10
+func testLongGame(t *testing.T) *Game {
+	directory := testGameDirectory(t)
+
+	for turn := 1; turn <= 10; turn++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, fmt.Sprintf("early_ulm-%v.trn", turn)), []byte("turn"), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, fmt.Sprintf("early_ulm-%v.2h", turn)), []byte("orders"), 0644))
+	}
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+
+	return game
+}
+
+func everyTurnReplayed(*GameNation, int) bool { return true }
+
+func TestRetentionPolicyKeeps(t *testing.T) {
+	turns := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	policy := RetentionPolicy{KeepLast: 3, KeepEvery: 4}
+
+	var kept []int
+	for _, turn := range turns {
+		if policy.keeps(turns, turn, turn == 1) {
+			kept = append(kept, turn)
+		}
+	}
+
+	assert.Equal(t, []int{1, 4, 8, 9, 10}, kept)
+	assert.True(t, RetentionPolicy{}.keeps(turns, 1, false))
+}
+
+func TestPrunePlan(t *testing.T) {
+	game := testLongGame(t)
+	assert.NoError(t, game.LabelBackup(2, "first battle"))
+
+	plan, err := game.PrunePlan(RetentionPolicy{KeepLast: 5, KeepEvery: 3}, func(nation *GameNation, turn int) bool { return turn != 4 })
+	assert.NoError(t, err)
+
+	var deleted []string
+	for _, fullpath := range plan.Delete {
+		deleted = append(deleted, filepath.Base(fullpath))
+	}
+
+	assert.Equal(t, []string{"early_ulm-1.2h", "early_ulm-1.trn", "early_ulm-5.2h", "early_ulm-5.trn"}, deleted)
+	assert.Equal(t, map[string][]int{"early_ulm": {4}}, plan.OnlyCopy)
+}
+
+func TestPrune(t *testing.T) {
+	game := testLongGame(t)
+	assert.NoError(t, game.LabelBackup(1, "start"))
+
+	plan, err := game.PrunePlan(RetentionPolicy{KeepLast: 8}, everyTurnReplayed)
+	assert.NoError(t, err)
+	assert.NoError(t, game.Prune(plan))
+
+	assert.True(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-1.trn")))
+	assert.False(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-2.trn")))
+	assert.False(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-2.2h")))
+	assert.True(t, utility.FileExists(filepath.Join(game.Directory, "early_ulm-3.trn")))
+
+	manifest, err := LoadManifest(game.ManifestPath())
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Entries, 2)
+	assert.Equal(t, "start", game.BackupLabel(1))
+}
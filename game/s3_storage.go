@@ -0,0 +1,242 @@
+package game
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage stores backups in a bucket of an S3 compatible service, e.g. AWS, MinIO or Backblaze B2.
+// Requests are path style, https://endpoint/bucket/prefix/name, and signed with AWS Signature Version 4.
+type S3Storage struct {
+	// Base URL of the service, e.g. https://s3.eu-central-1.amazonaws.com
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// Defaults to a client giving up after S3Timeout
+	Client *http.Client
+}
+
+// How long a request to the service may take, including the transfer
+var S3Timeout = 5 * time.Minute
+
+// What ListObjectsV2 answers
+type s3ListResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// What S3 answers when a request fails
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+func (storage S3Storage) Put(name string, data []byte) error {
+	_, err := storage.request("PUT", storage.key(name), nil, data)
+
+	return err
+}
+
+func (storage S3Storage) Get(name string) ([]byte, error) {
+	return storage.request("GET", storage.key(name), nil, nil)
+}
+
+func (storage S3Storage) List(prefix string) ([]string, error) {
+	var names []string
+
+	query := url.Values{"list-type": {"2"}, "prefix": {storage.key(prefix)}}
+
+	for {
+		body, err := storage.request("GET", "", query, nil)
+		if err != nil {
+			return names, err
+		}
+
+		result := s3ListResult{}
+		err = xml.Unmarshal(body, &result)
+		if err != nil {
+			return names, errors.New(fmt.Sprintf("Could not read the object list of %v: %v", storage, err.Error()))
+		}
+
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, storage.key("")))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (storage S3Storage) String() string {
+	return "s3://" + storage.Bucket + "/" + storage.key("")
+}
+
+// Object key of a stored file
+func (storage S3Storage) key(name string) string {
+	prefix := strings.Trim(storage.Prefix, "/")
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "/" + name
+}
+
+// Send a signed request for an object, or the bucket if key is empty. Returns the body of the answer.
+func (storage S3Storage) request(method string, key string, query url.Values, body []byte) ([]byte, error) {
+	endpoint, err := url.Parse(storage.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + storage.Bucket
+	if key != "" {
+		endpoint.Path += "/" + key
+	}
+	endpoint.RawPath = s3EscapePath(endpoint.Path)
+	endpoint.RawQuery = s3CanonicalQuery(query)
+
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	storage.sign(request, body, time.Now().UTC())
+
+	client := storage.Client
+	if client == nil {
+		client = &http.Client{Timeout: S3Timeout}
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	answer, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		failure := s3Error{}
+		if xml.Unmarshal(answer, &failure) == nil && failure.Code != "" {
+			return nil, errors.New(fmt.Sprintf("%v %v failed: %v: %v", method, endpoint.Path, failure.Code, failure.Message))
+		}
+
+		return nil, errors.New(fmt.Sprintf("%v %v failed: %v", method, endpoint.Path, response.Status))
+	}
+
+	return answer, nil
+}
+
+// Add the AWS Signature Version 4 headers to a request
+func (storage S3Storage) sign(request *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := s3Hash(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host + "\n" + "x-amz-content-sha256:" + payloadHash + "\n" + "x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + storage.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + s3Hash([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + storage.SecretKey)
+	for _, part := range []string{date, storage.Region, "s3", "aws4_request"} {
+		key = s3Hmac(key, part)
+	}
+
+	signature := hex.EncodeToString(s3Hmac(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", storage.AccessKey, scope, signedHeaders, signature))
+}
+
+func s3Hash(data []byte) string {
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// Escape a string the way Signature Version 4 expects: everything but unreserved characters, optionally keeping slashes
+func s3Escape(s string, keepSlashes bool) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '.', b == '_', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && keepSlashes:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func s3EscapePath(path string) string {
+	return s3Escape(path, true)
+}
+
+// The query string with keys sorted and everything escaped, so it can be signed as is
+func s3CanonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,214 @@
+package game
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// How long connecting and logging in to the server may take, and how long a whole transfer may take afterwards
+var SftpTimeout = 30 * time.Second
+var SftpTransferTimeout = 5 * time.Minute
+
+// SftpStorage stores backups below a directory on an SSH server.
+// The server is checked against HostKey, the SHA256 fingerprint as printed by ssh-keygen -l, or else the KnownHosts file.
+type SftpStorage struct {
+	Server     string
+	Port       string
+	Username   string
+	Password   string
+	KeyFile    string
+	HostKey    string
+	KnownHosts string
+	Path       string
+}
+
+func (storage SftpStorage) Put(name string, data []byte) error {
+	return storage.withClient(func(client *sftp.Client) error {
+		fullpath := path.Join(storage.Path, name)
+
+		err := client.MkdirAll(path.Dir(fullpath))
+		if err != nil {
+			return err
+		}
+
+		// Upload next to the destination first, so an interrupted upload never replaces a good backup
+		temporaryPath := path.Join(path.Dir(fullpath), "."+path.Base(fullpath)+".tmp")
+
+		file, err := client.Create(temporaryPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			client.Remove(temporaryPath)
+			return err
+		}
+
+		err = client.PosixRename(temporaryPath, fullpath)
+		if err != nil {
+			// Servers without the posix-rename extension only rename onto free names
+			client.Remove(fullpath)
+			err = client.Rename(temporaryPath, fullpath)
+		}
+		if err != nil {
+			client.Remove(temporaryPath)
+		}
+
+		return err
+	})
+}
+
+func (storage SftpStorage) Get(name string) ([]byte, error) {
+	var data []byte
+
+	err := storage.withClient(func(client *sftp.Client) error {
+		file, err := client.Open(path.Join(storage.Path, name))
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		var buffer bytes.Buffer
+		_, err = file.WriteTo(&buffer)
+		data = buffer.Bytes()
+
+		return err
+	})
+
+	return data, err
+}
+
+func (storage SftpStorage) List(prefix string) ([]string, error) {
+	var names []string
+
+	err := storage.withClient(func(client *sftp.Client) error {
+		directory, filePrefix := path.Split(prefix)
+
+		files, err := client.ReadDir(path.Join(storage.Path, directory))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if !f.IsDir() && strings.HasPrefix(f.Name(), filePrefix) && !strings.HasSuffix(f.Name(), ".tmp") {
+				names = append(names, directory+f.Name())
+			}
+		}
+
+		return nil
+	})
+
+	sort.Strings(names)
+
+	return names, err
+}
+
+func (storage SftpStorage) String() string {
+	return fmt.Sprintf("sftp://%v@%v%v", storage.Username, storage.address(), path.Join("/", storage.Path))
+}
+
+func (storage SftpStorage) address() string {
+	port := storage.Port
+	if port == "" {
+		port = "22"
+	}
+
+	return net.JoinHostPort(storage.Server, port)
+}
+
+// Connect, run f and disconnect again. Backups are rare enough that keeping connections around isn't worth it.
+func (storage SftpStorage) withClient(f func(client *sftp.Client) error) error {
+	config, err := storage.clientConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", storage.address(), config.Timeout)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, storage.address(), config)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(SftpTransferTimeout))
+
+	connection := ssh.NewClient(sshConn, channels, requests)
+	defer connection.Close()
+
+	client, err := sftp.NewClient(connection)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	return f(client)
+}
+
+func (storage SftpStorage) clientConfig() (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{User: storage.Username, Timeout: SftpTimeout}
+
+	if storage.KeyFile != "" {
+		key, err := ioutil.ReadFile(storage.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Could not read the key in %v: %v", storage.KeyFile, err.Error()))
+		}
+
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if storage.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(storage.Password))
+	}
+
+	switch {
+	case storage.HostKey != "":
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if ssh.FingerprintSHA256(key) != storage.HostKey {
+				return errors.New(fmt.Sprintf("Host key of %v is %v, expected %v", hostname, ssh.FingerprintSHA256(key), storage.HostKey))
+			}
+
+			return nil
+		}
+	case storage.KnownHosts != "":
+		callback, err := knownhosts.New(storage.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+
+		config.HostKeyCallback = callback
+	default:
+		return nil, errors.New(fmt.Sprintf("No host key or known hosts file given for %v, refusing to connect", storage.Server))
+	}
+
+	return config, nil
+}
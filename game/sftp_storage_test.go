@@ -0,0 +1,139 @@
+package game
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// A local SSH server with only the sftp subsystem, accepting the password "password"
+func startSftpServer(t *testing.T) SftpStorage {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	assert.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if metadata.User() == "username" && string(password) == "password" {
+				return nil, nil
+			}
+
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSftp(conn, config)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	return SftpStorage{Server: host, Port: port, Username: "username", Password: "password", HostKey: ssh.FingerprintSHA256(hostKey.PublicKey()), Path: testGameDirectory(t)}
+}
+
+func serveSftp(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for request := range channelRequests {
+				// The payload is the length prefixed subsystem name
+				request.Reply(request.Type == "subsystem" && string(request.Payload[4:]) == "sftp", nil)
+			}
+		}()
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+
+		server.Serve()
+		server.Close()
+	}
+}
+
+func TestSftpStorage(t *testing.T) {
+	assertStorageRoundTrip(t, startSftpServer(t))
+}
+
+func TestSftpStorageChecksHostKey(t *testing.T) {
+	storage := startSftpServer(t)
+	storage.HostKey = "SHA256:somebodyelse"
+
+	assert.Error(t, storage.Put("testgame/early_ulm-1.trn", []byte("turn")))
+
+	storage.HostKey = ""
+	assert.Error(t, storage.Put("testgame/early_ulm-1.trn", []byte("turn")))
+}
+
+func TestSftpStorageWrongPassword(t *testing.T) {
+	storage := startSftpServer(t)
+	storage.Password = "wrong"
+
+	_, err := storage.List("testgame/")
+	assert.Error(t, err)
+}
+
+func TestSftpStorageTimesOut(t *testing.T) {
+	// Accepts connections but never says a word
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	defer func(timeout time.Duration) { SftpTimeout = timeout }(SftpTimeout)
+	SftpTimeout = 100 * time.Millisecond
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	storage := SftpStorage{Server: host, Port: port, Username: "username", Password: "password", HostKey: "SHA256:whatever"}
+
+	_, err = storage.List("testgame/")
+	assert.Error(t, err)
+}
@@ -8,6 +8,10 @@ import (
 type TrnFile struct {
 	Filename string
 	Fullpath string
+	// Parsed from the file, nil if it couldn't be read
+	Header *FileHeader
+	// For backups: Fullpath is the backup archive the file is in, see BackupArchiveMetadata
+	Archived bool
 }
 
 // Returns the backup file name for a trn file for the given turn number for this game.
@@ -39,3 +43,29 @@ func (trnfile *TrnFile) BackupBasename() (string, error) {
 
 	return BackupTrnBasename(trnfile.Filename), nil
 }
+
+// The contents of the file, see Contents
+func (trnfile TrnFile) Data() ([]byte, error) {
+	contents, err := trnfile.Contents()
+
+	return contents.Data, err
+}
+
+// The contents of the file and its modification time, read from its backup archive if it's in one
+func (trnfile TrnFile) Contents() (BackupContents, error) {
+	return readBackupFile(trnfile.Filename, trnfile.Fullpath, trnfile.Archived)
+}
+
+// Read the header of the file into Header. Header is reset if reading fails.
+func (trnfile *TrnFile) ReadHeader() error {
+	trnfile.Header = nil
+
+	header, err := ReadFileHeader(trnfile.Fullpath)
+	if err != nil {
+		return err
+	}
+
+	trnfile.Header = &header
+
+	return nil
+}
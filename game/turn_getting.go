@@ -1,25 +1,382 @@
 package game
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"net"
+	"net/mail"
+	"os"
 	"path/filepath"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
 	"github.com/promisedlandt/dom4tools/utility"
 )
 
-type ImapConfig struct {
+type Pop3Config struct {
 	Port     string
 	Server   string
 	Username string
 	Password string
+	From     string
+	Delete   bool
+}
+
+type MaildirConfig struct {
+	Path string
+	From string
+}
+
+type ImapConfig struct {
+	Port             string
+	Server           string
+	Username         string
+	Password         string
+	Mailbox          string
+	ProcessedMailbox string
+	From             string
 }
 
-// Get the turn by using a builtin mailer
+// Get the turn by using a builtin mailer.
+// Takes the newest trn file from all unread turn mails for this game, then marks the mails as read,
+// or moves them to the processed mailbox if one is configured.
 func (game *Game) GetTurnByMailBuiltin(mailConfig ImapConfig) error {
+	imapClient, err := mailConfig.dial()
+	if err != nil {
+		return err
+	}
+
+	defer imapClient.Logout()
+
+	err = imapClient.Login(mailConfig.Username, mailConfig.Password)
+	if err != nil {
+		return err
+	}
+
+	mailbox := mailConfig.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	_, err = imapClient.Select(mailbox, false)
+	if err != nil {
+		return err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	// The server matches substrings, so this only narrows things down, see the check of every fetched mail below
+	criteria.Header.Add("Subject", game.Name)
+	if mailConfig.From != "" {
+		criteria.Header.Add("From", mailConfig.From)
+	}
+
+	uids, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return err
+	}
+
+	if len(uids) == 0 {
+		return errors.New(fmt.Sprintf("No new turn mails for %v in %v", game.Name, mailbox))
+	}
+
+	candidates := new(imap.SeqSet)
+	candidates.AddNum(uids...)
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	fetchDone := make(chan error, 1)
+
+	go func() {
+		fetchDone <- imapClient.UidFetch(candidates, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var turnMails []TurnMail
+	processed := new(imap.SeqSet)
+
+	for message := range messages {
+		body := message.GetBody(section)
+		if body == nil {
+			continue
+		}
+
+		turnMail, err := ParseTurnMail(body)
+		if err != nil || !game.MentionedIn(turnMail.Subject) {
+			continue
+		}
+
+		if _, ok := game.MatchingTrnAttachment(turnMail); ok {
+			processed.AddNum(message.Uid)
+			turnMails = append(turnMails, turnMail)
+		}
+	}
+
+	err = <-fetchDone
+	if err != nil {
+		return err
+	}
+
+	newestAttachment, found := game.NewestTrnAttachment(turnMails)
+	if !found {
+		return errors.New(fmt.Sprintf("None of the new mails for %v in %v had a trn file attached", game.Name, mailbox))
+	}
+
+	err = game.InstallTrn(newestAttachment)
+	if err != nil {
+		return err
+	}
+
+	// Older turn mails are obsolete now, so they get marked as well
+	if mailConfig.ProcessedMailbox != "" {
+		return imapClient.UidMove(processed, mailConfig.ProcessedMailbox)
+	}
+
+	return imapClient.UidStore(processed, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil)
+}
+
+// Connect to the IMAP server. Port 993 means implicit TLS, everything else uses STARTTLS if the server offers it.
+func (mailConfig ImapConfig) dial() (*client.Client, error) {
+	address := net.JoinHostPort(mailConfig.Server, mailConfig.Port)
+
+	if mailConfig.Port == "993" {
+		return client.DialTLS(address, nil)
+	}
+
+	imapClient, err := client.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if startTLS, _ := imapClient.SupportStartTLS(); startTLS {
+		err = imapClient.StartTLS(nil)
+		if err != nil {
+			imapClient.Logout()
+			return nil, err
+		}
+	}
+
+	return imapClient, nil
+}
+
+// Get the turn from a POP3 mailbox.
+// Takes the newest trn file from all turn mails for this game, and deletes those mails if configured to.
+func (game *Game) GetTurnByPop3(mailConfig Pop3Config) (err error) {
+	pop3, err := dialPop3(mailConfig.Server, mailConfig.Port)
+	if err != nil {
+		return err
+	}
+
+	// Quitting commits the deletions, so after a failure they are reset first
+	defer func() {
+		if err != nil {
+			pop3.rset()
+		}
+
+		pop3.quit()
+	}()
+
+	err = pop3.login(mailConfig.Username, mailConfig.Password)
+	if err != nil {
+		return err
+	}
+
+	messageNumbers, err := pop3.list()
+	if err != nil {
+		return err
+	}
+
+	var turnMails []TurnMail
+	var processed []int
+
+	for _, messageNumber := range messageNumbers {
+		// Only download messages that look like turn mails for this game
+		header, err := pop3.top(messageNumber)
+		if err != nil {
+			return err
+		}
+
+		message, err := mail.ReadMessage(bytes.NewReader(header))
+		if err != nil || !game.IsTurnMailHeader(message.Header, mailConfig.From) {
+			continue
+		}
+
+		raw, err := pop3.retr(messageNumber)
+		if err != nil {
+			return err
+		}
+
+		turnMail, err := ParseTurnMail(bytes.NewReader(raw))
+		if err != nil {
+			continue
+		}
+
+		if _, ok := game.MatchingTrnAttachment(turnMail); ok {
+			processed = append(processed, messageNumber)
+			turnMails = append(turnMails, turnMail)
+		}
+	}
+
+	newestAttachment, found := game.NewestTrnAttachment(turnMails)
+	if !found {
+		return errors.New(fmt.Sprintf("No turn mails for %v found on %v", game.Name, mailConfig.Server))
+	}
+
+	err = game.InstallTrn(newestAttachment)
+	if err != nil {
+		return err
+	}
+
+	if mailConfig.Delete {
+		for _, messageNumber := range processed {
+			err = pop3.dele(messageNumber)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get the turn from a local Maildir.
+// Takes the newest trn file from all turn mails for this game that are not flagged as seen, then flags those mails as seen.
+func (game *Game) GetTurnFromMaildir(maildirConfig MaildirConfig) error {
+	messages, err := ListMaildir(maildirConfig.Path)
+	if err != nil {
+		return err
+	}
+
+	var turnMails []TurnMail
+	var processed []MaildirMessage
+
+	for _, maildirMessage := range messages {
+		if maildirMessage.HasFlag("S") {
+			continue
+		}
+
+		turnMail, ok := game.readMaildirTurnMail(maildirMessage, maildirConfig.From)
+		if !ok {
+			continue
+		}
+
+		processed = append(processed, maildirMessage)
+		turnMails = append(turnMails, turnMail)
+	}
+
+	newestAttachment, found := game.NewestTrnAttachment(turnMails)
+	if !found {
+		return errors.New(fmt.Sprintf("No new turn mails for %v in %v", game.Name, maildirConfig.Path))
+	}
+
+	err = game.InstallTrn(newestAttachment)
+	if err != nil {
+		return err
+	}
+
+	for _, maildirMessage := range processed {
+		_, err = maildirMessage.AddFlag("S")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Read a Maildir message, if it is a turn mail for this game with a matching trn file attached
+func (game *Game) readMaildirTurnMail(maildirMessage MaildirMessage, from string) (TurnMail, bool) {
+	file, err := os.Open(maildirMessage.Path)
+	if err != nil {
+		return TurnMail{}, false
+	}
+
+	defer file.Close()
+
+	message, err := mail.ReadMessage(file)
+	if err != nil || !game.IsTurnMailHeader(message.Header, from) {
+		return TurnMail{}, false
+	}
+
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return TurnMail{}, false
+	}
+
+	turnMail, err := ParseTurnMail(file)
+	if err != nil {
+		return TurnMail{}, false
+	}
+
+	_, ok := game.MatchingTrnAttachment(turnMail)
+
+	return turnMail, ok
+}
+
+// Get the turn from a single saved mail (.eml file)
+func (game *Game) GetTurnFromEml(emlPath string) error {
+	file, err := os.Open(emlPath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	turnMail, err := ParseTurnMail(file)
+	if err != nil {
+		return err
+	}
+
+	if !game.MentionedIn(turnMail.Subject) {
+		return errors.New(fmt.Sprintf("%v is not a turn mail for %v, its subject is: %v", emlPath, game.Name, turnMail.Subject))
+	}
+
+	attachment, ok := game.MatchingTrnAttachment(turnMail)
+	if !ok {
+		return errors.New(fmt.Sprintf("%v has no trn file for %v attached", emlPath, game.Name))
+	}
+
+	return game.InstallTrn(attachment)
+}
+
+// Get the turn from the newest turn mail for this game in an mbox file
+func (game *Game) GetTurnFromMbox(mboxPath string) error {
+	file, err := os.Open(mboxPath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	messages, err := SplitMbox(file)
+	if err != nil {
+		return err
+	}
+
+	var turnMails []TurnMail
+
+	for _, raw := range messages {
+		message, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil || !game.IsTurnMailHeader(message.Header, "") {
+			continue
+		}
+
+		turnMail, err := ParseTurnMail(bytes.NewReader(raw))
+		if err != nil {
+			continue
+		}
+
+		turnMails = append(turnMails, turnMail)
+	}
+
+	attachment, found := game.NewestTrnAttachment(turnMails)
+	if !found {
+		return errors.New(fmt.Sprintf("No turn mails for %v found in %v", game.Name, mboxPath))
+	}
+
+	return game.InstallTrn(attachment)
+}
+
 // Get the turn by checking the download directory
 func (game *Game) GetTurnFromFolder(folder string) error {
 	downloadFilepath := filepath.Join(folder, game.TrnFile.Filename)
@@ -28,10 +385,14 @@ func (game *Game) GetTurnFromFolder(folder string) error {
 		return errors.New(fmt.Sprintf("%v does not exist", downloadFilepath))
 	}
 
-	err := utility.Mv(downloadFilepath, game.TrnFile.Fullpath)
+	err := game.installTurn(func(tx *utility.Transaction) error {
+		return tx.Move(downloadFilepath, game.TrnFile.Fullpath)
+	})
 	if err != nil {
 		return err
 	}
 
+	game.TrnFile.ReadHeader()
+
 	return nil
 }
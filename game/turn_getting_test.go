@@ -0,0 +1,346 @@
+package game
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/promisedlandt/dom4tools/utility"
+	"github.com/stretchr/testify/assert"
+)
+
+// The in-memory backend can't move messages, which every real server supports these days
+type movingBackend struct {
+	*memory.Backend
+}
+
+type movingUser struct {
+	backend.User
+}
+
+type movingMailbox struct {
+	backend.Mailbox
+}
+
+func (b movingBackend) Login(connInfo *imap.ConnInfo, username string, password string) (backend.User, error) {
+	user, err := b.Backend.Login(connInfo, username, password)
+	return movingUser{user}, err
+}
+
+func (u movingUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mailbox, err := u.User.GetMailbox(name)
+	return movingMailbox{mailbox}, err
+}
+
+func (m movingMailbox) MoveMessages(uid bool, seqset *imap.SeqSet, dest string) error {
+	err := m.CopyMessages(uid, seqset, dest)
+	if err != nil {
+		return err
+	}
+
+	err = m.UpdateMessagesFlags(uid, seqset, imap.AddFlags, []string{imap.DeletedFlag})
+	if err != nil {
+		return err
+	}
+
+	return m.Expunge()
+}
+
+// Start a local IMAP server with the given messages in the inbox
+func startImapServer(t *testing.T, messages ...string) (ImapConfig, backend.Mailbox) {
+	imapBackend := movingBackend{memory.New()}
+
+	user, err := imapBackend.Login(nil, "username", "password")
+	assert.NoError(t, err)
+
+	inbox, err := user.GetMailbox("INBOX")
+	assert.NoError(t, err)
+
+	for _, message := range messages {
+		err = inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(message))
+		assert.NoError(t, err)
+	}
+
+	err = user.CreateMailbox("Processed")
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	imapServer := server.New(imapBackend)
+	imapServer.AllowInsecureAuth = true
+	go imapServer.Serve(listener)
+	t.Cleanup(func() { imapServer.Close() })
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	return ImapConfig{Server: host, Port: port, Username: "username", Password: "password"}, inbox
+}
+
+func testGameDirectory(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "dom4tools")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	return directory
+}
+
+func TestGetTurnByMailBuiltin(t *testing.T) {
+	directory := testGameDirectory(t)
+	mailConfig, inbox := startImapServer(t,
+		turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "old turn"),
+		turnMailFixture("New turn file: testgame", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "new turn"),
+		turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn"),
+	)
+
+	game := Game{Name: "testgame", Directory: directory}
+	err := game.GetTurnByMailBuiltin(mailConfig)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new turn", string(data))
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	unseen, err := inbox.SearchMessages(false, criteria)
+	assert.NoError(t, err)
+	// Only the mail for the other game is left unread
+	assert.Len(t, unseen, 1)
+
+	err = game.GetTurnByMailBuiltin(mailConfig)
+	assert.Error(t, err)
+}
+
+func TestGetTurnByMailBuiltinWithSimilarGameNames(t *testing.T) {
+	directory := testGameDirectory(t)
+	mailConfig, inbox := startImapServer(t,
+		turnMailFixture("New turn file: foo", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "foo turn"),
+		turnMailFixture("New turn file: foo12", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "foo12 turn"),
+	)
+
+	game := Game{Name: "foo", Directory: directory}
+	err := game.GetTurnByMailBuiltin(mailConfig)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo turn", string(data))
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	unseen, err := inbox.SearchMessages(false, criteria)
+	assert.NoError(t, err)
+	// The mail for foo12 stays unread
+	assert.Len(t, unseen, 1)
+}
+
+func TestGetTurnByMailBuiltinMovesProcessedMails(t *testing.T) {
+	directory := testGameDirectory(t)
+	mailConfig, inbox := startImapServer(t,
+		turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn"),
+	)
+	mailConfig.ProcessedMailbox = "Processed"
+
+	game := Game{Name: "testgame", Directory: directory}
+	err := game.GetTurnByMailBuiltin(mailConfig)
+	assert.NoError(t, err)
+
+	status, err := inbox.Status([]imap.StatusItem{imap.StatusMessages})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), status.Messages)
+}
+
+func TestGetTurnByPop3(t *testing.T) {
+	directory := testGameDirectory(t)
+	server, mailConfig := startPop3Server(t,
+		turnMailFixture("New turn file: testgame", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "new turn"),
+		turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "old turn"),
+		turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn"),
+	)
+
+	game := Game{Name: "testgame", Directory: directory}
+	err := game.GetTurnByPop3(mailConfig)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new turn", string(data))
+
+	// Without delete, everything stays on the server
+	assert.Len(t, server.remaining(), 3)
+}
+
+func TestGetTurnByPop3Delete(t *testing.T) {
+	directory := testGameDirectory(t)
+	server, mailConfig := startPop3Server(t,
+		turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn"),
+		turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn"),
+	)
+	mailConfig.Delete = true
+
+	game := Game{Name: "testgame", Directory: directory, TrnFile: TrnFile{Filename: "early_agartha.trn", Fullpath: filepath.Join(directory, "early_agartha.trn")}}
+	err := game.GetTurnByPop3(mailConfig)
+	assert.NoError(t, err)
+
+	remaining := server.remaining()
+	assert.Len(t, remaining, 1)
+	assert.Contains(t, remaining[0], "othergame")
+}
+
+func TestGetTurnByPop3WithoutTurnMails(t *testing.T) {
+	directory := testGameDirectory(t)
+	_, mailConfig := startPop3Server(t,
+		turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn"),
+	)
+
+	game := Game{Name: "testgame", Directory: directory}
+	err := game.GetTurnByPop3(mailConfig)
+	assert.Error(t, err)
+}
+
+func TestGetTurnFromEml(t *testing.T) {
+	directory := testGameDirectory(t)
+	emlPath := filepath.Join(directory, "turn.eml")
+	err := ioutil.WriteFile(emlPath, []byte(turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn")), 0644)
+	assert.NoError(t, err)
+
+	game := Game{Name: "testgame", Directory: directory}
+	err = game.GetTurnFromEml(emlPath)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "turn", string(data))
+}
+
+func TestGetTurnFromMbox(t *testing.T) {
+	directory := testGameDirectory(t)
+	mboxPath := filepath.Join(directory, "Inbox")
+	mbox := "From turns@llamaserver.net Wed May 11 14:31:59 2016\n" +
+		turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "old turn") + "\n" +
+		"From turns@llamaserver.net Thu May 12 14:31:59 2016\n" +
+		turnMailFixture("New turn file: testgame", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "new turn") + "\n" +
+		"From turns@llamaserver.net Fri May 13 14:31:59 2016\n" +
+		turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn")
+	err := ioutil.WriteFile(mboxPath, []byte(mbox), 0644)
+	assert.NoError(t, err)
+
+	game := Game{Name: "testgame", Directory: directory}
+	err = game.GetTurnFromMbox(mboxPath)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new turn", string(data))
+}
+
+func TestGetTurnFromMboxWithSimilarGameNames(t *testing.T) {
+	directory := testGameDirectory(t)
+	mboxPath := filepath.Join(directory, "Inbox")
+	mbox := "From turns@llamaserver.net Wed May 11 14:31:59 2016\n" +
+		turnMailFixture("New turn file: foo", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "foo turn") + "\n" +
+		"From turns@llamaserver.net Thu May 12 14:31:59 2016\n" +
+		turnMailFixture("New turn file: foo12", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "foo12 turn")
+	err := ioutil.WriteFile(mboxPath, []byte(mbox), 0644)
+	assert.NoError(t, err)
+
+	game := Game{Name: "foo", Directory: directory}
+	err = game.GetTurnFromMbox(mboxPath)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo turn", string(data))
+}
+
+func TestGetTurnFromMaildir(t *testing.T) {
+	directory := testGameDirectory(t)
+	maildirPath := testMaildir(t)
+	mails := map[string]string{
+		"new/1.host":     turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "old turn"),
+		"cur/2.host:2,":  turnMailFixture("New turn file: testgame", "Thu, 12 May 2016 14:31:59 +0000", "early_agartha.trn", "new turn"),
+		"cur/3.host:2,S": turnMailFixture("New turn file: testgame", "Sat, 14 May 2016 14:31:59 +0000", "early_agartha.trn", "handled turn"),
+		"new/4.host":     turnMailFixture("New turn file: othergame", "Fri, 13 May 2016 14:31:59 +0000", "early_agartha.trn", "other turn"),
+	}
+	for name, mail := range mails {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(maildirPath, filepath.FromSlash(name)), []byte(mail), 0600))
+	}
+
+	game := Game{Name: "testgame", Directory: directory}
+	err := game.GetTurnFromMaildir(MaildirConfig{Path: maildirPath})
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new turn", string(data))
+
+	messages, err := ListMaildir(maildirPath)
+	assert.NoError(t, err)
+
+	var unseen []string
+	for _, message := range messages {
+		if !message.HasFlag("S") {
+			unseen = append(unseen, filepath.Base(message.Path))
+		}
+	}
+	assert.Equal(t, []string{"4.host"}, unseen)
+
+	err = game.GetTurnFromMaildir(MaildirConfig{Path: maildirPath})
+	assert.Error(t, err)
+}
+
+func TestGetTurnBacksUpOnlyWithNewTurn(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha.trn"), FileHeader{Version: 433, TurnNumber: 3, GameName: "testgame"})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_agartha.2h"), []byte("orders"), 0644))
+
+	emlPath := filepath.Join(directory, "turn.eml")
+	assert.NoError(t, ioutil.WriteFile(emlPath, []byte(turnMailFixture("New turn file: othergame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn")), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	game.BackupOnInstall = true
+
+	assert.Error(t, game.GetTurnFromEml(emlPath))
+	assert.Equal(t, 0, game.InstalledBackupTurn)
+	assert.False(t, utility.FileExists(filepath.Join(directory, "early_agartha-3.trn")))
+
+	assert.NoError(t, ioutil.WriteFile(emlPath, []byte(turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn")), 0644))
+
+	assert.NoError(t, game.GetTurnFromEml(emlPath))
+	assert.Equal(t, 3, game.InstalledBackupTurn)
+	assert.True(t, utility.FileExists(filepath.Join(directory, "early_agartha-3.trn")))
+	assert.True(t, utility.FileExists(filepath.Join(directory, "early_agartha-3.2h")))
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.Equal(t, "turn", string(data))
+}
+
+func TestGetTurnKeepsCurrentTurnWhenBackupFails(t *testing.T) {
+	directory := testGameDirectory(t)
+	writeTestTurnFile(t, filepath.Join(directory, "early_agartha.trn"), FileHeader{Version: 433, TurnNumber: 3, GameName: "testgame"})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "early_agartha-3.trn"), []byte("another turn"), 0644))
+
+	emlPath := filepath.Join(directory, "turn.eml")
+	assert.NoError(t, ioutil.WriteFile(emlPath, []byte(turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn")), 0644))
+
+	game, err := NewGame("testgame", directory)
+	assert.NoError(t, err)
+	game.BackupOnInstall = true
+
+	assert.Error(t, game.GetTurnFromEml(emlPath))
+
+	data, err := ioutil.ReadFile(filepath.Join(directory, "early_agartha.trn"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "turn", string(data))
+}
@@ -0,0 +1,260 @@
+package game
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/promisedlandt/dom4tools/utility"
+)
+
+// TurnMail is a mail, usually sent by the game server, that carries trn files
+type TurnMail struct {
+	From        string
+	Subject     string
+	Date        time.Time
+	Attachments []TurnAttachment
+}
+
+// TurnAttachment is a trn file attached to a mail
+type TurnAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+// Parse a raw RFC 5322 message and collect all trn files attached to it
+func ParseTurnMail(r io.Reader) (TurnMail, error) {
+	turnMail := TurnMail{}
+
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return turnMail, err
+	}
+
+	turnMail.From = decodeHeader(message.Header.Get("From"))
+	turnMail.Subject = decodeHeader(message.Header.Get("Subject"))
+
+	// Not every mail has a (valid) date, those are simply considered oldest
+	if date, err := message.Header.Date(); err == nil {
+		turnMail.Date = date
+	}
+
+	attachments, err := collectTrnAttachments(message.Header.Get("Content-Type"), message.Header.Get("Content-Disposition"), message.Header.Get("Content-Transfer-Encoding"), message.Body)
+	if err != nil {
+		return turnMail, err
+	}
+
+	turnMail.Attachments = attachments
+
+	return turnMail, nil
+}
+
+// Decode RFC 2047 encoded words in a header, leaving the header as is if that fails
+func decodeHeader(header string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(header)
+	if err != nil {
+		return header
+	}
+
+	return decoded
+}
+
+// Does the given mail header belong to a turn mail for this game?
+// The subject has to mention the game, and the sender has to contain from, unless from is empty.
+func (game *Game) IsTurnMailHeader(header mail.Header, from string) bool {
+	if !game.MentionedIn(decodeHeader(header.Get("Subject"))) {
+		return false
+	}
+
+	sender := strings.ToLower(decodeHeader(header.Get("From")))
+
+	return strings.Contains(sender, strings.ToLower(from))
+}
+
+// Does the text mention this game by its full name? Case insensitive.
+// The name has to stand on its own, so foo isn't mentioned in "New turn file: foo12".
+func (game *Game) MentionedIn(text string) bool {
+	return regexp.MustCompile(`(?i)(\A|[^\pL\pN_])` + regexp.QuoteMeta(game.Name) + `(\z|[^\pL\pN_])`).MatchString(text)
+}
+
+// Walk a (possibly multipart) MIME entity and return every trn file found in it
+func collectTrnAttachments(contentType string, contentDisposition string, transferEncoding string, body io.Reader) ([]TurnAttachment, error) {
+	var attachments []TurnAttachment
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// RFC 2045: without a usable content type, the entity is plain text
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return attachments, err
+			}
+
+			// The multipart reader already decodes quoted-printable parts and removes the header
+			partAttachments, err := collectTrnAttachments(part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return attachments, err
+			}
+
+			attachments = append(attachments, partAttachments...)
+		}
+
+		return attachments, nil
+	}
+
+	filename := attachmentFilename(params, contentDisposition)
+	if !ValidTrnFileName(filename) {
+		return attachments, nil
+	}
+
+	data, err := ioutil.ReadAll(decodeTransferEncoding(body, transferEncoding))
+	if err != nil {
+		return attachments, err
+	}
+
+	return append(attachments, TurnAttachment{Filename: filename, Data: data}), nil
+}
+
+// The file name of a MIME entity, taken from the Content-Disposition header, or the Content-Type name as fallback.
+// RFC 2231 parameters are handled by mime.ParseMediaType, but many mailers use RFC 2047 encoded words instead.
+// Never contains any directories.
+func attachmentFilename(contentTypeParams map[string]string, contentDisposition string) string {
+	var filename string
+
+	if _, dispositionParams, err := mime.ParseMediaType(contentDisposition); err == nil {
+		filename = dispositionParams["filename"]
+	}
+
+	if filename == "" {
+		filename = contentTypeParams["name"]
+	}
+
+	if filename == "" {
+		return ""
+	}
+
+	return filepath.Base(filepath.FromSlash(decodeHeader(filename)))
+}
+
+// Wrap the body of a MIME entity so reading from it returns the decoded content
+func decodeTransferEncoding(body io.Reader, transferEncoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// Find the attachment of the given mail that is a trn file for this game.
+// If we already know the name of the trn file, the attachment has to match it.
+func (game *Game) MatchingTrnAttachment(turnMail TurnMail) (TurnAttachment, bool) {
+	for _, attachment := range turnMail.Attachments {
+		if game.TrnFile.Filename == "" || strings.ToLower(attachment.Filename) == strings.ToLower(game.TrnFile.Filename) {
+			return attachment, true
+		}
+	}
+
+	return TurnAttachment{}, false
+}
+
+// Find the trn file for this game in the newest of the given turn mails
+func (game *Game) NewestTrnAttachment(turnMails []TurnMail) (TurnAttachment, bool) {
+	var newestAttachment TurnAttachment
+	var newestDate time.Time
+	found := false
+
+	for _, turnMail := range turnMails {
+		attachment, ok := game.MatchingTrnAttachment(turnMail)
+		if !ok {
+			continue
+		}
+
+		if !found || turnMail.Date.After(newestDate) {
+			newestAttachment = attachment
+			newestDate = turnMail.Date
+			found = true
+		}
+	}
+
+	return newestAttachment, found
+}
+
+// Install a trn file received by mail as the current trn file for this game
+func (game *Game) InstallTrn(attachment TurnAttachment) error {
+	if len(attachment.Data) == 0 {
+		return errors.New(fmt.Sprintf("%v is empty, not installing", attachment.Filename))
+	}
+
+	if game.TrnFile.Fullpath == "" {
+		game.TrnFile = TrnFile{Filename: attachment.Filename, Fullpath: filepath.Join(game.Directory, attachment.Filename)}
+	}
+
+	err := game.installTurn(func(tx *utility.Transaction) error {
+		return tx.WriteFile(game.TrnFile.Fullpath, attachment.Data, 0644, time.Time{})
+	})
+	if err != nil {
+		return err
+	}
+
+	game.TrnFile.ReadHeader()
+
+	return nil
+}
+
+// Put a new trn in place with install. With BackupOnInstall, the current turn is backed up in the same transaction,
+// so there is only a backup if there is a new turn, and never a new turn without its backup.
+func (game *Game) installTurn(install func(tx *utility.Transaction) error) (err error) {
+	tx := utility.NewTransaction()
+	defer func() { err = tx.Finish(err) }()
+
+	game.InstalledBackupTurn = 0
+
+	var turnNumber int
+	var backedUp []string
+
+	if game.BackupOnInstall {
+		turnNumber, backedUp, err = game.backupCurrentTurn(tx)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Not installing the new turn, backing up the current one failed: %v", err.Error()))
+		}
+	}
+
+	err = install(tx)
+	if err != nil {
+		return err
+	}
+
+	if len(backedUp) > 0 {
+		err = game.recordBackups(backedUp...)
+		if err != nil {
+			return err
+		}
+	}
+
+	game.InstalledBackupTurn = turnNumber
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package game
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A mail like the ones sent by Llamaserver, with the trn file attached in base64
+func turnMailFixture(subject string, date string, filename string, data string) string {
+	return fmt.Sprintf("From: Llamaserver <turns@llamaserver.net>\r\n"+
+		"Subject: %s\r\n"+
+		"Date: %s\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: multipart/mixed; boundary=\"llama\"\r\n"+
+		"\r\n"+
+		"--llama\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"Your new turn file is attached.\r\n"+
+		"--llama\r\n"+
+		"Content-Type: application/octet-stream; name=\"%s\"\r\n"+
+		"Content-Disposition: attachment; filename=\"%s\"\r\n"+
+		"Content-Transfer-Encoding: base64\r\n"+
+		"\r\n"+
+		"%s\r\n"+
+		"--llama--\r\n", subject, date, filename, filename, base64.StdEncoding.EncodeToString([]byte(data)))
+}
+
+func TestParseTurnMail(t *testing.T) {
+	raw := turnMailFixture("New turn file: testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.trn", "turn data")
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "New turn file: testgame", turnMail.Subject)
+	assert.Equal(t, 2016, turnMail.Date.Year())
+	assert.Equal(t, []TurnAttachment{{Filename: "early_agartha.trn", Data: []byte("turn data")}}, turnMail.Attachments)
+}
+
+func TestParseTurnMailQuotedPrintable(t *testing.T) {
+	raw := "Subject: testgame\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Disposition: attachment; filename=early_agartha.trn\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"turn=3Ddata\r\n" +
+		"--b--\r\n"
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TurnAttachment{{Filename: "early_agartha.trn", Data: []byte("turn=data")}}, turnMail.Attachments)
+}
+
+func TestParseTurnMailRFC2231Filename(t *testing.T) {
+	raw := "Subject: testgame\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment;\r\n" +
+		" filename*0*=UTF-8''early_;\r\n" +
+		" filename*1*=%61gartha.trn\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"dHVybiBkYXRh\r\n" +
+		"--b--\r\n"
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TurnAttachment{{Filename: "early_agartha.trn", Data: []byte("turn data")}}, turnMail.Attachments)
+}
+
+func TestParseTurnMailRFC2047Filename(t *testing.T) {
+	raw := turnMailFixture("=?UTF-8?Q?New_turn_file:_testgame?=", "Wed, 11 May 2016 14:31:59 +0000", "=?UTF-8?B?ZWFybHlfYWdhcnRoYS50cm4=?=", "turn data")
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "New turn file: testgame", turnMail.Subject)
+	assert.Equal(t, []TurnAttachment{{Filename: "early_agartha.trn", Data: []byte("turn data")}}, turnMail.Attachments)
+}
+
+func TestParseTurnMailSinglePart(t *testing.T) {
+	raw := "Subject: testgame\r\n" +
+		"Content-Type: application/octet-stream; name=\"early_agartha.trn\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"dHVybiBkYXRh\r\n"
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TurnAttachment{{Filename: "early_agartha.trn", Data: []byte("turn data")}}, turnMail.Attachments)
+}
+
+func TestParseTurnMailIgnoresOtherAttachments(t *testing.T) {
+	raw := turnMailFixture("testgame", "Wed, 11 May 2016 14:31:59 +0000", "early_agartha.2h", "orders")
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Empty(t, turnMail.Attachments)
+}
+
+func TestParseTurnMailStripsDirectories(t *testing.T) {
+	raw := turnMailFixture("testgame", "Wed, 11 May 2016 14:31:59 +0000", "../../early_agartha.trn", "turn data")
+
+	turnMail, err := ParseTurnMail(strings.NewReader(raw))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "early_agartha.trn", turnMail.Attachments[0].Filename)
+}
+
+func TestMatchingTrnAttachment(t *testing.T) {
+	game := Game{Name: "testgame", TrnFile: TrnFile{Filename: "early_agartha.trn"}}
+	turnMail := TurnMail{Attachments: []TurnAttachment{{Filename: "mid_ulm.trn"}, {Filename: "Early_Agartha.trn"}}}
+
+	attachment, ok := game.MatchingTrnAttachment(turnMail)
+
+	assert.True(t, ok)
+	assert.Equal(t, "Early_Agartha.trn", attachment.Filename)
+}
+
+func TestMatchingTrnAttachmentWithoutMatch(t *testing.T) {
+	game := Game{Name: "testgame", TrnFile: TrnFile{Filename: "early_agartha.trn"}}
+	turnMail := TurnMail{Attachments: []TurnAttachment{{Filename: "mid_ulm.trn"}}}
+
+	_, ok := game.MatchingTrnAttachment(turnMail)
+
+	assert.False(t, ok)
+}
+
+func TestMentionedIn(t *testing.T) {
+	game := Game{Name: "foo"}
+
+	assert.True(t, game.MentionedIn("New turn file: foo"))
+	assert.True(t, game.MentionedIn("New turn file: FOO (turn 12)"))
+	assert.True(t, game.MentionedIn("foo turn 3"))
+	assert.False(t, game.MentionedIn("New turn file: foo12"))
+	assert.False(t, game.MentionedIn("New turn file: foo_bar"))
+	assert.False(t, game.MentionedIn("New turn file: barfoo"))
+}
@@ -8,6 +8,10 @@ import (
 type TwohFile struct {
 	Filename string
 	Fullpath string
+	// Parsed from the file, nil if it couldn't be read
+	Header *FileHeader
+	// For backups: Fullpath is the backup archive the file is in, see BackupArchiveMetadata
+	Archived bool
 }
 
 // Returns the backup file name for a 2h file for the given turn number for this game
@@ -39,3 +43,29 @@ func (twohfile *TwohFile) BackupBasename() (string, error) {
 
 	return Backup2hBasename(twohfile.Filename), nil
 }
+
+// The contents of the file, see Contents
+func (twohfile TwohFile) Data() ([]byte, error) {
+	contents, err := twohfile.Contents()
+
+	return contents.Data, err
+}
+
+// The contents of the file and its modification time, read from its backup archive if it's in one
+func (twohfile TwohFile) Contents() (BackupContents, error) {
+	return readBackupFile(twohfile.Filename, twohfile.Fullpath, twohfile.Archived)
+}
+
+// Read the header of the file into Header. Header is reset if reading fails.
+func (twohfile *TwohFile) ReadHeader() error {
+	twohfile.Header = nil
+
+	header, err := ReadFileHeader(twohfile.Fullpath)
+	if err != nil {
+		return err
+	}
+
+	twohfile.Header = &header
+
+	return nil
+}
@@ -91,15 +91,28 @@ func main() {
 	var commandNames []string
 
 	app := kingpin.New("d4t", "Manage your Dominions 4 games from the command line.")
+	app.Flag("profile", "Account profile to use for mail, instead of the one assigned to the game").StringVar(&meta.Profile)
 	commandNames = append(commandNames, command.ConfigureCdCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureListCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureInfoCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureCreateCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureBackupCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureRestoreCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureVerifyCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureLabelCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigurePruneCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureMigrateCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureReplayCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureSubmitCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureResubmitCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureOutboxCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureReceiptsCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureGetCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigurePlayCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureServerCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureAccountCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureNationCommand(app, &meta))
+	commandNames = append(commandNames, command.ConfigureSecretCommand(app, &meta))
 	commandNames = append(commandNames, command.ConfigureVersionCommand(app, &meta, Version, VersionPrerelease, GitCommit))
 
 	// Show the names of the subcommands but execute no commands
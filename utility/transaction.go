@@ -0,0 +1,393 @@
+package utility
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Transaction groups file changes so that either all of them happen, or none.
+// Every file is written to a temporary file next to its destination, synced and renamed into place.
+// Files that get replaced are moved aside until Commit, so Rollback can put them back.
+type Transaction struct {
+	steps []transactionStep
+}
+
+// Leftover is a file a transaction left behind when it was interrupted, e.g. by a crash
+type Leftover struct {
+	Path string
+	// The file it belongs to
+	Original string
+	// Moved aside while replacing or removing Original, as opposed to a temporary file that never got into place
+	MovedAside bool
+	// When the transaction made it, zero for files of older versions that didn't record it
+	Created time.Time
+}
+
+// Leftovers younger than this might belong to a transaction that is still running in another process
+const LeftoverMinimumAge = time.Hour
+
+// Names of moved aside and temporary files, see leftoverPrefix
+var leftoverPattern = regexp.MustCompile(`\A\.(.+)\.(old|tmp)(?:(\d+)-)?\d+\z`)
+
+// What a single change did, so it can be undone
+type transactionStep struct {
+	path string
+	// Where the file that was at path before was moved to, empty if there was none
+	saved string
+	// For moves: where the file came from, and whether it still has to be removed on commit
+	source       string
+	removeSource bool
+	// The file at path was removed, and saved is all there is
+	removed bool
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// Write data to path. A zero modTime leaves the modification time at now.
+func (tx *Transaction) WriteFile(path string, data []byte, perm os.FileMode, modTime time.Time) error {
+	temporaryPath, err := writeTemporaryFile(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.install(temporaryPath, path, modTime)
+}
+
+// Copy src to dst, keeping its modification time
+func (tx *Transaction) Copy(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer s.Close()
+
+	temporaryPath, err := writeTemporaryFile(dst, info.Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.install(temporaryPath, dst, info.ModTime())
+}
+
+// Move src to dst. Renames if both are on the same filesystem, otherwise copies and removes src on Commit.
+func (tx *Transaction) Move(src string, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	saved, err := moveAside(dst)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil {
+		tx.steps = append(tx.steps, transactionStep{path: dst, saved: saved, source: src})
+		syncDirectory(filepath.Dir(dst))
+		return nil
+	}
+
+	// Probably another filesystem, put dst back and copy instead
+	if saved != "" {
+		if restoreErr := os.Rename(saved, dst); restoreErr != nil {
+			return errors.New(fmt.Sprintf("Could not move %v back after failing to replace it: %v", dst, restoreErr.Error()))
+		}
+	}
+
+	err = tx.Copy(src, dst)
+	if err != nil {
+		return err
+	}
+
+	tx.steps[len(tx.steps)-1].source = src
+	tx.steps[len(tx.steps)-1].removeSource = true
+
+	return nil
+}
+
+// Remove the file at path. Until Commit, it's only moved aside.
+func (tx *Transaction) Remove(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+
+	saved, err := moveAside(path)
+	if err != nil {
+		return err
+	}
+
+	tx.steps = append(tx.steps, transactionStep{path: path, saved: saved, removed: true})
+
+	return nil
+}
+
+// Make the changes permanent, throwing away the files they replaced
+func (tx *Transaction) Commit() error {
+	for _, step := range tx.steps {
+		if step.removeSource {
+			err := os.Remove(step.source)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if step.saved != "" {
+			err := os.Remove(step.saved)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	tx.steps = nil
+
+	return nil
+}
+
+// Undo all changes, newest first. Keeps going on errors, and returns the first one.
+func (tx *Transaction) Rollback() error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := len(tx.steps) - 1; i >= 0; i-- {
+		step := tx.steps[i]
+
+		switch {
+		case step.removed:
+			// Only the saved file to put back
+		case step.source != "" && !step.removeSource:
+			// A rename, so the file goes back where it came from
+			keep(os.Rename(step.path, step.source))
+		default:
+			if err := os.Remove(step.path); !os.IsNotExist(err) {
+				keep(err)
+			}
+		}
+
+		if step.saved != "" {
+			keep(os.Rename(step.saved, step.path))
+		}
+	}
+
+	tx.steps = nil
+
+	return firstErr
+}
+
+// Commit if err is nil, roll back otherwise. Returns err, or the error committing.
+//
+//	tx := utility.NewTransaction()
+//	defer func() { err = tx.Finish(err) }()
+func (tx *Transaction) Finish(err error) error {
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.New(fmt.Sprintf("%v, and rolling back failed too: %v", err.Error(), rollbackErr.Error()))
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Put a finished temporary file in place of path, moving any file at path aside first
+func (tx *Transaction) install(temporaryPath string, path string, modTime time.Time) error {
+	if !modTime.IsZero() {
+		err := os.Chtimes(temporaryPath, modTime, modTime)
+		if err != nil {
+			os.Remove(temporaryPath)
+			return err
+		}
+	}
+
+	saved, err := moveAside(path)
+	if err != nil {
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	err = os.Rename(temporaryPath, path)
+	if err != nil {
+		os.Remove(temporaryPath)
+		if saved != "" {
+			os.Rename(saved, path)
+		}
+		return err
+	}
+
+	tx.steps = append(tx.steps, transactionStep{path: path, saved: saved})
+	syncDirectory(filepath.Dir(path))
+
+	return nil
+}
+
+// Write a temporary file next to path and sync it to disk. Returns the path of the temporary file.
+func writeTemporaryFile(path string, perm os.FileMode, write func(w io.Writer) error) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), leftoverPrefix(path, "tmp"))
+	if err != nil {
+		return "", err
+	}
+
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Rename the file at path to a free name next to it. Returns that name, or nothing if there is no file at path.
+func moveAside(path string) (string, error) {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), leftoverPrefix(path, "old"))
+	if err != nil {
+		return "", err
+	}
+
+	f.Close()
+
+	err = os.Rename(path, f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Name pattern for a temporary or moved aside file next to path. The time is in it, because renaming keeps
+// the modification time of the file, and tells a crashed transaction from one that is still running.
+// Example: .early_ulm.trn.old1600000000-12345
+func leftoverPrefix(path string, kind string) string {
+	return "." + filepath.Base(path) + "." + kind + strconv.FormatInt(time.Now().Unix(), 10) + "-*"
+}
+
+// Make renames in the directory durable. Not every platform can sync directories, which is fine.
+func syncDirectory(directory string) {
+	d, err := os.Open(directory)
+	if err != nil {
+		return
+	}
+
+	d.Sync()
+	d.Close()
+}
+
+// Find the files interrupted transactions left in the directory. A missing directory has none.
+func FindLeftovers(directory string) ([]Leftover, error) {
+	var leftovers []Leftover
+
+	files, err := ioutil.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return leftovers, nil
+	}
+	if err != nil {
+		return leftovers, err
+	}
+
+	for _, f := range files {
+		matchData := leftoverPattern.FindStringSubmatch(f.Name())
+		if matchData == nil || f.IsDir() {
+			continue
+		}
+
+		leftover := Leftover{Path: filepath.Join(directory, f.Name()), Original: filepath.Join(directory, matchData[1]), MovedAside: matchData[2] == "old"}
+
+		if created, err := strconv.ParseInt(matchData[3], 10, 64); err == nil {
+			leftover.Created = time.Unix(created, 0)
+		}
+
+		leftovers = append(leftovers, leftover)
+	}
+
+	sort.Slice(leftovers, func(i, j int) bool { return leftovers[i].Path < leftovers[j].Path })
+
+	return leftovers, nil
+}
+
+// Clean up after interrupted transactions in the directory. Temporary files are removed, and moved aside files are
+// put back if nothing took their place, which rolls back what the transaction did to them.
+// A moved aside file whose original was replaced is kept, only the user can tell which of the two is right.
+// So are leftovers younger than LeftoverMinimumAge, or of unknown age, their transaction might still be running.
+// Returns the leftovers that were cleaned up, and the ones that are left.
+func RecoverLeftovers(directory string) (recovered []Leftover, left []Leftover, err error) {
+	leftovers, err := FindLeftovers(directory)
+	if err != nil {
+		return recovered, left, err
+	}
+
+	for _, leftover := range leftovers {
+		if leftover.Created.IsZero() || time.Since(leftover.Created) < LeftoverMinimumAge {
+			left = append(left, leftover)
+			continue
+		}
+
+		if !leftover.MovedAside {
+			err = os.Remove(leftover.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return recovered, left, err
+			}
+
+			recovered = append(recovered, leftover)
+			continue
+		}
+
+		if _, err := os.Lstat(leftover.Original); err == nil {
+			left = append(left, leftover)
+			continue
+		}
+
+		err = os.Rename(leftover.Path, leftover.Original)
+		if err != nil {
+			return recovered, left, err
+		}
+
+		recovered = append(recovered, leftover)
+	}
+
+	syncDirectory(directory)
+
+	return recovered, left, nil
+}
@@ -0,0 +1,141 @@
+package utility
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDirectory(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "dom4tools")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	return directory
+}
+
+func assertFile(t *testing.T, path string, expected string) {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+}
+
+// Only the given files, no leftover temporary files
+func assertDirectory(t *testing.T, directory string, expected ...string) {
+	files, err := ioutil.ReadDir(directory)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+
+	assert.ElementsMatch(t, expected, names)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	directory := testDirectory(t)
+	modified := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "a"), []byte("old a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "b"), []byte("b"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(directory, "b"), modified, modified))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "c"), []byte("c"), 0644))
+
+	tx := NewTransaction()
+	assert.NoError(t, tx.WriteFile(filepath.Join(directory, "a"), []byte("new a"), 0644, time.Time{}))
+	assert.NoError(t, tx.Copy(filepath.Join(directory, "b"), filepath.Join(directory, "b copy")))
+	assert.NoError(t, tx.Move(filepath.Join(directory, "c"), filepath.Join(directory, "d")))
+	assert.NoError(t, tx.Commit())
+
+	assertDirectory(t, directory, "a", "b", "b copy", "d")
+	assertFile(t, filepath.Join(directory, "a"), "new a")
+	assertFile(t, filepath.Join(directory, "d"), "c")
+
+	info, err := os.Stat(filepath.Join(directory, "b copy"))
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(modified))
+}
+
+func TestTransactionRollback(t *testing.T) {
+	directory := testDirectory(t)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "a"), []byte("old a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "c"), []byte("c"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "d"), []byte("old d"), 0644))
+
+	tx := NewTransaction()
+	assert.NoError(t, tx.WriteFile(filepath.Join(directory, "a"), []byte("new a"), 0644, time.Time{}))
+	assert.NoError(t, tx.WriteFile(filepath.Join(directory, "b"), []byte("b"), 0644, time.Time{}))
+	assert.NoError(t, tx.Move(filepath.Join(directory, "c"), filepath.Join(directory, "d")))
+	assert.NoError(t, tx.Remove(filepath.Join(directory, "a")))
+
+	failure := errors.New("failed")
+	assert.Equal(t, failure, tx.Finish(failure))
+
+	assertDirectory(t, directory, "a", "c", "d")
+	assertFile(t, filepath.Join(directory, "a"), "old a")
+	assertFile(t, filepath.Join(directory, "c"), "c")
+	assertFile(t, filepath.Join(directory, "d"), "old d")
+}
+
+func TestTransactionFailingStepLeavesNothing(t *testing.T) {
+	directory := testDirectory(t)
+
+	tx := NewTransaction()
+	assert.NoError(t, tx.WriteFile(filepath.Join(directory, "a"), []byte("a"), 0644, time.Time{}))
+	err := tx.Copy(filepath.Join(directory, "missing"), filepath.Join(directory, "b"))
+	assert.Error(t, tx.Finish(err))
+
+	assertDirectory(t, directory)
+}
+
+func TestRecoverLeftovers(t *testing.T) {
+	directory := testDirectory(t)
+	crashed := strconv.FormatInt(time.Now().Add(-2*LeftoverMinimumAge).Unix(), 10)
+
+	// Crashed long ago: while removing a, after replacing b, and while writing c
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, ".a.old"+crashed+"-1"), []byte("a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "b"), []byte("new b"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, ".b.old"+crashed+"-2"), []byte("old b"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, ".c.tmp"+crashed+"-3"), []byte("half a c"), 0644))
+	// Of unknown age
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, ".e.tmp123"), []byte("half an e"), 0644))
+
+	// Still running
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "d"), []byte("d"), 0644))
+	tx := NewTransaction()
+	assert.NoError(t, tx.Remove(filepath.Join(directory, "d")))
+
+	leftovers, err := FindLeftovers(directory)
+	assert.NoError(t, err)
+	assert.Len(t, leftovers, 5)
+
+	recovered, left, err := RecoverLeftovers(directory)
+	assert.NoError(t, err)
+	assert.Len(t, recovered, 2)
+	assert.Len(t, left, 3)
+
+	assertFile(t, filepath.Join(directory, "a"), "a")
+	assertFile(t, filepath.Join(directory, "b"), "new b")
+	assert.False(t, FileExists(filepath.Join(directory, "d")))
+
+	var originals []string
+	for _, leftover := range left {
+		originals = append(originals, filepath.Base(leftover.Original))
+	}
+	assert.ElementsMatch(t, []string{"b", "d", "e"}, originals)
+
+	assert.NoError(t, tx.Rollback())
+	assertFile(t, filepath.Join(directory, "d"), "d")
+
+	leftovers, err = FindLeftovers(filepath.Join(directory, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
@@ -1,46 +1,36 @@
 package utility
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
+	"time"
 )
 
+// Copy src to dst, keeping its modification time. dst is replaced at once, never left half written.
 func Cp(src, dst string) error {
-	s, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	// no need to check errors on read only file, we already got everything
-	// we need from the filesystem, so nothing can go wrong now.
-	defer s.Close()
-	d, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	if _, err := io.Copy(d, s); err != nil {
-		d.Close()
-		return err
-	}
-	return d.Close()
+	tx := NewTransaction()
+
+	return tx.Finish(tx.Copy(src, dst))
 }
 
+// Move src to dst, by renaming it if possible
 func Mv(src, dst string) error {
-	_, err := os.Open(src)
-	if err != nil {
-		return err
-	}
+	tx := NewTransaction()
 
-	err = Cp(src, dst)
-	if err != nil {
-		return err
-	}
+	return tx.Finish(tx.Move(src, dst))
+}
 
-	err = os.Remove(src)
+// Write data to path, replacing the file at once
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tx := NewTransaction()
 
-	return err
+	return tx.Finish(tx.WriteFile(path, data, perm, time.Time{}))
 }
 
-func contains(slice []string, item string) bool {
+// Checks whether the slice contains the given item
+func Contains(slice []string, item string) bool {
 	set := make(map[string]struct{}, len(slice))
 	for _, s := range slice {
 		set[s] = struct{}{}
@@ -56,3 +46,19 @@ func FileExists(filepath string) bool {
 
 	return err == nil
 }
+
+// Returns the hex encoded SHA-256 hash of the file at the given filepath
+func Sha256File(filepath string) (string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}